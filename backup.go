@@ -0,0 +1,297 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// written once all the buckets are backed up, so a backup dir
+	// with a manifest is a complete backup
+	BACKUP_MANIFEST_FILENAME = "manifest.json"
+
+	DEFAULT_CBBACKUP_PATH  = "cbbackup"
+	DEFAULT_CBRESTORE_PATH = "cbrestore"
+)
+
+// What's in a backup dir, and what's needed to recreate the buckets in a
+// freshly launched cluster before restoring into them
+type BackupManifest struct {
+	Created          time.Time      `json:"created"`
+	SourceNode       string         `json:"source_node"`
+	CouchbaseVersion string         `json:"couchbase_version"`
+	Buckets          []BackupBucket `json:"buckets"`
+}
+
+type BackupBucket struct {
+	Name          string `json:"name"`
+	BucketType    string `json:"bucket_type"`
+	RamQuotaMB    int    `json:"ram_quota_mb"`
+	ReplicaNumber int    `json:"replica_number"`
+	Dir           string `json:"dir"` // relative to the backup dir
+}
+
+// The cbbackup and cbrestore binaries, which ship with couchbase server
+// in /opt/couchbase/bin
+type BackupTools struct {
+	CbBackupPath  string
+	CbRestorePath string
+}
+
+func DefaultBackupTools() BackupTools {
+	return BackupTools{
+		CbBackupPath:  DEFAULT_CBBACKUP_PATH,
+		CbRestorePath: DEFAULT_CBRESTORE_PATH,
+	}
+}
+
+// Back up the given buckets (or all of them, if none are given) from a live
+// node into backupDir, one directory per bucket, followed by the manifest.
+func (c CouchbaseCluster) Backup(backupDir string, bucketNames []string, tools BackupTools) error {
+
+	if _, err := os.Stat(filepath.Join(backupDir, BACKUP_MANIFEST_FILENAME)); err == nil {
+		return fmt.Errorf("%v already contains a backup, use a new directory", backupDir)
+	}
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+	c.LocalCouchbaseIp = liveNodeIp
+
+	if err := c.FetchClusterDetails(); err != nil {
+		return err
+	}
+
+	buckets, err := c.getBackupBuckets(liveNodeIp)
+	if err != nil {
+		return err
+	}
+	buckets, err = filterBackupBuckets(buckets, bucketNames)
+	if err != nil {
+		return err
+	}
+	if len(buckets) == 0 {
+		return fmt.Errorf("No buckets to back up")
+	}
+
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+		log.Printf("Backing up bucket %v", bucket.Name)
+		args := []string{
+			c.backupNodeUrl(liveNodeIp),
+			filepath.Join(backupDir, bucket.Dir),
+			"-u", c.AdminUsername,
+			"-p", c.AdminPassword,
+			"-b", bucket.Name,
+		}
+		if err := runBackupTool(tools.CbBackupPath, args); err != nil {
+			return err
+		}
+	}
+
+	manifest := BackupManifest{
+		Created:          time.Now().UTC(),
+		SourceNode:       liveNodeIp,
+		CouchbaseVersion: c.LocalCouchbaseVersion,
+		Buckets:          buckets,
+	}
+
+	if err := writeBackupManifest(backupDir, manifest); err != nil {
+		return err
+	}
+
+	log.Printf("Backed up %v buckets to %v", len(buckets), backupDir)
+
+	return nil
+
+}
+
+// Restore the given buckets (or all of them, if none are given) from
+// backupDir, creating any that don't exist yet with the settings they
+// were backed up with.
+func (c CouchbaseCluster) Restore(backupDir string, bucketNames []string, tools BackupTools) error {
+
+	manifest, err := readBackupManifest(backupDir)
+	if err != nil {
+		return err
+	}
+
+	buckets, err := filterBackupBuckets(manifest.Buckets, bucketNames)
+	if err != nil {
+		return err
+	}
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+	c.LocalCouchbaseIp = liveNodeIp
+
+	existingBucketNames, err := c.GetBucketNames(liveNodeIp)
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+
+		if !containsString(existingBucketNames, bucket.Name) {
+			log.Printf("Creating bucket %v", bucket.Name)
+			params := bucketParams{
+				Name:          bucket.Name,
+				BucketType:    restoreBucketType(bucket.BucketType),
+				RamQuotaMB:    fmt.Sprintf("%v", bucket.RamQuotaMB),
+				AuthType:      "none",
+				ReplicaNumber: fmt.Sprintf("%v", bucket.ReplicaNumber),
+			}
+			if err := c.CreateBucket(params); err != nil {
+				return err
+			}
+			if err := c.WaitUntilBucketReady(liveNodeIp, bucket.Name); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("Restoring bucket %v", bucket.Name)
+		args := []string{
+			filepath.Join(backupDir, bucket.Dir),
+			c.backupNodeUrl(liveNodeIp),
+			"-u", c.AdminUsername,
+			"-p", c.AdminPassword,
+			"-b", bucket.Name,
+			"-B", bucket.Name,
+		}
+		if err := runBackupTool(tools.CbRestorePath, args); err != nil {
+			return err
+		}
+
+	}
+
+	log.Printf("Restored %v buckets from %v", len(buckets), backupDir)
+
+	return nil
+
+}
+
+// The bucketType to create a bucket with, from the one /pools/default/buckets
+// reported when it was backed up, which calls couchbase buckets membase
+func restoreBucketType(bucketType string) string {
+	if bucketType == "membase" {
+		return BUCKET_TYPE_COUCHBASE
+	}
+	return bucketType
+}
+
+func (c CouchbaseCluster) backupNodeUrl(liveNodeIp string) string {
+	return fmt.Sprintf("http://%v:%v", liveNodeIp, c.LocalCouchbasePort)
+}
+
+// The buckets in the cluster, with the settings needed to recreate them
+func (c CouchbaseCluster) getBackupBuckets(liveNodeIp string) ([]BackupBucket, error) {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/buckets", liveNodeIp, c.LocalCouchbasePort)
+
+	bucketDetails := []struct {
+		Name          string `json:"name"`
+		BucketType    string `json:"bucketType"`
+		ReplicaNumber int    `json:"replicaNumber"`
+		Quota         struct {
+			RawRAM int64 `json:"rawRAM"` // per node, in bytes
+		} `json:"quota"`
+	}{}
+	if err := c.getJsonData(endpointUrl, &bucketDetails); err != nil {
+		return nil, err
+	}
+
+	buckets := []BackupBucket{}
+	for _, details := range bucketDetails {
+		buckets = append(buckets, BackupBucket{
+			Name:          details.Name,
+			BucketType:    details.BucketType,
+			RamQuotaMB:    int(details.Quota.RawRAM / 1024 / 1024),
+			ReplicaNumber: details.ReplicaNumber,
+			Dir:           details.Name,
+		})
+	}
+
+	return buckets, nil
+
+}
+
+// Only the named buckets, or all of them if no names are given.  Asking
+// for a bucket that isn't there is an error rather than silently skipped.
+func filterBackupBuckets(buckets []BackupBucket, bucketNames []string) ([]BackupBucket, error) {
+
+	if len(bucketNames) == 0 {
+		return buckets, nil
+	}
+
+	filtered := []BackupBucket{}
+	for _, bucketName := range bucketNames {
+		found := false
+		for _, bucket := range buckets {
+			if bucket.Name == bucketName {
+				filtered = append(filtered, bucket)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("No bucket named %v", bucketName)
+		}
+	}
+
+	return filtered, nil
+
+}
+
+func writeBackupManifest(backupDir string, manifest BackupManifest) error {
+
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(backupDir, BACKUP_MANIFEST_FILENAME), manifestJson, 0644)
+
+}
+
+func readBackupManifest(backupDir string) (BackupManifest, error) {
+
+	manifest := BackupManifest{}
+
+	manifestJson, err := ioutil.ReadFile(filepath.Join(backupDir, BACKUP_MANIFEST_FILENAME))
+	if err != nil {
+		return manifest, fmt.Errorf("Unable to read the backup manifest, %v may not be a complete backup: %v", backupDir, err)
+	}
+
+	if err := json.Unmarshal(manifestJson, &manifest); err != nil {
+		return manifest, fmt.Errorf("Invalid backup manifest: %v", err)
+	}
+
+	return manifest, nil
+
+}
+
+func runBackupTool(toolPath string, args []string) error {
+
+	// don't log the args, they include the password
+	log.Printf("Running %v", toolPath)
+
+	cmd := exec.Command(toolPath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v failed: %v", toolPath, err)
+	}
+	return nil
+
+}
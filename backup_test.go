@@ -0,0 +1,68 @@
+package cbcluster
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestFilterBackupBuckets(t *testing.T) {
+
+	buckets := []BackupBucket{
+		{Name: "default", Dir: "default"},
+		{Name: "sessions", Dir: "sessions"},
+	}
+
+	filtered, err := filterBackupBuckets(buckets, []string{})
+	assert.True(t, err == nil)
+	assert.Equals(t, len(filtered), 2)
+
+	filtered, err = filterBackupBuckets(buckets, []string{"sessions"})
+	assert.True(t, err == nil)
+	assert.Equals(t, len(filtered), 1)
+	assert.Equals(t, filtered[0].Name, "sessions")
+
+	_, err = filterBackupBuckets(buckets, []string{"missing"})
+	assert.True(t, err != nil)
+
+}
+
+func TestBackupManifest(t *testing.T) {
+
+	backupDir, err := ioutil.TempDir("", "backup")
+	assert.True(t, err == nil)
+	defer os.RemoveAll(backupDir)
+
+	// a dir without a manifest isn't a complete backup
+	_, err = readBackupManifest(backupDir)
+	assert.True(t, err != nil)
+
+	manifest := BackupManifest{
+		SourceNode:       "10.0.0.1",
+		CouchbaseVersion: "3.0.1-1444-rel-community",
+		Buckets: []BackupBucket{
+			{Name: "default", BucketType: "membase", RamQuotaMB: 128, ReplicaNumber: 1, Dir: "default"},
+		},
+	}
+	assert.True(t, writeBackupManifest(backupDir, manifest) == nil)
+
+	readManifest, err := readBackupManifest(backupDir)
+	assert.True(t, err == nil)
+	assert.Equals(t, readManifest.SourceNode, "10.0.0.1")
+	assert.Equals(t, len(readManifest.Buckets), 1)
+	assert.Equals(t, readManifest.Buckets[0].RamQuotaMB, 128)
+
+	// backing up over an existing backup is refused before touching the cluster
+	c := CouchbaseCluster{}
+	err = c.Backup(backupDir, []string{}, DefaultBackupTools())
+	assert.True(t, err != nil)
+
+}
+
+func TestRestoreBucketType(t *testing.T) {
+	assert.Equals(t, restoreBucketType("membase"), BUCKET_TYPE_COUCHBASE)
+	assert.Equals(t, restoreBucketType("memcached"), BUCKET_TYPE_MEMCACHED)
+	assert.Equals(t, restoreBucketType("ephemeral"), "ephemeral")
+}
@@ -61,107 +61,127 @@ func (fi bindata_file_info) Sys() interface{} {
 	return nil
 }
 
-var _data_confd_service = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x8c\x53\x4d\x6b\xdb\x40\x10\xbd\xeb\x57\x0c\xb4\xb9\x65\xa3\x43\xdb\x4b\xc1\x87\x90\x3a\xd4\x87\x62\x61\x37\xa1\x90\x86\xb0\x91\x46\xf2\x10\x69\xd6\x9d\x1d\xc9\x16\xa5\xff\xbd\xbb\x2b\x43\x48\x14\x68\x2f\x5a\x76\xbe\xf6\xbd\x37\x4f\x77\x37\x4c\x7a\x9f\x7d\x41\x5f\x0a\xed\x95\x1c\x2f\xae\x1c\xd7\xd4\xf4\x62\xe3\x0d\xb6\x28\x03\x95\x98\x65\xef\xc0\xf5\x02\x95\x55\x0b\x83\x6b\xfb\x0e\xa1\xeb\xbd\xc2\x23\x82\xa0\xad\xc6\xec\xb2\x56\x94\x45\x19\x9a\x63\xcd\x85\x3f\xf5\x6d\xf0\x57\x4f\x82\x7e\x9e\xc9\xee\x4e\xb3\xef\xb3\x25\x0f\x24\x8e\x3b\x64\xbd\xa6\x16\x17\x39\x6a\x99\xe3\x73\x30\xbe\xfe\x44\x6d\x0b\x96\x47\xc0\x23\x79\x25\x6e\x20\x4d\xcc\x96\x47\x2c\xb7\x6a\x45\x0b\xc1\x85\xc9\x7b\x2f\xf9\x23\x71\x5e\xb9\xf2\x09\x65\xea\x3a\xe3\x7f\x54\x49\x17\x6b\x5e\x16\xbd\xae\xd9\xf7\x61\x92\xb6\x38\x56\xc8\x9f\xe8\x70\xcc\xfd\xc8\xa5\x69\xac\xe2\xc1\x8e\x86\x1b\xe2\xa3\x99\x10\x05\xb0\x07\x04\x46\xac\x40\x1d\xec\xc5\x0d\x54\x61\x52\x2f\xe5\xe3\x57\x2d\x71\x98\x79\x20\xdd\x81\xee\x10\x56\x05\x90\x42\x69\x39\x8a\x59\xee\x20\xf0\xaf\xa2\xe2\x7c\x9e\xd2\x27\x08\x3e\x1e\x1a\x8e\x58\xec\x91\x2b\xf8\x7a\x53\x80\xa7\x86\x6d\xeb\xe3\x5b\x09\xc5\x79\x50\xa9\x7a\xbd\xac\x67\x6e\x33\x62\xd2\x33\x18\x13\x24\xf8\x99\x01\x18\x84\xab\xf5\x66\xb9\xde\x3e\x14\x9b\xd5\xed\xe5\xf7\xe5\xc3\xaa\xb8\xfd\xb8\x78\xff\xfb\x8d\xe8\x9f\xa9\x63\x80\x7c\xb0\x92\x87\x31\xa7\x89\x17\x11\xe7\xe7\xb7\x82\x53\x83\x99\x20\x79\x53\x8b\xeb\x92\x2f\x4c\x42\x3a\x25\xd9\x06\x6b\x9d\x71\xba\xfd\x9f\xdc\x13\x35\xb7\x9f\x31\xf3\x21\x08\x46\xe1\x43\xdc\xee\x06\x7d\xa2\xef\xd8\xd4\x96\xda\x5e\xa2\x03\x7f\x98\xeb\x16\x31\xfc\x00\x2f\x56\x16\x3c\x1d\x9c\x1f\x85\xf7\x11\x4c\x17\x36\x12\xd6\x05\xd6\xc3\xcc\xc4\xdf\xa6\xdc\xba\x9e\xf9\xfb\x6f\x00\x00\x00\xff\xff\x33\xd6\xa5\x80\x5a\x03\x00\x00")
+var _data_couchbase_node_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9d\x53\x5d\x6b\xdb\x30\x14\x7d\xf7\xaf\x10\x65\x10\x18\x28\xda\xc3\xf6\xd2\xe1\x07\xcf\x71\xbb\x30\x12\x07\xdb\x0d\x83\x52\x8c\x22\xdd\x34\x22\xb6\xe4\xe9\xc3\xed\x28\xfd\xef\x95\xe3\x2c\x6e\x9b\x85\x85\x3d\x59\x1c\x9f\x7b\x7c\xce\x91\xef\xed\x8d\x14\xf6\x2e\x98\x80\x61\x5a\x34\x56\x28\x19\x32\xe5\xd8\x66\x45\x0d\x94\x52\x71\x08\xa2\xb5\x05\x1d\x72\xc5\xb6\xa0\xc7\x06\x74\x2b\x18\x04\x19\xfc\x72\x42\x83\x79\x8f\xf7\x64\xb0\x8c\x1f\x53\xdf\xa0\xc1\x6d\xde\x9f\xee\x82\x42\xd4\xa0\x9c\xcd\x2d\xd5\x36\x07\x16\x7e\x1a\x10\xd5\xf4\x40\x22\x5b\xa1\x95\xac\x41\xda\x2b\x51\x41\x48\xbc\x16\x81\x01\x0c\x92\x47\x60\x3b\x81\x85\x86\x10\x13\x67\x34\x59\x09\x49\x7a\x77\x68\x2b\xaa\x0a\x1d\x62\xfd\x83\xac\xeb\x53\xd4\x03\xb3\xde\x72\xa1\x11\x6e\x10\x69\xa9\x26\xda\x49\x72\x98\xc0\xbb\xce\xfe\x3e\xe6\x95\xf1\xfa\xd4\x0c\x61\x82\x9f\x98\xdb\x1b\x6b\xdc\xeb\x14\xa4\x6b\x12\xf4\xe5\xd3\x13\x1a\xc7\xdf\xca\x65\x92\xe5\xd3\x74\x8e\x9e\x9f\xcf\x10\xb1\x15\xfc\xe6\x20\xbf\x88\x87\xc7\x57\x2e\x58\xe5\x8c\xbf\x3d\x7c\xaf\x7a\xd1\x74\x5e\x44\xd3\x79\x92\x95\x45\x74\xfd\x46\x37\xdc\x09\xfa\x99\x0d\xc2\x0c\x8d\x8e\x0a\x74\x12\x61\x2c\x69\x0d\x83\x5b\x0f\xf8\x7c\xeb\xdd\xdd\x9d\xce\x8f\x70\x8b\x88\x6a\xec\xf0\xaa\x23\x5f\x1e\x43\x9d\x3e\xd8\x70\xa3\x8c\x45\xde\x6b\x87\x5c\x4c\xd2\xf8\x87\x37\x9b\xdd\xcc\xcb\x28\xbb\xce\x2f\xbc\xe5\x33\xda\x1a\xed\x63\xa9\xe6\xbc\x54\x7f\xbe\xfa\x5f\x15\x22\xd7\x70\x6a\x01\x3f\x68\xda\x34\x5e\xf3\x68\x10\x69\xa8\x55\x0b\x98\x4a\x8e\x35\xac\x68\x45\x25\xeb\xba\xab\x14\xa3\x15\x16\x0d\xfa\x10\xa7\x59\x92\xe6\xe5\x22\x9b\x2e\xa3\x22\x29\xa7\x8b\xe5\xe7\xaf\xc8\x38\xae\xd0\xde\xa7\xf1\x51\x06\xe1\x91\x5f\xb4\x9f\xf8\xaa\x02\xf0\x4b\x1e\x2b\xb9\xae\x04\xb3\xe6\xdd\x8a\x7f\x3c\x6c\xa5\x37\xad\xa9\xbc\x07\x34\x9e\x45\xf1\x77\xef\xbc\x9c\x25\x45\x34\x89\x8a\xc8\xbb\x9f\x51\xb6\x11\x12\x66\x60\xa9\x4f\x41\xc3\x2e\x61\xf7\x5f\xf8\x27\x48\xee\x4f\x2f\x18\xb2\x1d\x2a\x4c\x04\x00\x00")
 
-func data_confd_service_bytes() ([]byte, error) {
+func data_couchbase_node_service_template_bytes() ([]byte, error) {
 	return bindata_read(
-		_data_confd_service,
-		"data/confd.service",
+		_data_couchbase_node_service_template,
+		"data/couchbase_node@.service.template",
 	)
 }
 
-func data_confd_service() (*asset, error) {
-	bytes, err := data_confd_service_bytes()
+func data_couchbase_node_service_template() (*asset, error) {
+	bytes, err := data_couchbase_node_service_template_bytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "data/confd.service", size: 858, mode: os.FileMode(420), modTime: time.Unix(1427466163, 0)}
+	info := bindata_file_info{name: "data/couchbase_node@.service.template", size: 1100, mode: os.FileMode(420), modTime: time.Unix(1792395053, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
 
-var _data_confdata_service = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x64\x90\xb1\x72\xea\x30\x10\x45\x7b\x7d\xc5\x0e\x14\xaf\xc1\xcf\x5f\xe0\xe2\xcd\x83\xd4\x99\x90\xa4\x61\x28\x14\xf9\x02\x9b\xe0\x15\x59\xad\x8c\xf9\xfb\xc8\x98\x09\x33\x49\xe9\xeb\xbb\xda\x73\x76\xf3\x22\x6c\x5b\xb7\x44\x0a\xca\x27\xe3\x28\xcd\xff\x28\x3b\xde\x67\xf5\xe3\x17\x2d\xbd\x79\x7a\x8d\xc7\xdc\x81\xd6\xd0\x9e\x03\xdc\xbf\x9d\x41\x9b\x36\x86\x0f\xe8\xdf\x74\x0b\x9f\xf0\x99\x59\x91\x7e\xe6\x6e\x73\x1b\xdb\xba\x95\xf4\xac\x51\x3a\x88\x3d\xf0\x11\x4d\x0d\x0b\x35\xee\xa1\x73\xf3\x33\xc8\x2b\xe4\x8f\x91\x27\x89\xda\xf9\x23\xdd\x1e\x5a\x50\xf9\xf7\x9e\x93\x91\x00\x2d\x59\x24\x48\xca\x0a\xb2\x83\x1f\xdb\xed\x08\xda\x5f\x41\xdd\x1c\x03\x27\x4b\x0b\xf2\xd2\x52\x50\x78\x03\x45\x01\xf1\x8e\xd8\xa8\x8d\x48\x65\x83\x7b\xbe\x9c\xd0\x94\x38\x1d\xa2\x15\xfc\xce\xb3\x5c\xcd\x56\x03\x5b\x73\x41\x72\x6e\x35\x20\xac\xcd\xab\x3d\x2a\x9a\xaa\xce\x49\xeb\x37\x96\x7a\x32\x24\xed\x28\x94\x5b\x55\xe3\xe6\x7b\xb5\xf9\x55\xcb\x42\x55\x4f\x57\x59\xd9\xb3\x0c\x54\x55\xe2\xcb\x39\xbf\x87\x69\x8a\x11\x0e\x91\x66\x13\x6e\x5b\x2c\xcf\x93\x53\xa9\x59\x41\x83\xce\xdc\x57\x00\x00\x00\xff\xff\x3a\x3d\x3f\xc3\xae\x01\x00\x00")
+var _data_couchbase_sidekick_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9d\x53\xd1\x6e\x9b\x30\x14\x7d\xe7\x2b\xfc\x30\xa9\x4f\x8e\xf7\xb0\xbd\x44\x42\x1a\xcd\xdc\x09\x69\x81\x0c\x48\xb4\x2e\x8a\x10\x35\x97\xc6\x0a\xd8\xd4\x36\x69\xb3\xaa\xff\x3e\x13\xa2\x24\x85\xac\xab\xf6\x66\x8e\xcf\x39\xf7\xdc\xcb\xf5\x72\x2e\xb8\x59\x39\x5f\x41\x33\xc5\x6b\xc3\xa5\x70\x99\x6c\xd8\xfa\x2e\xd3\x90\x6a\x9e\xc3\x86\xb3\x8d\xe3\x15\x06\x94\x9b\x4b\xb6\x01\x35\xd2\xa0\xb6\x9c\x81\x13\xc1\x43\xc3\x15\xe8\x3e\xde\x91\xc1\xb0\x7c\x48\x7d\x85\x76\xc4\xa2\x04\x30\x43\xe6\x6b\xf8\x9a\x8b\x5c\x27\xf2\x2c\x9b\x90\x39\x7c\x79\x7e\x46\xa3\x79\xe0\x27\x69\x30\x9f\x5e\xd3\x08\xbd\xbc\xf4\xcc\xdf\xcf\x77\x96\x71\x77\x5a\x39\x09\xaf\x40\x36\x26\x36\x99\x32\x31\x30\xf7\xa3\x43\xc5\x96\x2b\x29\x2a\x10\xe6\x86\x97\xe0\x12\xdb\x07\x81\x13\xe8\xd0\x27\x60\x7b\xfe\x4c\x81\x8b\x49\xa3\x15\xb9\xe3\x82\x74\x93\x41\x1b\x5e\x96\xe8\x18\x05\x1f\xc7\xfa\xb6\x4a\x55\xff\xd4\xf4\x25\x75\x63\x0b\x99\x12\x76\x39\x88\xcf\xfc\xf1\x89\x9c\x0c\x58\xd9\x68\x3b\x11\x7c\x2f\xc7\xed\x14\x26\x61\x90\x78\x7e\x40\xa3\x34\xf1\xbe\xd9\x39\x9c\x7c\xdd\xbd\xa1\xd5\xac\x11\x66\xe8\x6a\x90\xaa\x11\x08\x63\x91\x55\x70\x21\x5d\x7b\x03\xc6\x5d\x4b\x6d\x10\xde\x22\xb2\xcd\x14\xb1\x82\xb3\x18\xed\x6f\x18\xff\x0d\x57\x72\xaf\xd2\x3b\x4d\x0a\x4d\xd8\xbd\x92\x4d\x3d\x26\xad\x5b\x0f\xb3\xc4\xff\xea\x12\x35\x75\x9e\x19\xc0\x8f\x2a\xab\x6b\xdb\xcc\x40\x88\x74\x3b\x02\x7c\xb1\xb3\x52\xb2\xac\xc4\xbc\x76\x3f\x4c\xc2\x88\x86\x71\x3a\x8b\xfc\x85\x97\xd0\xd4\x9f\x2d\x3e\xd9\x6a\xbc\x40\xa3\x98\x46\x0b\x7f\x42\xe3\xb6\x16\xc6\x87\xdd\xd2\x6e\x9b\xe5\xec\xca\x7e\x82\xc8\xbb\x43\xab\x9a\xd2\x69\x18\xdd\xa6\x3f\xe6\x61\xe2\x1d\xa4\x15\x54\x52\xed\xf0\x43\x23\x4d\xd6\xe9\xfb\xa4\xb7\x4c\xd2\x59\xf8\xdd\x9f\xdc\x0e\xad\x70\x2d\x4b\xce\x76\x03\xc3\x93\xa0\x6f\xfb\x2b\x0c\x68\xe7\xf3\x5b\x0a\xd8\x0b\x0f\xd0\x91\x79\x75\x58\x1e\x59\x0f\x16\x52\x5b\xf0\xd2\x16\x3b\xcb\x9f\xf8\xa6\x7d\xe1\x2b\x67\x9a\xb1\x35\x17\x10\x16\xef\x7f\xac\x7f\x00\x2b\xa9\xbe\xe6\xb5\x04\x00\x00")
 
-func data_confdata_service_bytes() ([]byte, error) {
+func data_couchbase_sidekick_service_template_bytes() ([]byte, error) {
 	return bindata_read(
-		_data_confdata_service,
-		"data/confdata.service",
+		_data_couchbase_sidekick_service_template,
+		"data/couchbase_sidekick@.service.template",
 	)
 }
 
-func data_confdata_service() (*asset, error) {
-	bytes, err := data_confdata_service_bytes()
+func data_couchbase_sidekick_service_template() (*asset, error) {
+	bytes, err := data_couchbase_sidekick_service_template_bytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "data/confdata.service", size: 430, mode: os.FileMode(420), modTime: time.Unix(1427465921, 0)}
+	info := bindata_file_info{name: "data/couchbase_sidekick@.service.template", size: 1205, mode: os.FileMode(420), modTime: time.Unix(1792395053, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
 
-var _data_couchbase_node_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9c\x93\x4f\xab\xda\x40\x14\xc5\xf7\xf9\x14\xb3\x28\x08\x85\x79\xd3\x45\xbb\x79\x25\x8b\xd4\xe6\x95\x6c\x8c\x24\xa9\x14\x1e\x12\xc6\xc9\xb5\x0e\x4e\x66\xa6\xf3\x27\x5a\xc4\xef\xde\xd1\x58\x53\x0d\xa5\xd2\x5d\x38\x9c\xfb\xcb\x39\xc3\xbd\xaf\x5f\x25\x77\xcb\xe8\x33\x58\x66\xb8\x76\x5c\xc9\x98\x29\xcf\x36\x2b\x6a\xa1\x96\xaa\x81\x28\x59\x3b\x30\x71\xa3\xd8\x16\xcc\x93\x05\xd3\x71\x06\x51\x01\x3f\x3c\x37\x60\xef\xf5\xde\x0c\x8e\x35\x63\xeb\x8d\x1a\xbd\x96\xfd\xd7\x32\xaa\x78\x0b\xca\xbb\xd2\x51\xe3\x4a\x60\xf1\xbb\x41\x51\xba\x17\x52\xd9\x71\xa3\x64\x0b\xd2\xbd\x70\x01\x31\x09\x2c\x02\x83\x18\xa5\x7b\x60\x67\xc0\xdc\x40\x8c\x89\xb7\x86\xac\xb8\x24\x7d\x3a\xb4\xe5\x42\xa0\x6b\xad\x7f\x98\x4d\xfb\x37\xeb\xbd\x53\xfb\x3f\xb1\xe4\x54\x0d\xcc\xf3\xe1\x80\x9e\xa6\x9f\xea\x45\x5a\x94\x59\x3e\x43\xc7\xe3\x03\x10\x27\xe0\x67\x03\xf2\x03\xdf\xed\xc9\x15\x88\x99\xf0\x36\x3c\x27\xfe\xae\x7a\x68\x3e\xab\x92\x6c\x96\x16\x75\x95\x7c\xb9\xe1\xc6\x67\x60\x98\xd9\x20\xcc\xd0\x64\xd4\xc8\x4b\x84\xb1\xa4\x2d\x0c\x69\x11\xee\x10\x51\xda\x0d\xbf\x23\x1d\x35\xcf\x63\xe9\x34\x09\x2e\xde\x28\xeb\x1e\xe8\x3a\xb9\x84\x52\xfa\xb1\x4c\xbf\xc9\xff\xf5\x00\xc8\xeb\x86\x3a\xc0\x3b\x43\xb5\x0e\xcc\xd1\x20\x32\xd0\xaa\x0e\x30\x95\x0d\x36\xb0\xa2\x82\x4a\x16\x9a\x63\xa1\x18\x15\x98\x6b\xf4\x66\x9a\x17\x69\x5e\xd6\xf3\x22\x5b\x24\x55\x5a\x67\xf3\xc5\xfb\x8f\xc8\xfa\x46\xa1\x4b\x4e\x1b\xaa\x0c\xe0\x49\xd8\xdb\x6f\xf8\x45\x00\x84\x9b\x99\x2a\xb9\x16\x9c\x39\x7b\x77\x31\x6f\xaf\x4b\xfe\x2b\x00\x00\xff\xff\x30\x7b\x9b\x8e\x5d\x03\x00\x00")
+var _data_sync_gw_haproxy_cfg_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x7d\x52\x41\x6e\xdb\x30\x10\xbc\xf3\x15\x03\xf8\x56\xc0\xae\x9b\x34\x01\xda\x5b\x0e\x86\x11\x20\x49\x8d\xd8\x3d\x0b\x14\xb5\x96\x08\x53\xa4\x41\xae\xa2\x18\x46\xfe\xde\x25\xed\x00\xb1\x0f\xd5\x85\xe4\x2c\x39\xb3\x33\xab\x09\x96\xe4\x29\x6a\xa6\x06\xf5\x01\xe9\xe0\xcd\xb4\x1d\xa7\xc6\x0d\x89\x29\xc2\x05\xdd\x4c\x6b\xed\xb4\x37\x72\xda\xc6\xd0\x83\x3b\x82\xb3\x6f\x84\xb5\xdc\xc5\x52\x5e\x8e\xfa\xa0\x26\xf0\xa1\xa1\x04\xeb\x41\x6c\x9a\x19\xf0\xe0\x0f\x30\x9d\xf6\xad\xa0\xa3\x75\x0e\x35\x21\xbc\x51\x1c\xa3\x65\x26\x3f\x53\xaa\x75\x41\xa8\x15\xe4\xeb\xf5\xbb\x09\xde\xe3\xe7\xfc\xd7\xbd\x52\x0d\x6d\xf5\xe0\x38\x9d\x4a\xc2\x8b\x8e\x79\x5f\x4e\x61\xcf\x36\x78\x6c\x43\x1c\x75\x6c\x64\xf9\x8a\xe6\x5b\xd3\x44\x51\x54\xc4\x41\x48\x54\x8a\x6c\x7b\x0a\x03\x23\x0b\x90\x61\xdc\xa5\x4b\xd8\x59\xf2\x8c\xdb\xfb\xf9\x09\x9f\x88\x69\xdf\xee\x83\x74\x5c\x7d\xf6\xbf\x25\x6a\x12\x8c\xf6\xd9\x44\x47\xae\x11\x45\x2a\x5d\x20\x91\xa8\x69\x87\xde\xfa\x81\xe9\x92\xfa\xd4\xca\x57\xea\x91\xea\x14\xcc\x8e\xf8\x8a\xfb\xe2\x19\x0f\xd2\xa8\xc3\x8f\x4e\x29\x49\xdc\x4b\x58\x4d\x19\x4c\xd5\x9e\xc3\xce\x97\x6b\x2b\xe8\xb7\xdf\xc7\x23\x66\x4f\x8f\xeb\xcd\xe2\xa5\x5a\xfd\x79\xdd\xe0\xe3\xa3\x54\xcf\x09\x56\xb5\x16\xb1\xab\xe7\x55\x99\x94\x52\xff\xa9\x15\x81\xd3\xd4\xe1\x48\x27\xce\xd9\x5d\x27\x6d\xba\x1d\x96\x8b\x0d\xbe\x97\x42\xc9\xde\x74\x64\x76\xa0\xf7\x7d\xce\x39\xb1\xe6\x21\xe1\x66\x3e\x57\xc7\xe3\x14\x31\xdb\xc5\xec\xef\x6a\xbd\x79\x5d\x3c\x3c\xaf\x3f\x5b\x3d\x87\x94\x8d\xbc\xe8\x9e\x04\x2e\xfb\xc7\xbd\xec\x8a\xbd\x55\x88\x9c\xd1\x13\xb9\xf5\xf9\xbf\xbc\x93\xdc\xb4\x4c\xe8\x16\xd1\x26\xc2\x4d\x51\xc8\x66\x84\xf4\x1f\xdc\x56\xb3\x11\xd3\x02\x00\x00")
 
-func data_couchbase_node_service_template_bytes() ([]byte, error) {
+func data_sync_gw_haproxy_cfg_template_bytes() ([]byte, error) {
 	return bindata_read(
-		_data_couchbase_node_service_template,
-		"data/couchbase_node@.service.template",
+		_data_sync_gw_haproxy_cfg_template,
+		"data/sync_gw_haproxy.cfg.template",
 	)
 }
 
-func data_couchbase_node_service_template() (*asset, error) {
-	bytes, err := data_couchbase_node_service_template_bytes()
+func data_sync_gw_haproxy_cfg_template() (*asset, error) {
+	bytes, err := data_sync_gw_haproxy_cfg_template_bytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "data/couchbase_node@.service.template", size: 861, mode: os.FileMode(420), modTime: time.Unix(1432311931, 0)}
+	info := bindata_file_info{name: "data/sync_gw_haproxy.cfg.template", size: 723, mode: os.FileMode(420), modTime: time.Unix(1792390949, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
 
-var _data_couchbase_sidekick_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9c\x52\x4d\x6b\xdb\x40\x14\xbc\xef\xaf\xd8\x43\x21\xa7\x8d\x7a\x68\x2f\x85\x85\x2a\xa9\x52\x74\x88\x64\x24\x39\x14\x8c\x11\xca\xea\xb9\x7a\x68\xb5\xab\xee\x47\x92\x62\xfc\xdf\x2b\x59\xc5\xae\x2d\xd3\x9a\xde\x96\xd9\x99\x79\xf3\x86\xb7\x5a\x2a\x74\x6b\xf2\x05\xac\x30\xd8\x3b\xd4\x8a\x0b\xed\x45\xf3\x5c\x59\x28\x2d\xd6\xd0\xa2\x68\x49\xb8\x71\x60\x78\xad\x45\x0b\xe6\xd6\x82\x79\x41\x01\x24\x83\x1f\x1e\x0d\xd8\x73\x7c\x22\x83\x13\xf5\x9c\x7a\x82\x4e\xc4\x8d\x04\x70\x73\xe6\x29\x7c\x87\xaa\xb6\x85\xfe\x23\x9b\xd2\x35\x7c\xde\x6e\xe9\xed\x32\x89\x8b\x32\x59\x3e\xde\x45\x19\xdd\xed\xce\xcc\xaf\xe7\x93\x55\x3e\xbd\xd6\xa4\xc0\x0e\xb4\x77\xb9\xab\x8c\xcb\x41\xf0\xf7\x24\x52\x2f\x68\xb4\xea\x40\xb9\x07\x94\xc0\x83\x61\x8f\x00\x8e\x20\x89\xde\x40\xec\xf9\x0b\x03\x9c\x05\xde\x9a\xe0\x19\x55\x30\x35\x43\x5b\x94\x92\x1e\xa2\xb0\x43\xad\x7f\x57\x99\xee\x9f\x9a\x73\x49\xef\x87\x41\x4e\xc2\xcf\x1a\xd4\x47\x7c\x7d\x0b\x8e\x06\x42\x7a\x3b\x34\xc2\xbe\xeb\x4f\x63\x0b\xf7\x69\x52\x84\x71\x12\x65\x65\x11\x7e\x1d\x7a\x38\xfa\xf2\xbd\xe1\xa0\x69\x28\x13\xf4\x66\x96\xca\x2b\xca\x98\xaa\x3a\xb8\x90\x6e\xfc\x01\xc7\x1b\x6d\xdd\xff\xc5\xa0\xbe\xaf\x2b\x07\xec\xd5\x54\x7d\x3f\x4c\x9b\x09\xa9\x1d\x33\xb2\x8b\xa3\xa5\x16\x95\x64\xd8\xf3\x77\xf7\x69\x16\xa5\x79\xb9\xc8\xe2\xa7\xb0\x88\xca\x78\xf1\xf4\xe1\xe6\xf7\x86\xba\x9f\xb5\x66\x07\xf0\x52\xd5\x64\xf5\x8d\x3d\x8c\x67\xb8\x26\x8f\x95\x68\x50\x41\xba\xb9\xfe\xa2\x7e\x05\x00\x00\xff\xff\x28\xcb\x1c\xaa\x5a\x03\x00\x00")
+var _data_sync_gw_load_balancer_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9d\x52\xdb\x6a\x02\x31\x14\x7c\xdf\xaf\xc8\x0f\xc4\x14\x4a\x5f\x84\x7d\xb0\xf5\xc2\x82\xb5\xa2\xf6\xa1\x88\x2c\x31\x7b\xd4\x60\x36\xd9\x9e\x24\x5e\x10\xff\xbd\x59\x2f\xd4\x2b\x95\x3e\x25\x0c\x73\x26\x73\x26\x33\xfc\xd4\xd2\x8d\xa2\x3a\x58\x81\xb2\x70\xd2\xe8\xd8\xae\xb5\x48\xa7\xcb\x54\x19\x9e\xa5\x63\xae\xb8\x16\x80\x51\x6d\xe2\x00\xe3\xcc\x88\x39\x60\xc5\x02\x2e\xa4\x80\xa8\x07\xdf\x5e\x22\xd8\x4b\x7c\x4f\x06\x27\xb2\x6b\xea\x19\x1a\x0d\xfb\xfb\xdb\x28\x1a\xc8\x1c\x8c\x77\x7d\xc7\xd1\xf5\x41\xc4\x4f\x51\x43\x2f\x24\x1a\x9d\x83\x76\x4d\xa9\x20\x66\x61\x94\xc1\x2f\x18\x35\x56\x20\x76\xfc\x2e\x42\x4c\x99\xb7\xc8\xc6\x52\xb3\xbd\x19\x32\x97\x4a\x91\x72\x19\x3a\x5d\x52\x35\xfe\x83\x8d\xf9\x5d\xee\x25\xb5\xf0\x41\x78\xb3\x21\x95\xf6\x6b\x9a\xbc\xd7\x5a\x0d\xb2\xdd\x3e\x30\xe1\x14\xac\x33\xd0\x2f\x72\xb9\x62\xc2\x78\x31\x1b\x73\x0b\x54\x28\x6f\x43\x58\x74\x6a\xaa\xa5\xe4\xdb\x47\x67\x50\x4b\x3a\x8d\x5e\x3a\xa8\xb5\xee\xeb\xe6\xf3\x4c\x22\xa1\x05\x61\x33\x93\x43\x90\x43\x60\x8f\xda\x47\xaf\x09\xa5\x1a\x5c\x3c\x33\xd6\x11\xba\xb8\x2d\x52\xbd\x89\xfe\x6f\x0b\xe2\x8b\x8c\x3b\xa0\x4b\xe4\x45\x11\x2c\x1c\xf5\x0e\x63\xa4\xac\x1a\x3d\x56\x8d\x20\xe8\x2c\x1c\x94\xba\x75\x01\xf1\x21\xe8\xc1\x57\xb7\xcc\x39\xa0\x19\x58\x27\x35\xdf\x75\xf5\xa6\x47\x76\x18\x09\x2e\x9a\x49\x2b\x6d\x26\xed\xf3\x1f\xba\x97\x08\xcf\xe1\xa4\x03\x0f\x65\x74\xfe\x52\x3d\xe9\x95\x16\x6f\x57\xc3\x14\x57\xef\xda\x00\x12\xea\xc8\xf3\x69\xf5\x7a\x61\xbd\xd2\xa4\xd1\x74\xc2\xa5\xf2\x08\xd1\x0f\x26\x52\xa1\xbf\xa5\x03\x00\x00")
 
-func data_couchbase_sidekick_service_template_bytes() ([]byte, error) {
+func data_sync_gw_load_balancer_service_template_bytes() ([]byte, error) {
 	return bindata_read(
-		_data_couchbase_sidekick_service_template,
-		"data/couchbase_sidekick@.service.template",
+		_data_sync_gw_load_balancer_service_template,
+		"data/sync_gw_load_balancer.service.template",
 	)
 }
 
-func data_couchbase_sidekick_service_template() (*asset, error) {
-	bytes, err := data_couchbase_sidekick_service_template_bytes()
+func data_sync_gw_load_balancer_service_template() (*asset, error) {
+	bytes, err := data_sync_gw_load_balancer_service_template_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "data/sync_gw_load_balancer.service.template", size: 933, mode: os.FileMode(420), modTime: time.Unix(1792390949, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _data_sync_gw_load_balancer_sidekick_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9d\x53\xdb\x6a\xeb\x30\x10\x7c\xf7\x57\xe8\x07\x54\x15\x4a\x5f\x02\x7e\x48\xdb\xa4\x04\x7a\x23\x71\xa1\x87\x52\x8c\x22\x6f\x62\x11\x59\x72\x57\xab\xb8\xa1\xf4\xdf\x8f\x9c\x38\x27\x9c\xc4\xb4\xd0\x27\x99\xf1\xce\xec\xec\x6a\xf4\xfa\x6c\x35\xbd\x25\x37\xe0\x15\xea\x9a\xb4\xb3\xa9\xdf\x58\x95\x2f\x9b\xdc\x38\x59\xe4\x73\x69\xa4\x55\x80\xb9\xd7\x05\xac\xb4\x5a\x25\xc3\x05\x01\xa6\x85\x53\x2b\xc0\x33\x0f\xb8\xd6\x0a\x92\x29\xbc\x07\x8d\xe0\x8f\xf1\x5d\x31\x90\x2a\x4e\x4b\xff\x43\xaf\xb4\x2d\x7c\xe6\xfa\x9b\x1f\xc9\x7d\x5f\x93\xbc\xce\x76\x5f\x6f\x49\xa6\x2b\x70\x81\x66\x24\x91\x66\xa0\xd2\xf3\x64\x64\xd7\x1a\x9d\xad\xc0\xd2\x58\x1b\x48\x45\x34\x21\xe0\x00\x26\xa3\x0f\x50\xdb\xfa\x27\x84\x94\x8b\xe0\x51\xcc\xb5\x15\xbb\xb1\xd8\x4a\x1b\xc3\xda\xf6\x7c\xd9\x70\x33\xe7\xff\x96\xf2\x3d\x0d\xab\x9f\x49\xc7\x9c\x3a\xc4\x56\x64\x60\x53\x80\xbd\xd4\xcd\x87\x50\x2e\xa8\x72\x2e\x3d\x70\x65\x82\x8f\x7b\xe0\x4b\x37\xf8\xfc\x64\x67\xd7\x8f\x0f\xd9\x70\xf2\x30\x9a\xe6\xd9\xf0\x96\x7d\x7d\x1d\x74\x4f\x44\x31\x58\xc6\xb9\x95\x15\xf4\x19\x6a\x7f\x01\xa5\xa5\xf3\xc4\xf8\x9a\x89\xb5\x44\x11\x19\x62\x7f\xa7\xf1\x18\xf4\x81\xdb\xe2\xd2\x55\x10\x3d\x22\x88\x83\xf2\xa0\x17\xfd\xdd\x54\x2c\xd4\x85\x24\xe0\x0d\xca\xba\x8e\xa3\xec\xf5\x3a\x1a\x6b\xc3\xc0\xf7\x61\x60\x8d\x24\x55\xc6\x79\x68\x53\x43\xda\xca\xdd\x5d\xe5\xd9\x9f\xa7\x51\x2b\xc4\x79\x01\x9e\xb4\x95\xdb\xb4\xf7\x5a\x14\x1d\x25\x9a\x18\x4f\x6e\xf3\xf1\xe4\xae\x63\x22\x6c\xfb\x28\x67\x49\x6a\xdb\x65\x71\xc7\xe9\xd6\xee\xea\x93\xad\xfb\x08\x32\x4e\xec\xa2\x37\x05\xd3\x68\xa6\xbd\x2b\x67\xf9\x42\x6a\x13\xb0\x8d\xf0\x0b\x1f\x1b\x80\xf8\x30\xef\xa5\x2a\x63\xa3\xc7\xc5\x0f\xa9\xff\x0b\xb0\xc7\x76\x38\xc8\x03\x00\x00")
+
+func data_sync_gw_load_balancer_sidekick_service_template_bytes() ([]byte, error) {
+	return bindata_read(
+		_data_sync_gw_load_balancer_sidekick_service_template,
+		"data/sync_gw_load_balancer_sidekick.service.template",
+	)
+}
+
+func data_sync_gw_load_balancer_sidekick_service_template() (*asset, error) {
+	bytes, err := data_sync_gw_load_balancer_sidekick_service_template_bytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "data/couchbase_sidekick@.service.template", size: 858, mode: os.FileMode(420), modTime: time.Unix(1426775948, 0)}
+	info := bindata_file_info{name: "data/sync_gw_load_balancer_sidekick.service.template", size: 968, mode: os.FileMode(420), modTime: time.Unix(1792390949, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
 
-var _data_nginx_service = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x84\x91\x4f\x6b\xeb\x30\x10\xc4\xef\xfa\x14\x0b\xe1\xf1\x2e\x4f\xcf\x81\x5e\x42\xc1\x87\x42\x93\x5b\xff\x90\x50\x28\x84\x1c\x14\x79\x1d\x2f\xb1\x57\xae\xb4\x8a\xf3\xf1\x2b\xc5\x09\xa1\xc9\xa1\x47\x0d\x3f\x66\x47\x33\xeb\x0f\x26\xd9\xa8\x67\x0c\xd6\x53\x2f\xe4\xb8\x7c\xdd\x11\x1f\x61\x85\xfe\x40\x16\xd5\x53\x2d\xe8\x4b\xeb\xb8\xae\xfe\x87\xb3\xa6\x26\x03\xc2\xe0\xf8\xaf\xc0\x60\x58\x80\x04\xc4\x81\xc7\xaf\x48\x1e\x41\x1a\x84\x33\x09\x3a\xbd\x4c\xa2\x5c\x6c\x2b\x08\xe2\x7a\x88\x21\x81\x41\x8c\x17\xe2\x9d\x9a\x90\xfc\x83\xa1\x21\xdb\x00\x05\x08\xa6\x46\x35\x59\x8e\x3e\xe1\xf6\xe8\xfa\x1c\x69\xa3\xe6\x7c\x20\xef\xb8\x43\x96\x05\xb5\x58\x16\x28\xb6\xc0\xab\xa8\xe6\x47\xb4\xab\x7c\xe3\xdd\x63\xa9\x8b\x18\x7c\xb1\x25\x2e\x2a\x67\xf7\xe8\x61\x4f\x6d\x0b\x7f\xf8\x17\xca\x77\x77\xcc\x2d\xd2\xc7\x64\xc4\xb9\xae\x2b\x77\x07\xf9\xc8\xa0\x35\x9b\x0e\x93\x1f\xe8\x1e\x66\xd3\xc7\xd9\x34\x49\x07\xd7\xc6\x0e\x83\xae\xbd\xeb\x4e\x7f\xd5\x95\x11\xf3\xc3\xcf\xf5\x77\x76\xa7\x12\xb5\xc0\x43\x4e\xb7\x1c\x9b\x2c\x1d\xeb\xda\x50\x1b\x7d\xae\xe9\x53\x2f\x5a\xc4\x34\x6a\x5e\x89\x11\xab\x3c\xce\x16\xc1\xf1\x38\x4d\x4e\xd2\x19\xdb\x10\x23\x98\x00\xa7\x96\xd3\x61\xf5\x32\x6a\x6f\x75\x79\x91\x2e\xdd\x7f\x07\x00\x00\xff\xff\xfa\x80\xca\x3a\x25\x02\x00\x00")
+var _data_sync_gw_nginx_conf_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x7d\x53\xdb\x6e\xdb\x30\x0c\x7d\xf7\x57\x10\x48\x80\xbe\x2c\xce\xad\xbb\x25\xe8\x43\x31\x74\x5d\x81\x5d\x82\x26\x05\xf6\x26\x28\x16\x6d\x0b\x93\x25\x43\x92\xeb\x78\x41\xff\x7d\x94\x1d\x67\x69\xb0\x45\x06\x6c\x9a\x22\x0f\x8f\x0e\xa9\x01\xdc\xa3\x46\xcb\x3d\x0a\xd8\x36\xe0\x1a\x9d\x8c\xb2\x7a\x94\xa8\xca\x79\xb4\xa0\x0c\x17\xa3\x2d\x57\x5c\x27\xf4\x97\x5a\x53\x80\xcf\x11\x94\x7c\x46\x58\x53\x2c\xdc\x53\x66\xcd\x9b\x68\x00\xda\x08\x74\x20\x35\xa0\x4f\x44\x0c\x70\xab\x1b\x48\x72\xae\x33\xf2\xd6\x52\x29\xd8\x22\x98\x67\xb4\xb5\x95\xde\xa3\x8e\xa3\xa8\xe0\x25\x0c\x73\xef\x4b\x56\x95\x99\xe5\x02\x61\x98\x18\xad\x31\xf1\xd2\xe8\xa3\x6f\x1f\x01\x2d\x81\x29\xaf\x94\x87\x83\x77\xd9\x3a\xaf\xae\xa0\x5d\x89\x32\x8e\x5c\x2f\x51\x54\x95\xce\x5b\xe4\x45\x7b\x10\x96\x75\xe4\x08\x62\xbf\x1f\x81\x0d\x5c\x20\x7e\x5a\xad\x37\x8f\x77\xb7\xdf\xd6\xf0\xf2\xd2\xa2\x38\xb4\x44\x0b\xf6\x7b\x88\x1f\x4a\x72\x2e\x82\xb5\x32\xd6\x93\x0d\x05\xdf\xb1\x94\x4b\xe5\x6e\xe6\x10\xbe\xcc\xcb\x02\x4d\xe5\x6f\xa6\x13\xb7\x6c\x61\x51\x39\xec\xa1\x82\x0a\x9d\x38\xa1\x3e\xf4\xf5\x5b\x69\x4e\x6b\x4d\x67\xef\xe3\x09\x3d\xd3\xc5\xf5\xc7\x0f\xd7\x20\x4c\xad\x0f\x60\x5a\x04\x2c\x3a\x49\xcf\xaa\x4d\x53\x92\xba\xa1\x5b\x8a\x5f\x1f\xd6\x9b\xbb\xef\x6c\xf5\xe3\x71\x43\x91\x9d\x0e\x89\x92\xa8\x3d\x0b\x5c\xb7\x46\x34\xcc\xc9\xdf\x08\xb3\x49\xb1\x8c\xba\x6c\x93\xf0\x20\x29\x8c\x0f\x70\x61\x95\xd6\xec\x1a\x56\x72\xe7\x20\xb4\x60\x31\x1e\x9f\x4a\xb6\x3c\x8b\xd3\xb8\xf3\xec\x28\x2e\x5a\x6b\x2c\x1c\x94\x68\xd3\xd9\xdb\xc9\xac\x37\xe6\x87\xb2\x7f\xb3\x1d\x7a\x96\x23\xb5\xcd\xc2\x17\xe3\x3c\x35\x9d\xde\xcb\xff\x07\xfd\x1c\x7d\x36\xb6\xe6\x56\xa0\x08\x16\x0c\xbb\x08\x2e\x04\xa3\x6e\xf4\x5b\xc1\x3a\x29\x35\x80\x1a\xb7\xce\x24\xbf\xd0\x03\xeb\x07\x2f\x45\x14\xee\xac\x50\x4b\x93\xb4\x75\x41\x92\x69\x3c\xbd\x40\xe4\xa9\x9f\xcb\xd3\x29\xbd\x10\xff\xe9\x38\xbe\xff\x1a\xe5\x57\x64\x95\xd1\x59\x69\xe8\x5a\xbc\xe6\x0a\x09\xd7\xe1\xa6\xe4\xa8\x04\x98\x92\x9a\x4e\xa7\xa4\xb1\x21\xbe\x5c\x41\x21\x75\xe5\xd1\xbd\x39\xc1\xe1\x34\x31\x54\xca\xd3\x8e\xa9\x7a\x10\x4d\x6f\xf0\x26\x00\x75\x2d\xa3\x5f\xba\xe3\x39\x51\xf4\x79\x28\x50\xa5\x29\x5a\x14\x67\x27\xa1\x48\xd1\x0f\x38\xcc\xdf\x85\x09\x3f\x3f\xaa\xbe\x1c\xd0\x01\x4b\x9d\x81\x49\xd3\x6e\x33\x4c\xf3\x1f\x83\xba\x49\x86\x66\x04\x00\x00")
 
-func data_nginx_service_bytes() ([]byte, error) {
+func data_sync_gw_nginx_conf_template_bytes() ([]byte, error) {
 	return bindata_read(
-		_data_nginx_service,
-		"data/nginx.service",
+		_data_sync_gw_nginx_conf_template,
+		"data/sync_gw_nginx.conf.template",
 	)
 }
 
-func data_nginx_service() (*asset, error) {
-	bytes, err := data_nginx_service_bytes()
+func data_sync_gw_nginx_conf_template() (*asset, error) {
+	bytes, err := data_sync_gw_nginx_conf_template_bytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "data/nginx.service", size: 549, mode: os.FileMode(420), modTime: time.Unix(1427465946, 0)}
+	info := bindata_file_info{name: "data/sync_gw_nginx.conf.template", size: 1126, mode: os.FileMode(420), modTime: time.Unix(1792390949, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
 
-var _data_sync_gw_node_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xac\x53\x51\x6b\xdb\x30\x10\x7e\xd7\xaf\xd0\x5b\x61\x20\x6b\x2f\x7b\x29\xf8\xc1\x74\xe9\x30\x0c\x6f\x24\x0e\x1b\x84\x60\x5c\xf9\x62\x6b\xb5\x25\x4f\x3a\xc5\x0d\xa5\xff\x7d\x72\xdd\x26\x73\x9c\x2d\xd9\xe8\x9b\xf8\xf8\xbe\xbb\xef\x3b\xdd\xad\x96\x4a\xe2\x9a\x7c\x04\x2b\x8c\x6c\x51\x6a\x15\xda\x9d\x12\x59\xd9\x65\x4a\x17\x40\xa2\x0d\x82\x09\x0b\x2d\xee\xc1\x04\x16\xcc\x56\x0a\x20\x73\xf8\xe9\xa4\x01\x7b\x8c\x0f\x64\x40\x51\x4c\xa9\x23\x74\x20\x6e\x6a\x00\x9c\x32\xc7\x30\x59\x2d\x86\xd7\x9a\xa4\xb2\x01\xed\x70\x81\xb9\xc1\x05\x88\xf0\x3d\x99\xa9\xad\x34\x5a\x35\xa0\xf0\x56\xd6\x10\x72\xdf\x85\xc3\x01\x24\xb3\x07\x10\xcf\xfc\xaf\x06\x42\xc6\x9d\x35\xfc\x4e\x2a\x3e\xf8\xa6\xf7\xb2\xae\xe9\x4b\xdc\x33\x54\xd3\x9c\x26\x1e\xf3\x5a\xe7\x4b\x0a\xed\x44\x75\x97\x5b\xe0\xbd\x86\x95\x39\x42\x97\xef\x2e\x10\x62\x0d\xbb\x02\xd4\x07\xd9\x3d\xf0\x7d\x11\x26\x6a\x67\xfd\xbc\x58\xa9\xaf\x1f\x1f\x69\x70\xf3\x25\x49\xa3\x38\x99\xcd\xb3\x34\xfa\x44\x9f\x9e\xfe\x5e\xd7\x38\x45\x19\x53\x80\x61\xa5\x2d\xfe\x5f\x07\xea\xda\xc2\x67\x60\x9d\xc9\xdb\xd6\xd7\x9c\x08\x69\xaf\xfa\x16\xc5\x69\xb6\x4c\xd2\xf8\x73\x36\x5f\x26\x49\x9c\xfc\xb3\x39\xb6\xa5\xbc\xd2\x0d\x78\x67\x06\xae\x0f\xcf\xb7\x71\x3d\xfc\x45\xc7\x84\x56\x1b\x59\x52\x03\x9d\x91\x08\xbe\x7f\x01\x16\xa5\xca\xfb\xe5\xff\xad\x3f\x0f\xc6\x82\xe0\x87\xd5\xea\x10\x27\x7c\xce\xe1\x7d\x54\x94\x09\x7a\xf5\x87\x64\x79\x03\xaf\x7b\x73\x51\xd0\xd3\x9b\x73\xce\xd5\xd5\x8b\x2d\xdd\x4e\x26\x6c\x3d\xb8\xdf\x5c\xb2\xfa\xce\x6e\xfb\xeb\x5a\x93\x1b\xaf\xae\xa5\x40\x3b\x3a\xf7\x77\xaf\x67\xf7\x2b\x00\x00\xff\xff\xfe\xa2\xd3\xef\x17\x04\x00\x00")
+var _data_sync_gw_node_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xad\x54\x51\x4f\xdb\x30\x10\x7e\xcf\xaf\xb0\x78\x41\x42\x72\xb2\x17\x5e\x90\xf2\x60\xa5\xa1\x8b\x46\xc2\xd4\xa4\x62\x53\x55\x59\xc6\xb9\x26\x86\xc4\xce\x6c\xa7\x01\x21\xfe\xfb\x9c\x96\xd1\x95\x32\x95\x4d\x7b\xf2\xe9\xf4\xdd\xdd\xf7\x9d\x3f\x7b\x31\x97\xc2\x2e\xbd\x09\x18\xae\x45\x67\x85\x92\xa1\x79\x94\x9c\x56\x03\x95\xaa\x04\x8f\xac\x2c\xe8\xb0\x54\xfc\x1e\xb4\x6f\x40\xaf\x05\x07\x6f\x06\x3f\x7a\xa1\xc1\xbc\xcd\x6f\xc1\x60\x79\x79\x08\xdd\xcb\x6e\x81\xab\x06\xc0\x1e\x22\xf7\xd3\xde\x22\xdf\x46\x4b\xaf\x10\x2d\xa8\xde\xe6\x96\x69\x9b\x03\x0f\x3f\x79\xb1\x5c\x0b\xad\x64\x0b\xd2\x5e\x8a\x06\xc2\xc0\x4d\x09\x60\x97\xf4\xe2\x07\xe0\x1b\xfc\x57\x0d\x21\x0e\x7a\xa3\x83\x5b\x21\x83\x2d\x6f\x74\x2f\x9a\x06\xbd\xc8\x3d\x02\xd5\xed\xfb\xc0\xb7\xb8\xae\x77\x2d\x9f\x9e\x90\x9f\x7f\xcf\x22\x3a\xbd\xa1\x49\x4a\xa6\x31\x7a\x7e\xfe\x40\x99\x6d\xe0\xb1\x04\x79\x2e\x86\x87\x80\xab\x9e\xd7\xb7\xcc\x00\xe6\x4d\x6f\xdc\xb6\x70\xa5\x2e\xc6\xbe\xd1\x75\x56\x90\x24\x8b\x67\xb4\x20\xd3\xa3\x7d\x75\x2f\x11\xc6\x12\x6c\x58\x2b\x63\xff\x6d\x02\xea\xbb\x92\x59\xc0\x83\x66\x5d\xe7\x7a\x1e\x14\x6e\xf4\xde\x90\xa4\xa0\xf3\xac\x48\xae\xe8\x6c\x9e\x65\x49\xf6\xd7\xe4\xf0\x1a\x05\xb5\x6a\xc1\x31\xd3\x70\xb1\x0b\xff\x0f\xeb\xf1\xf6\x70\x35\x60\xae\xe4\x4a\x54\x48\xc3\xa0\x85\x05\x37\xbf\x04\x63\x85\x64\xa3\xf5\x7f\x9b\x1f\xf8\xfb\x05\xfe\x9d\x51\x72\x27\x27\xdc\xe8\x70\x3c\x6a\x84\x39\x3a\xfd\x83\x32\xd6\xc2\x2f\xd7\x7c\x48\xa8\xd3\xb1\x66\x1a\x9d\x4c\xae\xa3\x2f\x4e\x88\xdb\x23\x25\xb3\x69\x7e\x32\xca\x79\xcf\x53\xc7\xf8\x9e\xbe\x10\x56\xdd\xc1\xee\x8d\x4b\xbe\x3a\xda\x5b\x7c\xc3\x97\xe3\xab\x5b\x7a\x91\xab\x6e\x04\xb7\x66\xef\x1b\x38\x7b\x7d\x8e\x8e\x86\x66\xb2\x02\xe4\xa7\x24\xfa\xec\xf6\x4d\xd3\xb8\x20\x13\x52\x10\xc7\x27\x65\xbc\x16\x12\x52\xb0\xcc\xed\x9e\x85\x23\xe7\xd1\x05\xee\x04\x59\xba\xe8\x27\xff\x44\x3d\x2b\x6e\x04\x00\x00")
 
 func data_sync_gw_node_service_template_bytes() ([]byte, error) {
 	return bindata_read(
@@ -176,7 +196,27 @@ func data_sync_gw_node_service_template() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "data/sync_gw_node@.service.template", size: 1047, mode: os.FileMode(420), modTime: time.Unix(1432768089, 0)}
+	info := bindata_file_info{name: "data/sync_gw_node@.service.template", size: 1134, mode: os.FileMode(420), modTime: time.Unix(1792391922, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _data_sync_gw_proxy_service_template = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9d\x50\xdd\x6a\xc2\x30\x14\xbe\xcf\x53\xe4\x05\x62\x07\x63\x37\x83\x5c\x94\xad\x1b\xc2\x50\x69\xbb\x2b\x91\x52\xd3\xa3\x06\xd3\x24\x3b\x49\x6c\x45\x7c\xf7\x55\x3b\x11\x2d\x78\xb1\xbb\xe4\xe3\xfb\x3d\xf3\x6f\x2d\xfd\x82\xbc\x83\x13\x28\xad\x97\x46\x73\xb7\xd7\xa2\x58\x37\x85\x45\xd3\xee\x49\xbc\xf2\x80\xbc\x32\x62\x0b\x38\x72\x80\x3b\x29\x80\xa4\xf0\x13\x24\x82\xbb\xc7\x7b\x32\x78\x51\x0d\xa9\x37\x28\x99\x67\xfd\x6b\x41\x72\x59\x83\x09\x3e\xf3\x25\xfa\x0c\x04\x7f\x22\x89\xde\x49\x34\xba\x06\xed\x3f\xa4\x02\x1e\x75\xd2\x08\xae\x20\x49\x5a\x10\x67\xfe\x0c\x81\xb3\x28\x38\x8c\x96\x52\x47\x7d\x19\xba\x95\x4a\xd1\xd3\x08\xb6\x6e\x58\x3f\xe2\xb1\x00\xeb\x47\xf4\x7b\xb6\x0d\x9d\xbd\x57\xb0\xaf\x40\xbf\xc8\xa6\x8d\x84\x09\x62\xb3\x2c\x1d\x30\xa1\x82\xeb\x0e\xc0\xd6\xe6\xf5\x70\xa0\xa3\xb7\xe9\x24\x8f\xc7\x93\x24\x2d\xf2\xf8\x93\x1e\x8f\x57\xdf\x81\x29\x06\x4d\x19\xd3\x65\x0d\xb7\x55\x4e\x20\x78\xbe\x31\xce\xff\x2f\x93\x06\x5b\x95\x1e\x58\x83\xa5\xb5\x5d\xd0\xc5\xfd\x4f\x46\x2f\x29\x4a\x76\x5f\xcd\xcf\x1e\x5f\xe3\x2c\x4f\x26\xc5\x6c\x9a\xe6\xd7\xd6\xc6\x0e\x4a\xbb\x0e\xa4\xcc\xd3\xe7\xbb\xf3\xa5\xe0\xce\x23\x8d\x66\xab\x52\xaa\x80\x40\x7e\x01\x5c\x02\x0d\xe0\x67\x02\x00\x00")
+
+func data_sync_gw_proxy_service_template_bytes() ([]byte, error) {
+	return bindata_read(
+		_data_sync_gw_proxy_service_template,
+		"data/sync_gw_proxy.service.template",
+	)
+}
+
+func data_sync_gw_proxy_service_template() (*asset, error) {
+	bytes, err := data_sync_gw_proxy_service_template_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "data/sync_gw_proxy.service.template", size: 615, mode: os.FileMode(420), modTime: time.Unix(1792395053, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
@@ -262,12 +302,14 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"data/confd.service": data_confd_service,
-	"data/confdata.service": data_confdata_service,
 	"data/couchbase_node@.service.template": data_couchbase_node_service_template,
 	"data/couchbase_sidekick@.service.template": data_couchbase_sidekick_service_template,
-	"data/nginx.service": data_nginx_service,
+	"data/sync_gw_haproxy.cfg.template": data_sync_gw_haproxy_cfg_template,
+	"data/sync_gw_load_balancer.service.template": data_sync_gw_load_balancer_service_template,
+	"data/sync_gw_load_balancer_sidekick.service.template": data_sync_gw_load_balancer_sidekick_service_template,
+	"data/sync_gw_nginx.conf.template": data_sync_gw_nginx_conf_template,
 	"data/sync_gw_node@.service.template": data_sync_gw_node_service_template,
+	"data/sync_gw_proxy.service.template": data_sync_gw_proxy_service_template,
 	"data/sync_gw_sidekick@.service.template": data_sync_gw_sidekick_service_template,
 	"data-test/fleet_api_units.json": data_test_fleet_api_units_json,
 }
@@ -313,18 +355,22 @@ type _bintree_t struct {
 }
 var _bintree = &_bintree_t{nil, map[string]*_bintree_t{
 	"data": &_bintree_t{nil, map[string]*_bintree_t{
-		"confd.service": &_bintree_t{data_confd_service, map[string]*_bintree_t{
-		}},
-		"confdata.service": &_bintree_t{data_confdata_service, map[string]*_bintree_t{
-		}},
 		"couchbase_node@.service.template": &_bintree_t{data_couchbase_node_service_template, map[string]*_bintree_t{
 		}},
 		"couchbase_sidekick@.service.template": &_bintree_t{data_couchbase_sidekick_service_template, map[string]*_bintree_t{
 		}},
-		"nginx.service": &_bintree_t{data_nginx_service, map[string]*_bintree_t{
+		"sync_gw_haproxy.cfg.template": &_bintree_t{data_sync_gw_haproxy_cfg_template, map[string]*_bintree_t{
+		}},
+		"sync_gw_load_balancer.service.template": &_bintree_t{data_sync_gw_load_balancer_service_template, map[string]*_bintree_t{
+		}},
+		"sync_gw_load_balancer_sidekick.service.template": &_bintree_t{data_sync_gw_load_balancer_sidekick_service_template, map[string]*_bintree_t{
+		}},
+		"sync_gw_nginx.conf.template": &_bintree_t{data_sync_gw_nginx_conf_template, map[string]*_bintree_t{
 		}},
 		"sync_gw_node@.service.template": &_bintree_t{data_sync_gw_node_service_template, map[string]*_bintree_t{
 		}},
+		"sync_gw_proxy.service.template": &_bintree_t{data_sync_gw_proxy_service_template, map[string]*_bintree_t{
+		}},
 		"sync_gw_sidekick@.service.template": &_bintree_t{data_sync_gw_sidekick_service_template, map[string]*_bintree_t{
 		}},
 	}},
@@ -150,6 +150,23 @@ func ExtractStringArg(docOptParsed map[string]interface{}, argToExtract string)
 
 }
 
+// Extract an option that can be given multiple times, eg [--foo=<bar>...]
+func ExtractStringListArg(docOptParsed map[string]interface{}, argToExtract string) ([]string, error) {
+
+	rawVal, found := docOptParsed[argToExtract]
+	if !found || rawVal == nil {
+		return []string{}, nil
+	}
+
+	stringListVal, ok := rawVal.([]string)
+	if !ok {
+		return nil, fmt.Errorf("Invalid type for %v", argToExtract)
+	}
+
+	return stringListVal, nil
+
+}
+
 func ExtractBoolArg(docOptParsed map[string]interface{}, argToExtract string) bool {
 
 	rawVal, found := docOptParsed[argToExtract]
@@ -172,8 +189,121 @@ func ExtractSkipCheckCleanState(docOptParsed map[string]interface{}) bool {
 
 }
 
+// Extract --template-dir and the --template-var values
+func ExtractUnitTemplates(docOptParsed map[string]interface{}) (UnitTemplates, error) {
+
+	templates := UnitTemplates{}
+	templates.Dir, _ = ExtractStringArg(docOptParsed, "--template-dir")
+
+	rawTemplateVars, err := ExtractStringListArg(docOptParsed, "--template-var")
+	if err != nil {
+		return templates, err
+	}
+	templates.Vars, err = parseTemplateVars(rawTemplateVars)
+	if err != nil {
+		return templates, err
+	}
+
+	return templates, templates.Validate()
+
+}
+
+// Extract the --machine-metadata values, --spread-by and --server-groups
+func ExtractMachinePlacement(docOptParsed map[string]interface{}) (MachinePlacement, error) {
+
+	rawMetadata, err := ExtractStringListArg(docOptParsed, "--machine-metadata")
+	if err != nil {
+		return MachinePlacement{}, err
+	}
+	spreadBy, _ := ExtractStringArg(docOptParsed, "--spread-by")
+
+	placement, err := ParseMachinePlacement(rawMetadata, spreadBy)
+	if err != nil {
+		return placement, err
+	}
+
+	placement.ServerGroups = ExtractBoolArg(docOptParsed, "--server-groups")
+	if placement.ServerGroups && placement.SpreadBy == "" {
+		return placement, fmt.Errorf("--server-groups requires --spread-by, which gives the zone of each node")
+	}
+
+	return placement, nil
+
+}
+
 func ExtractNumNodes(docOptParsed map[string]interface{}) (int, error) {
 
 	return ExtractIntArg(docOptParsed, "--num-nodes")
 
 }
+
+// Extract the --services arg, returning an empty slice if it wasn't given
+func ExtractServices(docOptParsed map[string]interface{}) ([]string, error) {
+
+	rawServices, _ := ExtractStringArg(docOptParsed, "--services")
+	if rawServices == "" {
+		return []string{}, nil
+	}
+
+	return ParseServices(rawServices)
+
+}
+
+// Extract the --memory-quota-policy arg, falling back to the default policy
+func ExtractQuotaPolicy(docOptParsed map[string]interface{}) (QuotaPolicy, error) {
+
+	rawPolicy, _ := ExtractStringArg(docOptParsed, "--memory-quota-policy")
+	if rawPolicy == "" {
+		return DefaultQuotaPolicy(), nil
+	}
+
+	return ParseQuotaPolicy(rawPolicy)
+
+}
+
+// Extract the --memory-quotas arg, returning an empty map if it wasn't given
+func ExtractMemoryQuotas(docOptParsed map[string]interface{}) (map[string]int, error) {
+
+	rawQuotas, _ := ExtractStringArg(docOptParsed, "--memory-quotas")
+	if rawQuotas == "" {
+		return map[string]int{}, nil
+	}
+
+	return ParseMemoryQuotas(rawQuotas)
+
+}
+
+// Extract the --reload-* options.  defaultSignal is used if --reload-signal
+// isn't given.
+func ExtractReloadHook(docOptParsed map[string]interface{}, defaultSignal string) (SyncGwReloadHook, error) {
+
+	hook := SyncGwReloadHook{}
+
+	hook.Command, _ = ExtractStringArg(docOptParsed, "--reload-command")
+	hook.Pid, _ = ExtractStringArg(docOptParsed, "--reload-pid")
+	hook.Container, _ = ExtractStringArg(docOptParsed, "--reload-container")
+	hook.AdminUrl, _ = ExtractStringArg(docOptParsed, "--reload-admin-url")
+
+	numHooks := 0
+	for _, value := range []string{hook.Command, hook.Pid, hook.Container, hook.AdminUrl} {
+		if value != "" {
+			numHooks += 1
+		}
+	}
+	if numHooks > 1 {
+		return hook, fmt.Errorf("Only one of --reload-command, --reload-pid, --reload-container or --reload-admin-url can be given")
+	}
+
+	signalName, _ := ExtractStringArg(docOptParsed, "--reload-signal")
+	if signalName == "" {
+		signalName = defaultSignal
+	}
+	signal, err := ParseSignal(signalName)
+	if err != nil {
+		return hook, err
+	}
+	hook.Signal = signal
+
+	return hook, nil
+
+}
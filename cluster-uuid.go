@@ -0,0 +1,157 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+)
+
+const (
+	// the uuid of the couchbase cluster that this etcd belongs to, recorded
+	// by the node that bootstraps it.  Nodes only join live nodes that
+	// report the same uuid.
+	KEY_CLUSTER_UUID = "/couchbase.com/cluster-uuid"
+)
+
+// The cluster uuid recorded in etcd, or empty if there isn't one, eg a
+// cluster bootstrapped before it was recorded
+func (c CouchbaseCluster) RecordedClusterUuid() (string, error) {
+
+	response, err := c.etcdClient.Get(KEY_CLUSTER_UUID, false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return response.Node.Value, nil
+
+}
+
+// Record the local node's cluster uuid, from the bootstrap node.  If etcd
+// already has a different one, it's residue from an earlier cluster that
+// a freshly initialized node replaces, but a node that came back with data
+// from another cluster must not take over this etcd.
+func (c CouchbaseCluster) RecordClusterUuid(freshlyInitialized bool) error {
+
+	localUuid, err := c.ClusterUuid(c.LocalCouchbaseIp)
+	if err != nil {
+		return err
+	}
+	if localUuid == "" {
+		return fmt.Errorf("Node %v has no cluster uuid after initializing it", c.LocalCouchbaseIp)
+	}
+
+	recordedUuid, err := c.RecordedClusterUuid()
+	if err != nil {
+		return err
+	}
+
+	if recordedUuid != "" && recordedUuid != localUuid {
+		if !freshlyInitialized {
+			return fmt.Errorf("Node %v has existing data from cluster %v, but etcd is for cluster %v.  "+
+				"If cluster %v no longer exists, delete %v from etcd and try again",
+				c.LocalCouchbaseIp, localUuid, recordedUuid, recordedUuid, KEY_CLUSTER_UUID)
+		}
+		log.Printf("Replacing cluster uuid %v in etcd, left over from an earlier cluster", recordedUuid)
+	}
+
+	log.Printf("Recording cluster uuid %v in etcd", localUuid)
+	_, err = c.etcdClient.Set(KEY_CLUSTER_UUID, localUuid, TTL_NONE)
+	return err
+
+}
+
+// Make sure that the node at nodeIp is in the cluster recorded in etcd, so
+// that stale node state or a shared etcd can't lead to joining some other
+// cluster.  There's nothing to verify against if no uuid is recorded.
+func (c CouchbaseCluster) VerifyClusterUuid(nodeIp string) error {
+
+	recordedUuid, err := c.RecordedClusterUuid()
+	if err != nil {
+		return err
+	}
+	if recordedUuid == "" {
+		return nil
+	}
+
+	nodeUuid, err := c.ClusterUuid(nodeIp)
+	if err != nil {
+		return err
+	}
+
+	if nodeUuid != recordedUuid {
+		return fmt.Errorf("Node %v is in cluster %v, but etcd is for cluster %v", nodeIp, nodeUuid, recordedUuid)
+	}
+
+	return nil
+
+}
+
+// Print the nodes in etcd, flagging any whose cluster uuid disagrees with
+// the one recorded in etcd
+func (c CouchbaseCluster) PrintStatus(w io.Writer) error {
+
+	recordedUuid, err := c.RecordedClusterUuid()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.etcdClient.Get(KEY_NODE_STATE, false, false)
+	if err != nil {
+		return fmt.Errorf("Error getting key: %v.  Err: %v", KEY_NODE_STATE, err)
+	}
+
+	if recordedUuid == "" {
+		fmt.Fprintf(w, "Cluster uuid: unknown\n")
+	} else {
+		fmt.Fprintf(w, "Cluster uuid: %v\n", recordedUuid)
+	}
+
+	fmt.Fprintf(w, "Nodes: %v\n", len(response.Node.Nodes))
+
+	for _, subNode := range response.Node.Nodes {
+
+		_, subNodeIp := path.Split(subNode.Key)
+
+		nodeState := NodeState{}
+		if err := json.Unmarshal([]byte(subNode.Value), &nodeState); err != nil {
+			fmt.Fprintf(w, "  %v invalid node state: %v\n", subNodeIp, err)
+			continue
+		}
+
+		fmt.Fprintf(w, "  %v\n", formatNodeStatus(nodeState, recordedUuid))
+
+	}
+
+	return nil
+
+}
+
+func formatNodeStatus(nodeState NodeState, recordedUuid string) string {
+
+	fields := []string{fmt.Sprintf("%v:%v", nodeState.Ip, nodeState.Port)}
+	if len(nodeState.Services) > 0 {
+		fields = append(fields, fmt.Sprintf("services=%v", strings.Join(nodeState.Services, ",")))
+	}
+	if nodeState.Zone != "" {
+		fields = append(fields, fmt.Sprintf("zone=%v", nodeState.Zone))
+	}
+	if nodeState.ClusterUuid != "" {
+		fields = append(fields, fmt.Sprintf("cluster=%v", nodeState.ClusterUuid))
+	}
+	if clusterUuidDisagrees(nodeState, recordedUuid) {
+		fields = append(fields, "WRONG CLUSTER")
+	}
+
+	return strings.Join(fields, " ")
+
+}
+
+func clusterUuidDisagrees(nodeState NodeState, recordedUuid string) bool {
+	return recordedUuid != "" && nodeState.ClusterUuid != "" && nodeState.ClusterUuid != recordedUuid
+}
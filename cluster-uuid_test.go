@@ -0,0 +1,26 @@
+package cbcluster
+
+import (
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestFormatNodeStatus(t *testing.T) {
+
+	nodeState := NodeState{
+		Ip:          "10.0.0.1",
+		Port:        "8091",
+		Services:    []string{"data", "index"},
+		Zone:        "us-east-1a",
+		ClusterUuid: "2a8f4b1e",
+	}
+
+	assert.Equals(t, formatNodeStatus(nodeState, "2a8f4b1e"), "10.0.0.1:8091 services=data,index zone=us-east-1a cluster=2a8f4b1e")
+	assert.Equals(t, formatNodeStatus(nodeState, "77c0d3aa"), "10.0.0.1:8091 services=data,index zone=us-east-1a cluster=2a8f4b1e WRONG CLUSTER")
+
+	// nothing to compare against
+	assert.False(t, clusterUuidDisagrees(nodeState, ""))
+	assert.False(t, clusterUuidDisagrees(NodeState{Ip: "10.0.0.2"}, "2a8f4b1e"))
+
+}
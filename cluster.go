@@ -1,18 +1,15 @@
 package cbcluster
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
-	"os/exec"
 	"path"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 
 	"github.com/tleyden/go-etcd/etcd"
 )
@@ -36,6 +33,9 @@ const (
 	DEFAULT_BUCKET_REPLICA_NUMBER = "0"
 
 	DEFAULT_CB_PORT = "8091"
+
+	BUCKET_TYPE_COUCHBASE = "couchbase"
+	BUCKET_TYPE_MEMCACHED = "memcached"
 )
 
 type CouchbaseCluster struct {
@@ -47,6 +47,19 @@ type CouchbaseCluster struct {
 	defaultBucketRamQuotaMB    string
 	defaultBucketReplicaNumber string
 	EtcdServers                []string
+	Services                   []string       // services to run on this node, eg "data", "index"
+	MemoryQuotasMB             map[string]int // explicit per-service memory quotas
+	MemoryQuotaPolicy          QuotaPolicy    // how much of the node's memory to hand to couchbase
+	Zone                       string         // availability zone, which becomes the node's server group
+}
+
+// The record that each node publishes into etcd under KEY_NODE_STATE
+type NodeState struct {
+	Ip          string   `json:"ip"`
+	Port        string   `json:"port"`
+	Services    []string `json:"services,omitempty"`
+	Zone        string   `json:"zone,omitempty"`
+	ClusterUuid string   `json:"cluster_uuid,omitempty"`
 }
 
 type AdminCredentials struct {
@@ -56,6 +69,7 @@ type AdminCredentials struct {
 
 type bucketParams struct {
 	Name          string
+	BucketType    string // couchbase, memcached or ephemeral.  Defaults to couchbase if empty.
 	RamQuotaMB    string
 	AuthType      string
 	ReplicaNumber string
@@ -68,6 +82,7 @@ func NewCouchbaseCluster(etcdServers []string) *CouchbaseCluster {
 
 	c.defaultBucketRamQuotaMB = DEFAULT_BUCKET_RAM_MB
 	c.defaultBucketReplicaNumber = DEFAULT_BUCKET_REPLICA_NUMBER
+	c.MemoryQuotaPolicy = DefaultQuotaPolicy()
 
 	if len(etcdServers) > 0 {
 		c.EtcdServers = etcdServers
@@ -112,12 +127,25 @@ func (c *CouchbaseCluster) StartCouchbaseSidekick() error {
 	case true:
 		log.Printf("We became first cluster node, init cluster and bucket")
 
+		isPasswordSet, err := c.IsClusterPasswordSet()
+		if err != nil {
+			return err
+		}
 		if err := c.ClusterInit(); err != nil {
 			return err
 		}
+		if err := c.RecordClusterUuid(!isPasswordSet); err != nil {
+			return err
+		}
+		if err := c.JoinServerGroup(c.LocalCouchbaseIp); err != nil {
+			return err
+		}
 		if err := c.CreateDefaultBucket(); err != nil {
 			return err
 		}
+		if err := c.CreateRbacUsersFromEtcd(); err != nil {
+			return err
+		}
 	case false:
 		if err := c.JoinExistingCluster(); err != nil {
 			return err
@@ -256,6 +284,37 @@ func (c CouchbaseCluster) FindLiveNode() (string, error) {
 
 }
 
+// Like FindLiveNode, but return all the nodes in etcd that have
+// a reachable REST service rather than just the first one.
+func (c CouchbaseCluster) FindLiveNodes() ([]string, error) {
+
+	liveNodeIps := []string{}
+
+	response, err := c.etcdClient.Get(KEY_NODE_STATE, false, false)
+	if err != nil {
+		return liveNodeIps, fmt.Errorf("Error getting key.  Err: %v", err)
+	}
+
+	if response.Node == nil {
+		return liveNodeIps, nil
+	}
+
+	for _, subNode := range response.Node.Nodes {
+
+		_, subNodeIp := path.Split(subNode.Key)
+
+		if !verifyRestService(subNodeIp, DEFAULT_CB_PORT) {
+			log.Printf("Could not connect to REST service on %v, skipping", subNodeIp)
+			continue
+		}
+
+		liveNodeIps = append(liveNodeIps, subNodeIp)
+	}
+
+	return liveNodeIps, nil
+
+}
+
 func (c *CouchbaseCluster) FetchClusterDetails() error {
 
 	for i := 0; i < MAX_RETRIES_JOIN_CLUSTER; i++ {
@@ -362,17 +421,56 @@ func (c CouchbaseCluster) ClusterInit() error {
 		return err
 	}
 	if isPasswordSet {
-		log.Printf("Cluster password was previously set, skipping rest of ClusterInit()")
+		// the node came back with its data, so it's the cluster it was in before
+		clusterUuid, _ := c.ClusterUuid(c.LocalCouchbaseIp)
+		log.Printf("Cluster password was previously set (cluster %v), skipping rest of ClusterInit()", clusterUuid)
 		return nil
 	}
 
-	if err := c.ClusterSetPassword(); err != nil {
+	version, err := c.CouchbaseVersion()
+	if err != nil {
 		return err
 	}
 
-	if err := c.SetClusterRam(); err != nil {
+	// check up front, rather than leaving a half initialized node
+	if err := version.VerifyServices(c.Services); err != nil {
 		return err
 	}
+	for service := range c.MemoryQuotasMB {
+		if service == SERVICE_DATA {
+			continue // memoryQuota, which every version has
+		}
+		if err := version.VerifyServices([]string{service}); err != nil {
+			return err
+		}
+	}
+
+	// couchbase rejects setupServices once the node is provisioned, and
+	// setting the password is what provisions it, so that has to go last
+	if err := c.ClusterSetupServices(); err != nil {
+		return err
+	}
+
+	if version.Supports(CAPABILITY_MEMORY_QUOTA) {
+		if err := c.SetClusterRam(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.ClusterSetPassword(); err != nil {
+		return err
+	}
+
+	// the storage mode is cluster wide, and has to be set before any index
+	// node joins, whether or not this node runs the index service
+	if version.Supports(CAPABILITY_INDEX_STORAGE_MODE) {
+		storageMode := version.IndexStorageMode()
+		if storageMode == "" {
+			log.Printf("Warning: unknown edition of couchbase server %v, not setting the index storage mode", version.Raw)
+		} else if err := c.SetIndexStorageMode(storageMode); err != nil {
+			return err
+		}
+	}
 
 	return nil
 
@@ -409,86 +507,98 @@ func (c CouchbaseCluster) CouchbaseMajorVersion() (int, error) {
 		return -1, fmt.Errorf("c.localcouchbaseversion is empty ")
 	}
 
-	firstCharVerion, _ := utf8.DecodeRuneInString(c.LocalCouchbaseVersion)
-	majorVersion, err := strconv.Atoi(fmt.Sprintf("%v", firstCharVerion))
+	version, err := ParseCouchbaseVersion(c.LocalCouchbaseVersion)
 	if err != nil {
 		return -1, err
 	}
 
-	return majorVersion, nil
+	return version.Major, nil
 
 }
 
-// in Couchbase 3, we need to also set the cluster ram setting
+// in Couchbase 3, we need to also set the cluster ram setting.  The cluster
+// ram is split up between the services, each of which gets its own quota.
 // See http://docs.couchbase.com/admin/admin/REST/rest-node-provisioning.html
 func (c CouchbaseCluster) SetClusterRam() error {
 
-	ramMb, err := CalculateClusterRam()
+	ramMb, err := CalculateClusterRam(c.MemoryQuotaPolicy)
 	if err != nil {
 		log.Printf("Warning, failed to calculate cluster ram: %v.  Default to 1024 MB", err)
-		ramMb = "1024"
+		ramMb = 1024
 	}
 
 	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default", c.LocalCouchbaseIp, c.LocalCouchbasePort)
 
-	data := url.Values{
-		"memoryQuota": {ramMb},
+	quotas := calculateMemoryQuotas(ramMb, c.Services, c.MemoryQuotasMB)
+	if totalQuotaMb := sumMemoryQuotas(quotas); totalQuotaMb > ramMb {
+		log.Printf("Warning, service quotas add up to %v MB, which is more than "+
+			"the %v MB cluster ram allowed by the quota policy", totalQuotaMb, ramMb)
 	}
+	data := memoryQuotaParams(quotas)
 
-	log.Printf("Attempting to set cluster ram to: %v MB", ramMb)
+	log.Printf("Attempting to set cluster ram to: %v MB, quotas: %v", ramMb, quotas)
 
-	return c.POST(false, endpointUrl, data)
+	// called before the password is set, like ClusterSetPassword
+	return c.POST(true, endpointUrl, data)
 
 }
 
-func CalculateClusterRam() (string, error) {
+// The storage mode for the index service, which has to be set before any
+// indexes can be created.
+// See http://developer.couchbase.com/documentation/server/4.5/rest-api/rest-index-service.html
+func (c CouchbaseCluster) SetIndexStorageMode(storageMode string) error {
 
-	totalRamMb, err := CalculateTotalRam()
-	if err != nil {
-		return "", err
+	log.Printf("SetIndexStorageMode(): %v", storageMode)
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/settings/indexes", c.LocalCouchbaseIp, c.LocalCouchbasePort)
+
+	data := url.Values{
+		"storageMode": {storageMode},
 	}
-	log.Printf("Total RAM (MB) on machine: %v", totalRamMb)
-	clusterRam := (totalRamMb * 75) / 100
-	return fmt.Sprintf("%v", clusterRam), nil
+
+	return c.POST(false, endpointUrl, data)
 
 }
 
-func CalculateTotalRam() (int, error) {
+// Tell the local node which services to run.  Only needed if the user asked
+// for specific services, otherwise the node will run the default set.
+// See http://developer.couchbase.com/documentation/server/4.0/rest-api/rest-node-provisioning.html
+func (c CouchbaseCluster) ClusterSetupServices() error {
 
-	cmd := exec.Command(
-		"free",
-		"-m",
-	)
-
-	output, err := cmd.Output()
-	if err != nil {
-		return -1, err
+	if len(c.Services) == 0 {
+		return nil
 	}
 
-	// The returned output will look something like this:
-	//              total       used       free     shared    buffers     cached
-	// Mem:          3768       2601       1166          0          4       1877
-	// -/+ buffers/cache:        720       3048
-	// Swap:            0          0          0
+	log.Printf("ClusterSetupServices(): %v", c.Services)
 
-	re := regexp.MustCompile(`Mem:[ ]*[0-9]*`)
-	memPair := re.FindString(string(output)) // ie, "Mem: 3768"
-	if memPair == "" {
-		return -1, fmt.Errorf("Could not extract Mem total from %v", output)
-	}
-	if !strings.Contains(memPair, ":") {
-		return -1, fmt.Errorf("Could not extract Mem total from %v, no :", output)
+	endpointUrl := fmt.Sprintf("http://%v:%v/node/controller/setupServices", c.LocalCouchbaseIp, c.LocalCouchbasePort)
+
+	data := url.Values{
+		"services": {restServicesParam(c.Services)},
 	}
-	memPairs := strings.Split(memPair, ":")
 
-	outputTrimmed := strings.TrimSpace(memPairs[1])
+	// called before the password is set, like ClusterSetPassword
+	return c.POST(true, endpointUrl, data)
 
-	i, err := strconv.Atoi(outputTrimmed)
+}
+
+// Calculate how much ram to give couchbase server, based on the memory
+// available to this node (respecting any container limits) and the policy.
+func CalculateClusterRam(policy QuotaPolicy) (int, error) {
+
+	memoryInfo, err := DetectMemory()
 	if err != nil {
 		return -1, err
 	}
+	log.Printf("Total RAM (MB) available: %v (source: %v)", memoryInfo.TotalMB, memoryInfo.Source)
 
-	return i, nil
+	clusterRam, err := policy.ClusterRamMB(memoryInfo.TotalMB)
+	if err != nil {
+		return -1, err
+	}
+	log.Printf("Cluster RAM (MB) using quota policy %v: %v", policy, clusterRam)
+
+	return clusterRam, nil
 
 }
 
@@ -511,11 +621,18 @@ func (c CouchbaseCluster) CreateBucket(params bucketParams) error {
 // In order to workaround "proxyPort":"port is already in use" errors from
 // the REST API (I don't understand why I'm getting this when there aren't
 // any buckets on the node), start at proxy port 11215 and keep looping
-// until we find one that works.
+// until we find one that works.  Couchbase 5 and later reject authType and
+// proxyPort, since access is controlled by RBAC users instead.
 func (c CouchbaseCluster) CreateBucketWithRetries(params bucketParams) error {
 
 	log.Printf("CreateBucketWithRetries(): %+v", params)
 
+	version, err := c.CouchbaseVersion()
+	if err != nil {
+		return err
+	}
+	legacyAuth := version.Supports(CAPABILITY_BUCKET_PROXY_PORT)
+
 	maxAttempts := 25
 	sleepSeconds := 0
 	proxyPort := 11215
@@ -523,11 +640,19 @@ func (c CouchbaseCluster) CreateBucketWithRetries(params bucketParams) error {
 	worker := func() (finished bool, err error) {
 
 		data := url.Values{
-			"name":          {params.Name},
-			"ramQuotaMB":    {params.RamQuotaMB},
-			"authType":      {params.AuthType},
-			"replicaNumber": {params.ReplicaNumber},
-			"proxyPort":     {fmt.Sprintf("%v", proxyPort)},
+			"name":       {params.Name},
+			"ramQuotaMB": {params.RamQuotaMB},
+		}
+		if params.BucketType != "" {
+			data.Set("bucketType", params.BucketType)
+		}
+		// memcached buckets don't have replicas
+		if params.BucketType != BUCKET_TYPE_MEMCACHED {
+			data.Set("replicaNumber", params.ReplicaNumber)
+		}
+		if legacyAuth {
+			data.Set("authType", params.AuthType)
+			data.Set("proxyPort", fmt.Sprintf("%v", proxyPort))
 		}
 
 		endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/buckets", c.LocalCouchbaseIp, c.LocalCouchbasePort)
@@ -561,6 +686,54 @@ func (c CouchbaseCluster) CreateBucketWithRetries(params bucketParams) error {
 
 }
 
+// Wait until the bucket is ready on every node, since it can't be used
+// right after it's created
+func (c CouchbaseCluster) WaitUntilBucketReady(liveNodeIp, bucketName string) error {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/buckets/%v", liveNodeIp, c.LocalCouchbasePort, bucketName)
+
+	maxAttempts := 30
+	sleepSeconds := 5
+
+	worker := func() (finished bool, err error) {
+
+		bucket := struct {
+			Nodes []struct {
+				Hostname string `json:"hostname"`
+				Status   string `json:"status"`
+			} `json:"nodes"`
+		}{}
+		if err := c.getJsonData(endpointUrl, &bucket); err != nil {
+			log.Printf("Bucket %v not found yet, will retry.  err: %v", bucketName, err)
+			return false, nil
+		}
+
+		if len(bucket.Nodes) == 0 {
+			log.Printf("Bucket %v is not on any nodes yet, will retry", bucketName)
+			return false, nil
+		}
+		for _, node := range bucket.Nodes {
+			if node.Status != "healthy" {
+				log.Printf("Bucket %v is %v on %v, will retry", bucketName, node.Status, node.Hostname)
+				return false, nil
+			}
+		}
+
+		return true, nil
+
+	}
+
+	sleeper := func(numAttempts int) (bool, int) {
+		if numAttempts > maxAttempts {
+			return false, -1
+		}
+		return true, sleepSeconds
+	}
+
+	return RetryLoop(worker, sleeper)
+
+}
+
 func (c CouchbaseCluster) HasDefaultBucket() (bool, error) {
 
 	log.Printf("HasDefaultBucket()")
@@ -596,12 +769,49 @@ func (c CouchbaseCluster) HasDefaultBucket() (bool, error) {
 
 }
 
+// Get the names of all the buckets in the cluster.  Connect to liveNodeIp.
+func (c CouchbaseCluster) GetBucketNames(liveNodeIp string) ([]string, error) {
+
+	endpointUrl := fmt.Sprintf(
+		"http://%v:%v/pools/default/buckets",
+		liveNodeIp,
+		c.LocalCouchbasePort,
+	)
+
+	buckets := []struct {
+		Name string `json:"name"`
+	}{}
+	if err := c.getJsonData(endpointUrl, &buckets); err != nil {
+		return nil, err
+	}
+
+	bucketNames := []string{}
+	for _, bucket := range buckets {
+		bucketNames = append(bucketNames, bucket.Name)
+	}
+
+	return bucketNames, nil
+
+}
+
 func (c CouchbaseCluster) JoinLiveNode(liveNodeIp string) error {
 
 	log.Printf("JoinLiveNode() called with %v", liveNodeIp)
 
-	err := c.WaitUntilInClusterAndHealthy(liveNodeIp)
+	if err := c.VerifyClusterUuid(liveNodeIp); err != nil {
+		return fmt.Errorf("Refusing to join live node: %v", err)
+	}
+
+	rejoining, err := c.IsRejoiningCluster(liveNodeIp)
 	if err != nil {
+		return err
+	}
+
+	if rejoining {
+		if err := c.RejoinCluster(liveNodeIp); err != nil {
+			return err
+		}
+	} else if err := c.WaitUntilInClusterAndHealthy(liveNodeIp); err != nil {
 		log.Printf("WaitUntilInClusterAndHealthy() returned error: %v.  Call AddNodeRetry()", err)
 		if err := c.AddNodeRetry(liveNodeIp); err != nil {
 			return err
@@ -611,6 +821,12 @@ func (c CouchbaseCluster) JoinLiveNode(liveNodeIp string) error {
 		log.Printf("WaitUntilInClusterAndHealthy() done.  Node is in cluster and healthy")
 	}
 
+	// usually a no-op, since AddNode puts the node in its group, but nodes
+	// that were already in the cluster may be in a different one
+	if err := c.JoinServerGroup(liveNodeIp); err != nil {
+		return err
+	}
+
 	if err := c.WaitUntilNoRebalanceRunning(liveNodeIp, 5); err != nil {
 		return err
 	}
@@ -897,12 +1113,33 @@ func (c CouchbaseCluster) AddNode(liveNodeIp string) error {
 
 	endpointUrl := fmt.Sprintf("http://%v:%v/controller/addNode", liveNodeIp, liveNodePort)
 
+	// add the node straight into the server group for its zone, so
+	// that it's never in the default group when the rebalance starts
+	if c.Zone != "" {
+		group, err := c.EnsureServerGroup(liveNodeIp, c.Zone)
+		if err != nil {
+			return err
+		}
+		endpointUrl = fmt.Sprintf("http://%v:%v%v", liveNodeIp, liveNodePort, group.AddNodeUri)
+	}
+
 	data := url.Values{
 		"hostname": {c.LocalCouchbaseIp},
 		"user":     {c.AdminUsername},
 		"password": {c.AdminPassword},
 	}
 
+	if len(c.Services) > 0 {
+		version, err := c.CouchbaseVersion()
+		if err != nil {
+			return err
+		}
+		if err := version.VerifyServices(c.Services); err != nil {
+			return err
+		}
+		data.Set("services", restServicesParam(c.Services))
+	}
+
 	log.Printf("AddNode posting to %v with data: %v", endpointUrl, data.Encode())
 
 	err := c.POST(false, endpointUrl, data)
@@ -1092,6 +1329,12 @@ func (c CouchbaseCluster) EventLoop() {
 			}
 		}
 
+		// flag it if this node is in a different cluster than the one in
+		// etcd, eg because it was pointed at the wrong etcd
+		if err := c.VerifyClusterUuid(c.LocalCouchbaseIp); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+
 		// sleep for a while
 		<-time.After(time.Second * time.Duration(KEY_NODE_STATE_TTL/2))
 
@@ -1105,9 +1348,27 @@ func (c CouchbaseCluster) PublishNodeStateEtcd(ttlSeconds uint64) error {
 	// the etcd key to use, ie: /couchbase-node-state/<our ip>
 	// TODO: maybe this should be ip:port
 	key := path.Join(KEY_NODE_STATE, c.LocalCouchbaseIp)
+
+	// not knowing the cluster uuid shouldn't stop the node being found
+	clusterUuid, err := c.ClusterUuid(c.LocalCouchbaseIp)
+	if err != nil {
+		log.Printf("Unable to get cluster uuid: %v", err)
+	}
+
 	// TODO: don't hardcode port
-	ipAndPort := fmt.Sprintf("%v:8091", c.LocalCouchbaseIp)
-	_, err := c.etcdClient.Set(key, ipAndPort, ttlSeconds)
+	nodeState := NodeState{
+		Ip:          c.LocalCouchbaseIp,
+		Port:        DEFAULT_CB_PORT,
+		Services:    c.Services,
+		Zone:        c.Zone,
+		ClusterUuid: clusterUuid,
+	}
+	nodeStateJson, err := json.Marshal(nodeState)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(key, string(nodeStateJson), ttlSeconds)
 
 	return err
 
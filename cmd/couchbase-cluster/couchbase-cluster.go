@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"strings"
 
 	"github.com/docopt/docopt-go"
 	"github.com/tleyden/couchbase-cluster-go"
@@ -16,9 +17,22 @@ func main() {
 
 Usage:
   couchbase-cluster wait-until-running [--etcd-servers=<server-list>] 
-  couchbase-cluster start-couchbase-sidekick (--local-ip=<ip>|--discover-local-ip) [--etcd-servers=<server-list>|--k8s-service-name=<svc>] 
+  couchbase-cluster start-couchbase-sidekick (--local-ip=<ip>|--discover-local-ip) [--etcd-servers=<server-list>|--k8s-service-name=<svc>] [--services=<services>] [--memory-quotas=<quotas>] [--memory-quota-policy=<policy>] [--zone=<zone>]
   couchbase-cluster remove-and-rebalance --local-ip=<ip> [--etcd-servers=<server-list>] 
   couchbase-cluster get-live-node-ip [--etcd-servers=<server-list>] 
+  couchbase-cluster server-groups [--etcd-servers=<server-list>]
+  couchbase-cluster status [--etcd-servers=<server-list>]
+  couchbase-cluster xdcr add-remote --remote-name=<name> (--remote-host=<host>|--remote-etcd-servers=<server-list>) [--remote-userpass=<user:pass>] [--etcd-servers=<server-list>]
+  couchbase-cluster xdcr replicate --remote-name=<name> --bucket=<bucket> [--remote-bucket=<bucket>] [--etcd-servers=<server-list>]
+  couchbase-cluster xdcr list [--etcd-servers=<server-list>]
+  couchbase-cluster xdcr pause --remote-name=<name> [--bucket=<bucket>] [--etcd-servers=<server-list>]
+  couchbase-cluster xdcr resume --remote-name=<name> [--bucket=<bucket>] [--etcd-servers=<server-list>]
+  couchbase-cluster xdcr delete --remote-name=<name> [--bucket=<bucket>] [--etcd-servers=<server-list>]
+  couchbase-cluster backup --backup-dir=<dir> [--buckets=<buckets>] [--cbbackup-path=<path>] [--etcd-servers=<server-list>]
+  couchbase-cluster restore --backup-dir=<dir> [--buckets=<buckets>] [--cbrestore-path=<path>] [--etcd-servers=<server-list>]
+  couchbase-cluster users create --username=<name> --roles=<roles> [--password=<password>] [--full-name=<full-name>] [--etcd-servers=<server-list>]
+  couchbase-cluster users list [--etcd-servers=<server-list>]
+  couchbase-cluster users delete --username=<name> [--etcd-servers=<server-list>]
   couchbase-cluster -h | --help
 
 Options:
@@ -26,6 +40,24 @@ Options:
   --etcd-servers=<server-list>  Comma separated list of etcd servers, or omit to connect to etcd running on localhost
   --k8s-service-name=<svc> Discover etcd server from Environment variable (TODO: document variable(s))
   --local-ip=<ip> the ip address (no port) to publish in etcd
+  --services=<services> comma separated list of services to run on this node: data, index, query, fts, eventing, analytics.  Defaults to the services couchbase server runs by default.
+  --memory-quotas=<quotas> comma separated list of per-service memory quotas in MB, eg: data:1024,index:512.  The data service gets the remaining cluster ram if not given.
+  --memory-quota-policy=<policy> how much of the node's memory (respecting container limits) to give couchbase server: a percentage (75%), an absolute value in MB (2048), a reserve for the OS (reserve:1024), or a percentage plus a reserve (80%,reserve:512).  Defaults to 75%.
+  --zone=<zone> the availability zone this node runs in.  The node is added to a couchbase server group with this name, which is created if needed, so that replicas are kept in other zones.
+  --remote-name=<name> the name of the remote cluster to replicate to
+  --remote-host=<host> the address of any node in the remote cluster, eg 10.1.0.5 or 10.1.0.5:8091
+  --remote-etcd-servers=<server-list> comma separated list of the etcd servers of a remote cluster launched with couchbase-fleet, to find a live node and the credentials from.  Each cluster needs its own etcd, there are no namespaces within one.
+  --remote-userpass=<user:pass> the credentials of the remote cluster.  Required with --remote-host, otherwise taken from the remote etcd.
+  --bucket=<bucket> the bucket to replicate.  For pause, resume and delete, defaults to all buckets replicated to the remote, and delete then removes the remote cluster as well.
+  --remote-bucket=<bucket> the bucket to replicate into on the remote cluster.  Defaults to the same name as --bucket.
+  --username=<name> the username of a couchbase server (5.0 and later) user.  Creating an existing user replaces its password and roles.
+  --roles=<roles> comma separated list of roles, with the bucket in brackets for bucket roles, eg: bucket_full_access[default],query_select[*]
+  --password=<password> the user's password, required for new users
+  --full-name=<full-name> the user's full name
+  --buckets=<buckets> comma separated list of the buckets to back up or restore.  Defaults to all buckets.
+  --backup-dir=<dir> the local directory to back up to, which must not already contain a backup, or to restore from
+  --cbbackup-path=<path> the cbbackup binary, which ships with couchbase server in /opt/couchbase/bin.  Defaults to cbbackup on the PATH.
+  --cbrestore-path=<path> the cbrestore binary.  Defaults to cbrestore on the PATH.
 `
 
 	arguments, _ := docopt.Parse(usage, nil, true, "Couchbase-Cluster", false)
@@ -60,7 +92,7 @@ Options:
 
 		}
 
-		startCouchbaseSidekick(etcdServers, localIp)
+		startCouchbaseSidekick(etcdServers, localIp, arguments)
 		return
 	}
 
@@ -86,6 +118,42 @@ Options:
 		return
 	}
 
+	if cbcluster.IsCommandEnabled(arguments, "server-groups") {
+		if err := printServerGroups(etcdServers); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "status") {
+		couchbaseCluster := cbcluster.NewCouchbaseCluster(etcdServers)
+		if err := couchbaseCluster.PrintStatus(os.Stdout); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "xdcr") {
+		if err := xdcr(etcdServers, arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "users") {
+		if err := users(etcdServers, arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "backup") || cbcluster.IsCommandEnabled(arguments, "restore") {
+		if err := backupOrRestore(etcdServers, arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
 	log.Fatalf("Nothing to do!")
 
 }
@@ -103,10 +171,31 @@ func initCluster(etcdServers []string, localIp string) *cbcluster.CouchbaseClust
 
 }
 
-func startCouchbaseSidekick(etcdServers []string, localIp string) {
+func startCouchbaseSidekick(etcdServers []string, localIp string, arguments map[string]interface{}) {
 
 	couchbaseCluster := initCluster(etcdServers, localIp)
 
+	services, err := cbcluster.ExtractServices(arguments)
+	if err != nil {
+		log.Fatal(err)
+	}
+	couchbaseCluster.Services = services
+
+	memoryQuotas, err := cbcluster.ExtractMemoryQuotas(arguments)
+	if err != nil {
+		log.Fatal(err)
+	}
+	couchbaseCluster.MemoryQuotasMB = memoryQuotas
+
+	quotaPolicy, err := cbcluster.ExtractQuotaPolicy(arguments)
+	if err != nil {
+		log.Fatal(err)
+	}
+	couchbaseCluster.MemoryQuotaPolicy = quotaPolicy
+
+	zone, _ := cbcluster.ExtractStringArg(arguments, "--zone")
+	couchbaseCluster.Zone = zone
+
 	if err := couchbaseCluster.StartCouchbaseSidekick(); err != nil {
 		log.Fatal(err)
 	}
@@ -142,3 +231,131 @@ func discoverLocalIp() (localIp string, err error) {
 	return "", fmt.Errorf("Could not find localip")
 
 }
+
+func printServerGroups(etcdServers []string) error {
+
+	couchbaseCluster := cbcluster.NewCouchbaseCluster(etcdServers)
+	if err := couchbaseCluster.LoadAdminCredsFromEtcd(); err != nil {
+		return err
+	}
+
+	return couchbaseCluster.PrintServerGroups(os.Stdout)
+
+}
+
+func xdcr(etcdServers []string, arguments map[string]interface{}) error {
+
+	couchbaseCluster := cbcluster.NewCouchbaseCluster(etcdServers)
+	if err := couchbaseCluster.LoadAdminCredsFromEtcd(); err != nil {
+		return err
+	}
+
+	remoteName, _ := cbcluster.ExtractStringArg(arguments, "--remote-name")
+	bucket, _ := cbcluster.ExtractStringArg(arguments, "--bucket")
+
+	switch {
+	case cbcluster.IsCommandEnabled(arguments, "add-remote"):
+		remoteHost, _ := cbcluster.ExtractStringArg(arguments, "--remote-host")
+		remoteUserPass, _ := cbcluster.ExtractStringArg(arguments, "--remote-userpass")
+		remoteEtcdServers := []string{}
+		if rawRemoteEtcdServers, _ := cbcluster.ExtractStringArg(arguments, "--remote-etcd-servers"); rawRemoteEtcdServers != "" {
+			remoteEtcdServers = strings.Split(rawRemoteEtcdServers, ",")
+		}
+		remote, err := cbcluster.ResolveXdcrRemote(remoteName, remoteHost, remoteEtcdServers, remoteUserPass)
+		if err != nil {
+			return err
+		}
+		return couchbaseCluster.AddXdcrRemote(remote)
+	case cbcluster.IsCommandEnabled(arguments, "replicate"):
+		remoteBucket, _ := cbcluster.ExtractStringArg(arguments, "--remote-bucket")
+		return couchbaseCluster.CreateXdcrReplication(remoteName, bucket, remoteBucket)
+	case cbcluster.IsCommandEnabled(arguments, "list"):
+		return couchbaseCluster.PrintXdcr(os.Stdout)
+	case cbcluster.IsCommandEnabled(arguments, "pause"):
+		return couchbaseCluster.PauseXdcrReplications(remoteName, bucket, true)
+	case cbcluster.IsCommandEnabled(arguments, "resume"):
+		return couchbaseCluster.PauseXdcrReplications(remoteName, bucket, false)
+	case cbcluster.IsCommandEnabled(arguments, "delete"):
+		return couchbaseCluster.DeleteXdcr(remoteName, bucket)
+	}
+
+	return fmt.Errorf("Unknown xdcr command")
+
+}
+
+func backupOrRestore(etcdServers []string, arguments map[string]interface{}) error {
+
+	couchbaseCluster := cbcluster.NewCouchbaseCluster(etcdServers)
+	if err := couchbaseCluster.LoadAdminCredsFromEtcd(); err != nil {
+		return err
+	}
+
+	backupDir, _ := cbcluster.ExtractStringArg(arguments, "--backup-dir")
+	bucketNames := []string{}
+	if rawBucketNames, _ := cbcluster.ExtractStringArg(arguments, "--buckets"); rawBucketNames != "" {
+		bucketNames = strings.Split(rawBucketNames, ",")
+	}
+
+	tools := cbcluster.DefaultBackupTools()
+	if cbBackupPath, _ := cbcluster.ExtractStringArg(arguments, "--cbbackup-path"); cbBackupPath != "" {
+		tools.CbBackupPath = cbBackupPath
+	}
+	if cbRestorePath, _ := cbcluster.ExtractStringArg(arguments, "--cbrestore-path"); cbRestorePath != "" {
+		tools.CbRestorePath = cbRestorePath
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "backup") {
+		return couchbaseCluster.Backup(backupDir, bucketNames, tools)
+	}
+	return couchbaseCluster.Restore(backupDir, bucketNames, tools)
+
+}
+
+func users(etcdServers []string, arguments map[string]interface{}) error {
+
+	couchbaseCluster := cbcluster.NewCouchbaseCluster(etcdServers)
+	if err := couchbaseCluster.LoadAdminCredsFromEtcd(); err != nil {
+		return err
+	}
+
+	liveNodeIp, err := couchbaseCluster.FindLiveNode()
+	if err != nil {
+		return err
+	}
+	couchbaseCluster.LocalCouchbaseIp = liveNodeIp
+
+	supportsRbac, err := couchbaseCluster.SupportsRbac()
+	if err != nil {
+		return err
+	}
+	if !supportsRbac {
+		return fmt.Errorf("Couchbase server %v doesn't support users, they need 5.0 or later", couchbaseCluster.LocalCouchbaseVersion)
+	}
+
+	username, _ := cbcluster.ExtractStringArg(arguments, "--username")
+
+	switch {
+	case cbcluster.IsCommandEnabled(arguments, "create"):
+		rawRoles, _ := cbcluster.ExtractStringArg(arguments, "--roles")
+		roles, err := cbcluster.ParseRbacRoles(rawRoles)
+		if err != nil {
+			return err
+		}
+		password, _ := cbcluster.ExtractStringArg(arguments, "--password")
+		fullName, _ := cbcluster.ExtractStringArg(arguments, "--full-name")
+		user := cbcluster.RbacUser{
+			Username: username,
+			Name:     fullName,
+			Password: password,
+			Roles:    roles,
+		}
+		return couchbaseCluster.UpsertRbacUser(liveNodeIp, user)
+	case cbcluster.IsCommandEnabled(arguments, "list"):
+		return couchbaseCluster.PrintRbacUsers(os.Stdout, liveNodeIp)
+	case cbcluster.IsCommandEnabled(arguments, "delete"):
+		return couchbaseCluster.DeleteRbacUser(liveNodeIp, username)
+	}
+
+	return fmt.Errorf("Unknown users command")
+
+}
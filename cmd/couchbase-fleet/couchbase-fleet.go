@@ -12,14 +12,16 @@ func main() {
 	usage := `Couchbase-Fleet.
 
 Usage:
-  couchbase-fleet launch-cbs --version=<cb-version> --num-nodes=<num_nodes> --userpass=<user:pass> [--edition=<edition>] [--etcd-servers=<server-list>] [--docker-tag=<dt>] [--skip-clean-slate-check]
+  couchbase-fleet launch-cbs --version=<cb-version> --num-nodes=<num_nodes> --userpass=<user:pass> [--edition=<edition>] [--etcd-servers=<server-list>] [--docker-tag=<dt>] [--skip-clean-slate-check] [--services=<services>] [--unit-services=<unit-services>...] [--memory-quotas=<quotas>] [--memory-quota-policy=<policy>] [--template-dir=<dir>] [--template-var=<name=value>...] [--dry-run] [--machine-metadata=<key=value>...] [--spread-by=<key>] [--server-groups]
+  couchbase-fleet upgrade --version=<cb-version> [--edition=<edition>] [--etcd-servers=<server-list>] [--docker-tag=<dt>] [--template-dir=<dir>] [--template-var=<name=value>...] [--machine-metadata=<key=value>...] [--spread-by=<key>] [--server-groups]
   couchbase-fleet stop [--all-units] [--etcd-servers=<server-list>]
   couchbase-fleet destroy [--all-units] [--etcd-servers=<server-list>]
-  couchbase-fleet generate-units --version=<cb-version> --num-nodes=<num_nodes> --userpass=<user:pass> [--etcd-servers=<server-list>] [--docker-tag=<dt>] --output-dir=<output_dir>
+  couchbase-fleet generate-units --version=<cb-version> --num-nodes=<num_nodes> --userpass=<user:pass> [--etcd-servers=<server-list>] [--docker-tag=<dt>] [--services=<services>] [--unit-services=<unit-services>...] [--memory-quotas=<quotas>] [--memory-quota-policy=<policy>] [--template-dir=<dir>] [--template-var=<name=value>...] [--machine-metadata=<key=value>...] [--spread-by=<key>] [--server-groups] --output-dir=<output_dir>
   couchbase-fleet -h | --help
 
 Options:
   -h --help     Show this screen.
+  --dry-run  print the plan (etcd keys, units, machine constraints and buckets) without changing anything
   --version=<cb-version> Couchbase Server version (examples: latest, 3.0.3, 2.2).  The list of supported version corresponds to available tags on dockerhub: https://hub.docker.com/u/couchbase/server 
   --num-nodes=<num_nodes> number of couchbase nodes to start
   --userpass=<user:pass> the username and password as a single string, delimited by a colon (:)
@@ -27,6 +29,15 @@ Options:
   --etcd-servers=<server-list>  Comma separated list of etcd servers, or omit to connect to etcd running on localhost
   --docker-tag=<dt>  if present, use this docker tag for spawned containers, otherwise, default to "latest"
   --skip-clean-slate-check  if present, will skip the check that we are starting from clean state
+  --services=<services> comma separated list of services to run on each node: data, index, query, fts, eventing, analytics.  Defaults to the services couchbase server runs by default.
+  --unit-services=<unit-services> override the services for a single unit, eg: 3:index,query.  Can be given multiple times.
+  --memory-quotas=<quotas> comma separated list of per-service memory quotas in MB, eg: data:1024,index:512
+  --memory-quota-policy=<policy> how much of each node's memory to give couchbase server: a percentage (75%), an absolute value in MB (2048), a reserve for the OS (reserve:1024), or a percentage plus a reserve (80%,reserve:512).  Defaults to 75%.
+  --template-dir=<dir> a directory of unit file templates that override the built in ones with the same name, eg couchbase_node@.service.template
+  --template-var=<name=value> an extra value for the unit file templates, available as {{ var "name" }}.  Can be given multiple times.  The built in templates pass DOCKER_RUN_ARGS to docker run, eg: DOCKER_RUN_ARGS=--memory=4g
+  --machine-metadata=<key=value> only run couchbase server on fleet machines with this metadata, eg role=couchbase.  Can be given multiple times, and giving the same key more than once allows any of the values.
+  --spread-by=<key> spread the couchbase server nodes evenly across the values of this machine metadata key, eg zone
+  --server-groups  put each node in a couchbase server group named after its --spread-by value, so that replicas are kept in a different zone to the active data
   --output-dir=<output_dir>
 
 `
@@ -43,6 +54,13 @@ Options:
 		return
 	}
 
+	if cbcluster.IsCommandEnabled(arguments, "upgrade") {
+		if err := upgradeCouchbaseServer(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
 	if cbcluster.IsCommandEnabled(arguments, "generate-units") {
 		if err := generateUnits(arguments); err != nil {
 			log.Fatalf("Failed: %v", err)
@@ -81,6 +99,35 @@ func launchCouchbaseServer(arguments map[string]interface{}) error {
 
 }
 
+func upgradeCouchbaseServer(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+
+	couchbaseFleet := cbcluster.NewCouchbaseFleet(etcdServers)
+
+	cbVersion, err := cbcluster.ExtractCbVersion(arguments)
+	if err != nil {
+		return err
+	}
+	couchbaseFleet.CbVersion = cbVersion
+	couchbaseFleet.ContainerTag = cbcluster.ExtractDockerTagOrLatest(arguments)
+
+	templates, err := cbcluster.ExtractUnitTemplates(arguments)
+	if err != nil {
+		return err
+	}
+	couchbaseFleet.Templates = templates
+
+	placement, err := cbcluster.ExtractMachinePlacement(arguments)
+	if err != nil {
+		return err
+	}
+	couchbaseFleet.Placement = placement
+
+	return couchbaseFleet.UpgradeCouchbaseServer()
+
+}
+
 func generateUnits(arguments map[string]interface{}) error {
 
 	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/docopt/docopt-go"
 	"github.com/tleyden/couchbase-cluster-go"
@@ -12,20 +16,64 @@ func main() {
 	usage := `Sync-Gw-Cluster:
 
 Usage:
-  sync-gw-cluster launch-sgw --num-nodes=<num_nodes> --config-url=<config_url> [--in-memory-db] [--launch-nginx] [--create-bucket=<bucket-name>] [--create-bucket-size=<bucket-size-mb>] [--create-bucket-replicas=<replica-count>] [--etcd-servers=<server-list>] [--docker-tag=<dt>]
-  sync-gw-cluster launch-sidekick --local-ip=<ip> [--etcd-servers=<server-list>]
+  sync-gw-cluster launch-sgw --num-nodes=<num_nodes> (--config-url=<config_url> | --config-file=<config_file>) [--in-memory-db] [--launch-nginx | --load-balancer=<lb-type>] [--create-bucket=<bucket-name>] [--create-bucket-size=<bucket-size-mb>] [--create-bucket-replicas=<replica-count>] [--sgw-version=<sgw-version>] [--edition=<edition>] [--template-dir=<dir>] [--template-var=<name=value>...] [--etcd-servers=<server-list>] [--docker-tag=<dt>] [--dry-run] [--machine-metadata=<key=value>...] [--spread-by=<key>]
+  sync-gw-cluster stop [--etcd-servers=<server-list>]
+  sync-gw-cluster destroy [--etcd-servers=<server-list>]
+  sync-gw-cluster scale --num-nodes=<num_nodes> [--drain-seconds=<seconds>] [--in-memory-db] [--sgw-version=<sgw-version>] [--edition=<edition>] [--template-dir=<dir>] [--template-var=<name=value>...] [--etcd-servers=<server-list>] [--docker-tag=<dt>] [--machine-metadata=<key=value>...] [--spread-by=<key>]
+  sync-gw-cluster launch-sidekick --local-ip=<ip> [--port=<port>] [--admin-port=<port>] [--etcd-servers=<server-list>]
+  sync-gw-cluster config get [--revision=<rev>] [--etcd-servers=<server-list>]
+  sync-gw-cluster config set (--config-url=<config_url> | --config-file=<config_file>) [--etcd-servers=<server-list>]
+  sync-gw-cluster config history [--etcd-servers=<server-list>]
+  sync-gw-cluster config rollback --revision=<rev> [--etcd-servers=<server-list>]
+  sync-gw-cluster load-balancer render --type=<lb-type> --destination=<config-dest> [--etcd-servers=<server-list>]
+  sync-gw-cluster load-balancer watch --type=<lb-type> --destination=<config-dest> [--reload-command=<cmd> | --reload-pid=<pid> | --reload-container=<name>] [--reload-signal=<signal>] [--etcd-servers=<server-list>]
+  sync-gw-cluster proxy [--listen=<addr>] [--etcd-servers=<server-list>]
+  sync-gw-cluster db list [--node=<ip>] [--etcd-servers=<server-list>]
+  sync-gw-cluster db create --db=<db> --config-file=<config_file> [--node=<ip>] [--etcd-servers=<server-list>]
+  sync-gw-cluster db (offline | online) --db=<db> [--node=<ip>] [--etcd-servers=<server-list>]
+  sync-gw-cluster db resync --db=<db> [--node=<ip>] [--etcd-servers=<server-list>]
+  sync-gw-cluster user add --db=<db> --username=<name> [--password=<password>] [--channels=<channels>] [--roles=<roles>] [--node=<ip>] [--etcd-servers=<server-list>]
+  sync-gw-cluster user list --db=<db> [--node=<ip>] [--etcd-servers=<server-list>]
+  sync-gw-cluster user delete --db=<db> --username=<name> [--node=<ip>] [--etcd-servers=<server-list>]
   sync-gw-cluster -h | --help
 
 Options:
   -h --help     Show this screen.
-  --num-nodes=<num_nodes> number of sync gw nodes to start
-  --config-url=<config_url> the url where the sync gw config json is stored
+  --dry-run  print the plan (etcd keys, units, machine constraints and buckets) without changing anything
+  --num-nodes=<num_nodes> number of sync gw nodes to start, or to scale to
+  --drain-seconds=<seconds> when scaling in, how long to wait for requests to a sync gw to finish before stopping it [default: 30]
+  --sgw-version=<sgw-version> the Sync Gateway version to run, eg 1.1.0.  If omitted, the latest image is pulled.
+  --edition=<edition> the Sync Gateway edition to run, either "enterprise" or "community".  Requires --sgw-version.  Defaults to "community" edition.
+  --template-dir=<dir> a directory of unit file templates that override the built in ones with the same name, eg sync_gw_node@.service.template
+  --template-var=<name=value> an extra value for the unit file templates, available as {{ var "name" }}.  Can be given multiple times.  The built in templates pass DOCKER_RUN_ARGS to docker run, eg: DOCKER_RUN_ARGS=--memory=1g
+  --machine-metadata=<key=value> only run sync gateway on fleet machines with this metadata, eg role=sync-gateway.  Can be given multiple times, and giving the same key more than once allows any of the values.
+  --spread-by=<key> spread the sync gateway nodes evenly across the values of this machine metadata key, eg zone
+  --config-url=<config_url> the url where the sync gw config json is stored.  It is fetched once and stored in etcd.
+  --config-file=<config_file> a local sync gw config json file to store in etcd
+  --launch-nginx  launch an nginx load balancer in front of the sync gateways, same as --load-balancer=nginx
+  --load-balancer=<lb-type> launch a load balancer in front of the sync gateways, either nginx, haproxy or proxy (the built in proxy)
+  --type=<lb-type> the type of load balancer config to generate, either nginx or haproxy
+  --destination=<config-dest> the path where the load balancer config should be written
+  --reload-command=<cmd> shell command to run after the load balancer config is rewritten
+  --reload-pid=<pid> pid (or path to a pid file) of the load balancer process to signal after the config is rewritten
+  --reload-container=<name> name of the docker container running the load balancer, to signal after the config is rewritten
+  --reload-signal=<signal> signal to send to the load balancer, defaults to HUP for nginx and USR2 for haproxy
+  --listen=<addr> the address for the proxy to listen on [default: :80]
+  --node=<ip> the sync gateway node to send admin api requests to, or omit for all of the sync gateways in etcd (db commands) or the first one (user commands)
+  --db=<db> the sync gateway database name
+  --username=<name> the sync gateway user name
+  --password=<password> the password for the sync gateway user
+  --channels=<channels> comma separated list of channels to grant the user
+  --roles=<roles> comma separated list of roles to grant the user
+  --revision=<rev> the revision of the sync gw config stored in etcd, see "config history"
   --create-bucket=<bucket-name> create a bucket on couchbase server with the given name 
   --create-bucket-size=<bucket-size-mb> if creating a bucket, use this size in MB
   --create-bucket-replicas=<replica-count> if creating a bucket, use this replica count (defaults to 1)
   --etcd-servers=<server-list>  Comma separated list of etcd servers, or omit to connect to etcd running on localhost
   --docker-tag=<docker-tag>  if present, use this docker tag for spawned containers, otherwise, default to "latest"
   --local-ip=<ip> the ip address (no port) to publish in etcd
+  --port=<port> the sync gw public port to publish in etcd, or omit to take it from the sync gw config
+  --admin-port=<port> the sync gw admin port to publish in etcd, or omit to take it from the sync gw config
 `
 
 	arguments, err := docopt.Parse(usage, nil, true, "Sync-Gw-Cluster", false)
@@ -40,6 +88,27 @@ Options:
 		return
 	}
 
+	if cbcluster.IsCommandEnabled(arguments, "stop") {
+		if err := stopUnits(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "destroy") {
+		if err := destroyUnits(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "scale") {
+		if err := scale(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
 	if cbcluster.IsCommandEnabled(arguments, "launch-sidekick") {
 		if err := launchSyncGatewaySidekick(arguments); err != nil {
 			log.Fatalf("Failed: %v", err)
@@ -47,6 +116,41 @@ Options:
 		return
 	}
 
+	if cbcluster.IsCommandEnabled(arguments, "config") {
+		if err := manageConfig(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "load-balancer") {
+		if err := loadBalancer(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "proxy") {
+		if err := runProxy(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "db") {
+		if err := manageDatabases(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "user") {
+		if err := manageUsers(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
 	log.Printf("Nothing to do!")
 
 }
@@ -64,6 +168,62 @@ func launchSyncGateway(arguments map[string]interface{}) error {
 
 }
 
+func stopUnits(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	return syncGwCluster.StopUnits()
+
+}
+
+func destroyUnits(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	return syncGwCluster.DestroyUnits()
+
+}
+
+func scale(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	numNodes, err := cbcluster.ExtractNumNodes(arguments)
+	if err != nil {
+		return err
+	}
+	syncGwCluster.NumNodes = numNodes
+	syncGwCluster.ContainerTag = cbcluster.ExtractDockerTagOrLatest(arguments)
+	syncGwCluster.RequiresCouchbaseServer = !cbcluster.ExtractBoolArg(arguments, "--in-memory-db")
+	if err := syncGwCluster.ExtractSyncGwVersion(arguments); err != nil {
+		return err
+	}
+	templates, err := cbcluster.ExtractUnitTemplates(arguments)
+	if err != nil {
+		return err
+	}
+	syncGwCluster.Templates = templates
+	placement, err := cbcluster.ExtractMachinePlacement(arguments)
+	if err != nil {
+		return err
+	}
+	syncGwCluster.Placement = placement
+
+	drainSeconds, err := cbcluster.ExtractIntArg(arguments, "--drain-seconds")
+	if err != nil {
+		drainSeconds = cbcluster.DEFAULT_SYNC_GW_DRAIN_SECONDS
+	}
+
+	return syncGwCluster.Scale(drainSeconds)
+
+}
+
 func launchSyncGatewaySidekick(arguments map[string]interface{}) error {
 
 	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
@@ -75,6 +235,284 @@ func launchSyncGatewaySidekick(arguments map[string]interface{}) error {
 		syncGwCluster.LocalIp = localIp
 	}
 
+	if port, err := cbcluster.ExtractIntArg(arguments, "--port"); err == nil {
+		syncGwCluster.Port = port
+	}
+	if adminPort, err := cbcluster.ExtractIntArg(arguments, "--admin-port"); err == nil {
+		syncGwCluster.AdminPort = adminPort
+	}
+
 	return syncGwCluster.LaunchSyncGatewaySidekick()
 
 }
+
+func manageConfig(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	switch {
+	case cbcluster.IsCommandEnabled(arguments, "get"):
+		return getConfig(syncGwCluster, arguments)
+	case cbcluster.IsCommandEnabled(arguments, "set"):
+		return setConfig(syncGwCluster, arguments)
+	case cbcluster.IsCommandEnabled(arguments, "history"):
+		return configHistory(syncGwCluster)
+	case cbcluster.IsCommandEnabled(arguments, "rollback"):
+		revisionNumber, err := cbcluster.ExtractIntArg(arguments, "--revision")
+		if err != nil {
+			return err
+		}
+		revision, err := syncGwCluster.RollbackSyncGwConfig(revisionNumber)
+		if err != nil {
+			return err
+		}
+		log.Printf("Config revision %v is now current", revision.Revision)
+		return nil
+	}
+
+	return fmt.Errorf("Unknown config command")
+
+}
+
+// Write the config to stdout, so that it can be redirected to a file
+func getConfig(syncGwCluster *cbcluster.SyncGwCluster, arguments map[string]interface{}) error {
+
+	var revision cbcluster.SyncGwConfigRevision
+	var err error
+
+	if revisionNumber, _ := cbcluster.ExtractIntArg(arguments, "--revision"); revisionNumber > 0 {
+		revision, err = syncGwCluster.GetSyncGwConfigRevision(revisionNumber)
+	} else {
+		revision, err = syncGwCluster.CurrentSyncGwConfig()
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Config revision %v from %v", revision.Revision, revision.Source)
+	_, err = fmt.Fprint(os.Stdout, revision.Content)
+	return err
+
+}
+
+func setConfig(syncGwCluster *cbcluster.SyncGwCluster, arguments map[string]interface{}) error {
+
+	configUrl, _ := cbcluster.ExtractStringArg(arguments, "--config-url")
+	configFile, _ := cbcluster.ExtractStringArg(arguments, "--config-file")
+
+	content, source, err := cbcluster.LoadSyncGwConfig(configFile, configUrl)
+	if err != nil {
+		return err
+	}
+
+	revision, err := syncGwCluster.StoreSyncGwConfig(content, source)
+	if err != nil {
+		return err
+	}
+	log.Printf("Config revision %v is now current", revision.Revision)
+	return nil
+
+}
+
+func configHistory(syncGwCluster *cbcluster.SyncGwCluster) error {
+
+	current, err := syncGwCluster.CurrentSyncGwConfig()
+	if err != nil {
+		return err
+	}
+
+	revisions, err := syncGwCluster.SyncGwConfigHistory()
+	if err != nil {
+		return err
+	}
+
+	for _, revision := range revisions {
+		marker := " "
+		if revision.Revision == current.Revision {
+			marker = "*"
+		}
+		fmt.Printf("%v %5d  %v  %6d bytes  %v\n",
+			marker,
+			revision.Revision,
+			revision.Created.Format("2006-01-02 15:04:05"),
+			len(revision.Content),
+			revision.Source,
+		)
+	}
+
+	return nil
+
+}
+
+// Generate the load balancer config from the live sync gateways, either
+// once, or every time they change.
+func loadBalancer(arguments map[string]interface{}) error {
+
+	lbType, err := cbcluster.ExtractStringArg(arguments, "--type")
+	if err != nil {
+		return err
+	}
+	if err := cbcluster.ValidateLoadBalancerType(lbType); err != nil {
+		return err
+	}
+
+	dest, err := cbcluster.ExtractStringArg(arguments, "--destination")
+	if err != nil {
+		return err
+	}
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	if cbcluster.IsCommandEnabled(arguments, "render") {
+		_, err := syncGwCluster.WriteLoadBalancerConfig(lbType, dest)
+		return err
+	}
+
+	reloadHook, err := cbcluster.ExtractReloadHook(arguments, cbcluster.LoadBalancerReloadSignal(lbType))
+	if err != nil {
+		return err
+	}
+
+	syncGwCluster.WatchLoadBalancerConfig(lbType, dest, reloadHook)
+
+	return nil
+
+}
+
+func runProxy(arguments map[string]interface{}) error {
+
+	listenAddr, err := cbcluster.ExtractStringArg(arguments, "--listen")
+	if err != nil {
+		return err
+	}
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	proxy := cbcluster.NewSyncGwProxy(syncGwCluster, listenAddr)
+	return proxy.ListenAndServe()
+
+}
+
+// Database commands apply to every sync gateway node, since each node has
+// its own copy of the database config and online/offline state.
+func manageDatabases(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	nodeIp, _ := cbcluster.ExtractStringArg(arguments, "--node")
+	clients, err := syncGwCluster.SyncGwAdminClients(nodeIp)
+	if err != nil {
+		return err
+	}
+
+	db, _ := cbcluster.ExtractStringArg(arguments, "--db")
+
+	if cbcluster.IsCommandEnabled(arguments, "list") {
+		for _, client := range clients {
+			databases, err := client.ListDatabases()
+			if err != nil {
+				return err
+			}
+			for _, database := range databases {
+				info, err := client.GetDatabase(database)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%v\t%v\t%v\n", client.AdminUrl, database, info["state"])
+			}
+		}
+		return nil
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "resync") {
+		changes, err := cbcluster.ResyncDatabase(clients, db)
+		if err != nil {
+			return err
+		}
+		log.Printf("Resync of %v changed %v documents", db, changes)
+		return nil
+	}
+
+	var config []byte
+	if cbcluster.IsCommandEnabled(arguments, "create") {
+		configFile, _ := cbcluster.ExtractStringArg(arguments, "--config-file")
+		config, err = ioutil.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, client := range clients {
+
+		switch {
+		case cbcluster.IsCommandEnabled(arguments, "create"):
+			log.Printf("Creating %v on %v", db, client.AdminUrl)
+			err = client.CreateDatabase(db, config)
+		case cbcluster.IsCommandEnabled(arguments, "offline"):
+			log.Printf("Taking %v offline on %v", db, client.AdminUrl)
+			err = client.TakeDatabaseOffline(db)
+		case cbcluster.IsCommandEnabled(arguments, "online"):
+			log.Printf("Bringing %v online on %v", db, client.AdminUrl)
+			err = client.BringDatabaseOnline(db)
+		}
+		if err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+
+}
+
+// Users are stored in the bucket, so user commands only need to go to a
+// single sync gateway node.
+func manageUsers(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	nodeIp, _ := cbcluster.ExtractStringArg(arguments, "--node")
+	clients, err := syncGwCluster.SyncGwAdminClients(nodeIp)
+	if err != nil {
+		return err
+	}
+	client := clients[0]
+
+	db, _ := cbcluster.ExtractStringArg(arguments, "--db")
+	username, _ := cbcluster.ExtractStringArg(arguments, "--username")
+
+	switch {
+	case cbcluster.IsCommandEnabled(arguments, "add"):
+		user := cbcluster.SyncGwUser{Name: username}
+		user.Password, _ = cbcluster.ExtractStringArg(arguments, "--password")
+		if channels, _ := cbcluster.ExtractStringArg(arguments, "--channels"); channels != "" {
+			user.AdminChannels = strings.Split(channels, ",")
+		}
+		if roles, _ := cbcluster.ExtractStringArg(arguments, "--roles"); roles != "" {
+			user.AdminRoles = strings.Split(roles, ",")
+		}
+		log.Printf("Adding user %v to %v", username, db)
+		return client.PutUser(db, user)
+	case cbcluster.IsCommandEnabled(arguments, "list"):
+		users, err := client.ListUsers(db)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			fmt.Println(user)
+		}
+		return nil
+	case cbcluster.IsCommandEnabled(arguments, "delete"):
+		log.Printf("Deleting user %v from %v", username, db)
+		return client.DeleteUser(db, username)
+	}
+
+	return fmt.Errorf("Unknown user command")
+
+}
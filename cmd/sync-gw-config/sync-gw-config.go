@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"io/ioutil"
 	"log"
+	"os"
 	"regexp"
 
 	"github.com/docopt/docopt-go"
@@ -15,12 +17,20 @@ func main() {
 
 Usage:
   sync-gw-config rewrite --destination=<config-dest> [--etcd-servers=<server-list>]
+  sync-gw-config watch --destination=<config-dest> [--etcd-servers=<server-list>] [--reload-command=<cmd>] [--reload-pid=<pid>] [--reload-container=<name>] [--reload-signal=<signal>] [--reload-admin-url=<url>]
+  sync-gw-config validate [--config-file=<config-file>] [--etcd-servers=<server-list>]
   sync-gw-config -h | --help
 
 Options:
   -h --help     Show this screen.
   --etcd-servers=<server-list>  Comma separated list of etcd servers, or omit to connect to etcd running on localhost
   --destination=<config-dest> The path where the updated config should be written
+  --config-file=<config-file> A local config file to validate, or omit to validate the current config in etcd
+  --reload-command=<cmd> Shell command to run after the config is rewritten, eg "docker restart sync_gw"
+  --reload-pid=<pid> Pid (or path to a pid file) of the Sync Gateway process to signal after the config is rewritten
+  --reload-container=<name> Name of the docker container running Sync Gateway to signal after the config is rewritten
+  --reload-signal=<signal> Signal to send to --reload-pid or --reload-container [default: HUP]
+  --reload-admin-url=<url> Push the rewritten config to the Sync Gateway admin api, eg http://localhost:4985
 `
 
 	arguments, err := docopt.Parse(usage, nil, true, "Sync-Gw-Config", false)
@@ -33,6 +43,20 @@ Options:
 		return
 	}
 
+	if cbcluster.IsCommandEnabled(arguments, "watch") {
+		if err := watchConfig(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
+	if cbcluster.IsCommandEnabled(arguments, "validate") {
+		if err := validateConfig(arguments); err != nil {
+			log.Fatalf("Failed: %v", err)
+		}
+		return
+	}
+
 	log.Printf("Nothing to do!")
 
 }
@@ -55,39 +79,141 @@ func rewriteConfig(arguments map[string]interface{}) error {
 
 	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
 
+	syncGwConfig, err := renderConfig(syncGwCluster)
+	if err != nil {
+		return err
+	}
+
+	// don't log the rendered config, since it might contain the admin password
+	log.Printf("Writing Sync GW config file (%v bytes) to %v", len(syncGwConfig), dest)
+
+	// write the new config to the dest file
+	if err := ioutil.WriteFile(dest, []byte(syncGwConfig), 0644); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// Rewrite the config whenever the config url or the couchbase server
+// cluster membership changes in etcd, and tell sync gateway about it.
+func watchConfig(arguments map[string]interface{}) error {
+
+	etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+	dest, err := cbcluster.ExtractStringArg(arguments, "--destination")
+	if err != nil {
+		return err
+	}
+
+	reloadHook, err := cbcluster.ExtractReloadHook(arguments, "HUP")
+	if err != nil {
+		return err
+	}
+
+	syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+
+	rewrite := func() {
+		if err := rewriteIfChanged(syncGwCluster, dest, reloadHook); err != nil {
+			log.Printf("Error rewriting config: %v.  Will retry on next change", err)
+		}
+	}
+
+	rewrite()
+
+	syncGwCluster.WatchConfigChanges(rewrite)
+
+	return nil
+
+}
+
+// Render the config, and if it's different than what's in dest, replace
+// dest and run the reload hook.
+func rewriteIfChanged(syncGwCluster *cbcluster.SyncGwCluster, dest string, reloadHook cbcluster.SyncGwReloadHook) error {
+
+	syncGwConfig, err := renderConfig(syncGwCluster)
+	if err != nil {
+		return err
+	}
+
+	existingConfig, err := ioutil.ReadFile(dest)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bytes.Equal(existingConfig, []byte(syncGwConfig)) {
+		log.Printf("Sync GW config unchanged, nothing to do")
+		return nil
+	}
+
+	log.Printf("Writing Sync GW config file (%v bytes) to %v", len(syncGwConfig), dest)
+	if err := cbcluster.WriteFileAtomic(dest, []byte(syncGwConfig), 0644); err != nil {
+		return err
+	}
+
+	return reloadHook.Reload(dest)
+
+}
+
+// Fetch the config from the url in etcd, and fill in any placeholder variables
+func renderConfig(syncGwCluster *cbcluster.SyncGwCluster) (string, error) {
+
 	// get the sync gw config from etcd (cbcluster.KEY_SYNC_GW_CONFIG)
 	syncGwConfig, err := syncGwCluster.FetchSyncGwConfig()
+	if err != nil {
+		return "", err
+	}
 
 	if !requiresRewrite(syncGwConfig) {
 		log.Printf("No placeholder variables in config, no rewrite required")
 	} else {
 
-		// get a couchbase live node
-		couchbaseCluster := cbcluster.NewCouchbaseCluster(etcdServers)
-		liveNodeIp, err := couchbaseCluster.FindLiveNode()
-
-		log.Printf("LiveNodeIp: %v", liveNodeIp)
-
+		// find the live couchbase nodes, buckets, etc
+		params, err := syncGwCluster.BuildConfigParams()
 		if err != nil {
-			return err
+			return "", err
 		}
 
+		log.Printf("Couchbase server list: %v", params.COUCHBASE_SERVER_LIST)
+
 		// run the sync gw config through go templating engine
-		syncGwConfigBytes, err := syncGwCluster.UpdateConfig(liveNodeIp, syncGwConfig)
+		syncGwConfigBytes, err := syncGwCluster.UpdateConfig(params, syncGwConfig)
 		if err != nil {
-			return err
+			return "", err
 		}
 		syncGwConfig = string(syncGwConfigBytes)
 
 	}
 
-	log.Printf("Sync GW config file: %v", string(syncGwConfig))
+	return syncGwConfig, nil
 
-	// write the new config to the dest file
-	if err := ioutil.WriteFile(dest, []byte(syncGwConfig), 0644); err != nil {
+}
+
+func validateConfig(arguments map[string]interface{}) error {
+
+	var syncGwConfig string
+
+	configFile, _ := cbcluster.ExtractStringArg(arguments, "--config-file")
+	if configFile != "" {
+		content, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		syncGwConfig = string(content)
+	} else {
+		etcdServers := cbcluster.ExtractEtcdServerList(arguments)
+		syncGwCluster := cbcluster.NewSyncGwCluster(etcdServers)
+		content, err := syncGwCluster.FetchSyncGwConfig()
+		if err != nil {
+			return err
+		}
+		syncGwConfig = content
+	}
+
+	if err := cbcluster.ValidateSyncGwConfig(syncGwConfig); err != nil {
 		return err
 	}
 
+	log.Printf("Sync GW config is valid")
 	return nil
 
 }
@@ -0,0 +1,189 @@
+package cbcluster
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Features of the couchbase server REST api that depend on its version
+const (
+	CAPABILITY_MEMORY_QUOTA       = "memory-quota"       // memoryQuota on /pools/default
+	CAPABILITY_SERVICES           = "services"           // setupServices, and the services param to addNode
+	CAPABILITY_BUCKET_PROXY_PORT  = "bucket-proxy-port"  // the authType and proxyPort bucket params
+	CAPABILITY_RBAC               = "rbac"               // users and roles
+	CAPABILITY_INDEX_STORAGE_MODE = "index-storage-mode" // storageMode on /settings/indexes
+	CAPABILITY_PLASMA             = "plasma"             // the plasma index storage mode, which replaced forestdb in enterprise
+
+	EDITION_COMMUNITY  = "community"
+	EDITION_ENTERPRISE = "enterprise"
+)
+
+// Which versions have each capability.  Since is the first version with
+// it, and Until the first version without it, or "" if it's still there.
+// Edition is the only edition with it, or "" for both.
+var couchbaseCapabilities = []struct {
+	Capability string
+	Since      string
+	Until      string
+	Edition    string
+}{
+	{CAPABILITY_MEMORY_QUOTA, "2.0", "", ""},
+	{CAPABILITY_BUCKET_PROXY_PORT, "2.0", "5.0", ""},
+	{CAPABILITY_SERVICES, "4.0", "", ""},
+	{CAPABILITY_INDEX_STORAGE_MODE, "4.0", "", ""},
+	{CAPABILITY_RBAC, "5.0", "", ""},
+	{CAPABILITY_PLASMA, "5.0", "", EDITION_ENTERPRISE},
+}
+
+// The first version that can run each service.  The data service runs on
+// every version.
+var serviceMinVersions = map[string]string{
+	SERVICE_INDEX:     "4.0",
+	SERVICE_QUERY:     "4.0",
+	SERVICE_FTS:       "4.5",
+	SERVICE_EVENTING:  "5.5",
+	SERVICE_ANALYTICS: "6.0",
+}
+
+// eg 3.0.1-1444-rel-community, 4.5.0-2601-enterprise or 5.0.1
+var couchbaseVersionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?(?:-(\d+))?(?:-rel)?(?:-(community|enterprise))?`)
+
+// A couchbase server version, as reported in implementationVersion on /pools
+type CouchbaseVersion struct {
+	Major   int
+	Minor   int
+	Patch   int
+	Build   int    // 0 if unknown
+	Edition string // EDITION_COMMUNITY, EDITION_ENTERPRISE, or empty if unknown
+	Raw     string
+}
+
+func ParseCouchbaseVersion(rawVersion string) (CouchbaseVersion, error) {
+
+	version := CouchbaseVersion{Raw: rawVersion}
+
+	matches := couchbaseVersionRegexp.FindStringSubmatch(rawVersion)
+	if matches == nil {
+		return version, fmt.Errorf("Could not parse couchbase server version: %v", rawVersion)
+	}
+
+	version.Major, _ = strconv.Atoi(matches[1])
+	version.Minor, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		version.Patch, _ = strconv.Atoi(matches[3])
+	}
+	if matches[4] != "" {
+		version.Build, _ = strconv.Atoi(matches[4])
+	}
+	version.Edition = matches[5]
+
+	return version, nil
+
+}
+
+func mustParseCouchbaseVersion(rawVersion string) CouchbaseVersion {
+	version, err := ParseCouchbaseVersion(rawVersion)
+	if err != nil {
+		panic(err)
+	}
+	return version
+}
+
+func (v CouchbaseVersion) String() string {
+	return fmt.Sprintf("%v.%v.%v", v.Major, v.Minor, v.Patch)
+}
+
+// Compare major.minor.patch, ignoring the build and edition.  Returns -1,
+// 0 or 1 like strings.Compare.
+func (v CouchbaseVersion) Compare(other CouchbaseVersion) int {
+
+	a := []int{v.Major, v.Minor, v.Patch}
+	b := []int{other.Major, other.Minor, other.Patch}
+
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+
+}
+
+// The version with the patch and build dropped, to compare major.minor
+func (v CouchbaseVersion) MajorMinor() CouchbaseVersion {
+	return CouchbaseVersion{Major: v.Major, Minor: v.Minor, Raw: fmt.Sprintf("%v.%v", v.Major, v.Minor)}
+}
+
+func (v CouchbaseVersion) AtLeast(rawVersion string) bool {
+	return v.Compare(mustParseCouchbaseVersion(rawVersion)) >= 0
+}
+
+// Whether this version has the capability, eg CAPABILITY_RBAC
+func (v CouchbaseVersion) Supports(capability string) bool {
+
+	for _, row := range couchbaseCapabilities {
+		if row.Capability != capability {
+			continue
+		}
+		if row.Edition != "" && v.Edition != row.Edition {
+			return false
+		}
+		if !v.AtLeast(row.Since) {
+			return false
+		}
+		return row.Until == "" || !v.AtLeast(row.Until)
+	}
+
+	return false
+
+}
+
+// Make sure this version can run all the given services
+func (v CouchbaseVersion) VerifyServices(services []string) error {
+
+	if len(services) > 0 && !v.Supports(CAPABILITY_SERVICES) {
+		return fmt.Errorf("Couchbase server %v doesn't support choosing services, that needs 4.0 or later", v.Raw)
+	}
+
+	for _, service := range services {
+		minVersion, ok := serviceMinVersions[service]
+		if ok && !v.AtLeast(minVersion) {
+			return fmt.Errorf("Couchbase server %v doesn't support the %v service, that needs %v or later", v.Raw, service, minVersion)
+		}
+	}
+
+	return nil
+
+}
+
+// The index storage mode to set for the cluster.  Enterprise 5.0 and later
+// only take plasma, while community (and enterprise before 5.0) only have
+// forestdb.  Returns "" if the edition isn't known, since guessing wrong
+// fails the request.
+func (v CouchbaseVersion) IndexStorageMode() string {
+	switch {
+	case v.Supports(CAPABILITY_PLASMA):
+		return "plasma"
+	case v.Edition == EDITION_COMMUNITY, v.Edition == EDITION_ENTERPRISE:
+		return "forestdb"
+	default:
+		return ""
+	}
+}
+
+// The version of the local node, fetching it if it's not known yet
+func (c CouchbaseCluster) CouchbaseVersion() (CouchbaseVersion, error) {
+
+	if c.LocalCouchbaseVersion == "" {
+		if err := c.FetchClusterDetails(); err != nil {
+			return CouchbaseVersion{}, err
+		}
+	}
+
+	return ParseCouchbaseVersion(c.LocalCouchbaseVersion)
+
+}
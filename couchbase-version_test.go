@@ -0,0 +1,89 @@
+package cbcluster
+
+import (
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestParseCouchbaseVersion(t *testing.T) {
+
+	version, err := ParseCouchbaseVersion("3.0.1-1444-rel-community")
+	assert.True(t, err == nil)
+	assert.Equals(t, version.Major, 3)
+	assert.Equals(t, version.Minor, 0)
+	assert.Equals(t, version.Patch, 1)
+	assert.Equals(t, version.Build, 1444)
+	assert.Equals(t, version.Edition, "community")
+
+	version, err = ParseCouchbaseVersion("4.5.0-2601-enterprise")
+	assert.True(t, err == nil)
+	assert.Equals(t, version.String(), "4.5.0")
+	assert.Equals(t, version.Edition, "enterprise")
+
+	version, err = ParseCouchbaseVersion("5.0")
+	assert.True(t, err == nil)
+	assert.Equals(t, version.String(), "5.0.0")
+	assert.Equals(t, version.Build, 0)
+
+	_, err = ParseCouchbaseVersion("latest")
+	assert.True(t, err != nil)
+
+	// the major version used to come out as 51, the code point of "3"
+	c := CouchbaseCluster{LocalCouchbaseVersion: "3.0.1-1444-rel-community"}
+	majorVersion, err := c.CouchbaseMajorVersion()
+	assert.True(t, err == nil)
+	assert.Equals(t, majorVersion, 3)
+
+}
+
+func TestCouchbaseVersionCompare(t *testing.T) {
+
+	v301 := mustParseCouchbaseVersion("3.0.1")
+
+	assert.Equals(t, v301.Compare(mustParseCouchbaseVersion("3.0.1-1444-rel-enterprise")), 0)
+	assert.Equals(t, v301.Compare(mustParseCouchbaseVersion("3.0.2")), -1)
+	assert.Equals(t, v301.Compare(mustParseCouchbaseVersion("2.5.1")), 1)
+	assert.Equals(t, mustParseCouchbaseVersion("10.0.0").Compare(v301), 1)
+	assert.True(t, v301.AtLeast("3.0"))
+	assert.False(t, v301.AtLeast("4.0"))
+
+}
+
+func TestCouchbaseCapabilities(t *testing.T) {
+
+	v3 := mustParseCouchbaseVersion("3.0.1-1444-rel-community")
+	assert.True(t, v3.Supports(CAPABILITY_MEMORY_QUOTA))
+	assert.True(t, v3.Supports(CAPABILITY_BUCKET_PROXY_PORT))
+	assert.False(t, v3.Supports(CAPABILITY_SERVICES))
+	assert.False(t, v3.Supports(CAPABILITY_RBAC))
+	assert.True(t, v3.VerifyServices([]string{}) == nil)
+	assert.True(t, v3.VerifyServices([]string{SERVICE_DATA}) != nil)
+
+	v45 := mustParseCouchbaseVersion("4.5.0-2601-enterprise")
+	assert.True(t, v45.Supports(CAPABILITY_SERVICES))
+	assert.True(t, v45.Supports(CAPABILITY_INDEX_STORAGE_MODE))
+	assert.True(t, v45.VerifyServices([]string{SERVICE_DATA, SERVICE_INDEX, SERVICE_FTS}) == nil)
+	assert.True(t, v45.VerifyServices([]string{SERVICE_EVENTING}) != nil)
+	assert.Equals(t, v45.IndexStorageMode(), "forestdb")
+
+	v5 := mustParseCouchbaseVersion("5.0.1-5003-enterprise")
+	assert.False(t, v5.Supports(CAPABILITY_BUCKET_PROXY_PORT))
+	assert.True(t, v5.Supports(CAPABILITY_RBAC))
+	assert.Equals(t, v5.IndexStorageMode(), "plasma")
+
+	// plasma is enterprise only
+	v6ce := mustParseCouchbaseVersion("6.0.0-1693-community")
+	assert.False(t, v6ce.Supports(CAPABILITY_PLASMA))
+	assert.Equals(t, v6ce.IndexStorageMode(), "forestdb")
+
+	// no edition, so no way to know which storage mode it takes
+	assert.Equals(t, mustParseCouchbaseVersion("6.0.0").IndexStorageMode(), "")
+
+	v7 := mustParseCouchbaseVersion("7.1.4-3601-enterprise")
+	assert.True(t, v7.VerifyServices([]string{SERVICE_ANALYTICS, SERVICE_EVENTING}) == nil)
+	assert.Equals(t, v7.IndexStorageMode(), "plasma")
+
+	assert.False(t, v7.Supports("no-such-capability"))
+
+}
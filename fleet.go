@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -35,6 +35,14 @@ type CouchbaseFleet struct {
 	ContainerTag        string // Docker tag
 	EtcdServers         []string
 	SkipCleanSlateCheck bool
+	Services            string            // services to run on all nodes, eg "data,index"
+	UnitServices        map[string]string // per-unit overrides of Services, keyed by unit number
+	MemoryQuotas        string            // per-service memory quotas, eg "data:1024,index:512"
+	MemoryQuotaPolicy   string            // eg "75%" or "reserve:1024"
+	Templates           UnitTemplates
+	DryRun              bool // print what would be launched, without changing anything
+	Placement           MachinePlacement
+	UnitZones           map[string]string // per-unit overrides of the server group zone, keyed by unit number
 }
 
 func NewCouchbaseFleet(etcdServers []string) *CouchbaseFleet {
@@ -68,22 +76,49 @@ func (c CouchbaseFleet) VerifyFleetAPIAvailable() error {
 
 func (c *CouchbaseFleet) LaunchCouchbaseServer() error {
 
+	if c.DryRun {
+		plan, err := c.Plan()
+		if err != nil {
+			return err
+		}
+		plan.Print(os.Stdout)
+		return nil
+	}
+
 	if err := c.VerifyFleetAPIAvailable(); err != nil {
 		msg := "Unable to connect to Fleet API, see http://bit.ly/1AC1iRX " +
 			"for instructions on how to fix this"
 		return fmt.Errorf(msg)
 	}
 
+	if err := c.resolvePlacement(); err != nil {
+		return err
+	}
+
 	if err := c.verifyEnoughMachinesAvailable(); err != nil {
 		return err
 	}
 
-	// create an etcd client
+	units, err := c.desiredUnits()
+	if err != nil {
+		return err
+	}
 
-	// this need to check:
-	//   no etcd key for /couchbase.com
-	//   what else?
-	if err := c.verifyCleanSlate(); err != nil {
+	// if an earlier launch got partway, only the missing units are created
+	launchState, diff, err := c.resumableUnits(units)
+	if err != nil {
+		return err
+	}
+	if launchState == nil {
+		launchState = &LaunchState{
+			NumNodes:     c.NumNodes,
+			CbVersion:    c.CbVersion,
+			ContainerTag: c.ContainerTag,
+			Started:      time.Now().UTC(),
+		}
+	}
+	launchState.Status = LAUNCH_STATUS_IN_PROGRESS
+	if err := c.saveLaunchState(launchState); err != nil {
 		return err
 	}
 
@@ -91,31 +126,24 @@ func (c *CouchbaseFleet) LaunchCouchbaseServer() error {
 		return err
 	}
 
-	nodeFleetUnitJson, err := c.generateNodeFleetUnitJson()
-	if err != nil {
-		return err
+	missing := map[string]bool{}
+	for _, unitName := range diff.Missing {
+		missing[unitName] = true
 	}
 
-	for i := 1; i < c.NumNodes+1; i++ {
+	for _, plannedUnit := range units {
 
-		if err := launchFleetUnitN(
-			i,
-			UNIT_NAME_NODE,
-			nodeFleetUnitJson,
-		); err != nil {
-			return err
+		if !missing[plannedUnit.Name] {
+			log.Printf("Unit %v already launched, skipping", plannedUnit.Name)
+			continue
 		}
 
-		sidekickFleetUnitJson, err := c.generateSidekickFleetUnitJson(fmt.Sprintf("%v", i))
-		if err != nil {
+		if err := launchFleetUnit(plannedUnit.Name, plannedUnit.Json); err != nil {
 			return err
 		}
 
-		if err := launchFleetUnitN(
-			i,
-			UNIT_NAME_SIDEKICK,
-			sidekickFleetUnitJson,
-		); err != nil {
+		launchState.Units = append(launchState.Units, plannedUnit.Name)
+		if err := c.saveLaunchState(launchState); err != nil {
 			return err
 		}
 
@@ -126,6 +154,76 @@ func (c *CouchbaseFleet) LaunchCouchbaseServer() error {
 		return err
 	}
 
+	launchState.Status = LAUNCH_STATUS_COMPLETE
+	return c.saveLaunchState(launchState)
+
+}
+
+// Everything LaunchCouchbaseServer would do, without doing it.  Checks that
+// would make the launch fail are reported as warnings rather than errors,
+// so that the whole plan can be reviewed.
+func (c CouchbaseFleet) Plan() (LaunchPlan, error) {
+
+	plan := LaunchPlan{}
+
+	plan.AddFleetMachines()
+
+	if err := c.resolvePlacement(); err != nil {
+		plan.AddWarning("Could not resolve machine placement: %v", err)
+	}
+
+	if err := c.verifyEnoughMachinesAvailable(); err != nil {
+		plan.AddWarning("Launch would fail: %v", err)
+	}
+
+	plan.AddEtcdKey(KEY_LAUNCH_STATE, "launch progress")
+	plan.AddEtcdKey(KEY_USER_PASS, maskUserPass(c.UserPass))
+
+	if err := c.addUnitsToPlan(&plan); err != nil {
+		return plan, err
+	}
+
+	if _, diff, err := c.resumableUnits(plan.Units); err != nil {
+		plan.AddWarning("Launch would fail: %v", err)
+	} else if len(diff.Matching) > 0 {
+		plan.AddWarning("Resuming an earlier launch, only missing units will be created:\n%v", diff)
+	}
+
+	return plan, nil
+
+}
+
+// The node and sidekick units to launch, in launch order
+func (c CouchbaseFleet) desiredUnits() ([]PlannedUnit, error) {
+	plan := LaunchPlan{}
+	err := c.addUnitsToPlan(&plan)
+	return plan.Units, err
+}
+
+func (c CouchbaseFleet) addUnitsToPlan(plan *LaunchPlan) error {
+
+	for i := 1; i < c.NumNodes+1; i++ {
+
+		unitNumber := fmt.Sprintf("%v", i)
+
+		nodeUnitFile, err := c.generateNodeFleetUnitFile(unitNumber)
+		if err != nil {
+			return err
+		}
+		if err := plan.AddUnit(fmt.Sprintf("%v@%v.service", UNIT_NAME_NODE, i), nodeUnitFile); err != nil {
+			return err
+		}
+
+		sidekickUnitFile, err := c.generateSidekickFleetUnitFile(unitNumber)
+		if err != nil {
+			return err
+		}
+		if err := plan.AddUnit(fmt.Sprintf("%v@%v.service", UNIT_NAME_SIDEKICK, i), sidekickUnitFile); err != nil {
+			return err
+		}
+
+	}
+
 	return nil
 
 }
@@ -185,7 +283,17 @@ func (c CouchbaseFleet) DestroyUnits(allUnits bool) error {
 
 	}
 
-	return c.ManipulateUnits(unitDestroyer, allUnits)
+	if err := c.ManipulateUnits(unitDestroyer, allUnits); err != nil {
+		return err
+	}
+
+	// the next cluster records its own uuid
+	if _, err := c.etcdClient.Delete(KEY_CLUSTER_UUID, false); err != nil && !isEtcdKeyNotFound(err) {
+		return err
+	}
+
+	// the next launch starts from scratch rather than resuming this one
+	return c.deleteLaunchState()
 
 }
 
@@ -194,7 +302,7 @@ type UnitManipulator func(unit *schema.Unit) error
 func (c CouchbaseFleet) ManipulateUnits(unitManipulator UnitManipulator, manipulateAllUnits bool) error {
 
 	// find all the units
-	allUnits, err := c.findAllFleetUnits()
+	allUnits, err := findAllFleetUnits()
 	if err != nil {
 		return err
 	}
@@ -206,7 +314,7 @@ func (c CouchbaseFleet) ManipulateUnits(unitManipulator UnitManipulator, manipul
 	} else {
 		// filter the ones out that have the name pattern we care about (couchbase_node)
 		unitNamePatterns := []string{UNIT_NAME_NODE, UNIT_NAME_SIDEKICK}
-		units = c.filterFleetUnits(allUnits, unitNamePatterns)
+		units = filterFleetUnits(allUnits, unitNamePatterns)
 	}
 
 	for _, unit := range units {
@@ -219,7 +327,7 @@ func (c CouchbaseFleet) ManipulateUnits(unitManipulator UnitManipulator, manipul
 
 }
 
-func (c CouchbaseFleet) findAllFleetUnits() (units []*schema.Unit, err error) {
+func findAllFleetUnits() (units []*schema.Unit, err error) {
 
 	endpointUrl := ""
 	maxAttempts := 10000
@@ -271,7 +379,7 @@ func (c CouchbaseFleet) findAllFleetUnits() (units []*schema.Unit, err error) {
 
 }
 
-func (c CouchbaseFleet) filterFleetUnits(units []*schema.Unit, filters []string) (filteredUnits []*schema.Unit) {
+func filterFleetUnits(units []*schema.Unit, filters []string) (filteredUnits []*schema.Unit) {
 
 	stringContainsAny := func(s string, filters []string) bool {
 		for _, filter := range filters {
@@ -296,7 +404,7 @@ func (c CouchbaseFleet) filterFleetUnits(units []*schema.Unit, filters []string)
 func (c CouchbaseFleet) GenerateUnits(outputDir string) error {
 
 	// generate node unit
-	nodeFleetUnit, err := c.generateNodeFleetUnitFile()
+	nodeFleetUnit, err := c.generateNodeFleetUnitFile("%i")
 	if err != nil {
 		return err
 	}
@@ -382,43 +490,135 @@ func (c *CouchbaseFleet) ExtractDocOptArgs(arguments map[string]interface{}) err
 		return err
 	}
 
+	services, err := ExtractServices(arguments)
+	if err != nil {
+		return err
+	}
+	rawUnitServices, err := ExtractStringListArg(arguments, "--unit-services")
+	if err != nil {
+		return err
+	}
+	unitServices, err := parseUnitServices(rawUnitServices)
+	if err != nil {
+		return err
+	}
+	if _, err := ExtractMemoryQuotas(arguments); err != nil {
+		return err
+	}
+	memoryQuotas, _ := ExtractStringArg(arguments, "--memory-quotas")
+	if _, err := ExtractQuotaPolicy(arguments); err != nil {
+		return err
+	}
+	memoryQuotaPolicy, _ := ExtractStringArg(arguments, "--memory-quota-policy")
+
 	c.UserPass = userpass
 	c.NumNodes = numnodes
 	c.CbVersion = cbVersion
 	c.ContainerTag = ExtractDockerTagOrLatest(arguments)
 	c.SkipCleanSlateCheck = ExtractSkipCheckCleanState(arguments)
+	c.Services = strings.Join(services, ",")
+	c.UnitServices = unitServices
+	c.MemoryQuotas = memoryQuotas
+	c.MemoryQuotaPolicy = memoryQuotaPolicy
+
+	templates, err := ExtractUnitTemplates(arguments)
+	if err != nil {
+		return err
+	}
+	c.Templates = templates
+
+	c.DryRun = ExtractBoolArg(arguments, "--dry-run")
+
+	placement, err := ExtractMachinePlacement(arguments)
+	if err != nil {
+		return err
+	}
+	c.Placement = placement
 
 	return nil
 }
 
+// Convert per-unit service overrides like ["3:index,query", "4:index"]
+// into a map of unit number -> services, ie {"3": "index,query", "4": "index"}
+func parseUnitServices(rawUnitServices []string) (map[string]string, error) {
+
+	unitServices := map[string]string{}
+
+	for _, rawUnitService := range rawUnitServices {
+		components := strings.SplitN(rawUnitService, ":", 2)
+		if len(components) != 2 {
+			return nil, fmt.Errorf("Invalid unit services: %v.  Expected unit-number:services", rawUnitService)
+		}
+		unitNumber := strings.TrimSpace(components[0])
+		services, err := ParseServices(components[1])
+		if err != nil {
+			return nil, err
+		}
+		unitServices[unitNumber] = strings.Join(services, ",")
+	}
+
+	return unitServices, nil
+
+}
+
+// The services that the given unit should run, which is either
+// an override for that particular unit or the cluster-wide default
+func (c CouchbaseFleet) servicesForUnit(unitNumber string) string {
+
+	if services, ok := c.UnitServices[unitNumber]; ok {
+		return services
+	}
+	return c.Services
+
+}
+
+// The server group zone for the given unit, which is either an override for
+// that particular unit or the one it was assigned by the placement
+func (c CouchbaseFleet) zoneForUnit(unitNumber string) string {
+
+	if zone, ok := c.UnitZones[unitNumber]; ok {
+		return zone
+	}
+	return c.Placement.UnitServerGroup(unitNumber)
+
+}
+
 // call fleetctl list-machines and verify that the number of nodes
 // the user asked to kick off is LTE number of machines on cluster
 func (c CouchbaseFleet) verifyEnoughMachinesAvailable() error {
 
 	log.Printf("verifyEnoughMachinesAvailable()")
 
-	endpointUrl := fmt.Sprintf("%v/machines", FLEET_API_ENDPOINT)
-
-	// {"machines":[{"id":"a91c394439734375aa256d7da1410132","primaryIP":"172.17.8.101"}]}
-	jsonMap := map[string]interface{}{}
-	if err := getJsonData(endpointUrl, &jsonMap); err != nil {
-		log.Printf("getJsonData error: %v", err)
+	machines, err := findAllFleetMachines()
+	if err != nil {
+		log.Printf("findAllFleetMachines error: %v", err)
 		return err
 	}
 
-	machineListRaw := jsonMap["machines"]
-	machineList, ok := machineListRaw.([]interface{})
-	if !ok {
-		return fmt.Errorf("Unexpected value for machines: %v", jsonMap)
+	if err := c.Placement.VerifyEnoughMachines(unitNumberRange(1, c.NumNodes), machines); err != nil {
+		return err
 	}
 
-	if len(machineList) < c.NumNodes {
-		return fmt.Errorf("User requested %v nodes, only %v available", c.NumNodes, len(machineList))
+	log.Printf("/verifyEnoughMachinesAvailable()")
+
+	return nil
+}
+
+// Find the values to spread the units across, if spreading
+func (c *CouchbaseFleet) resolvePlacement() error {
+
+	if c.Placement.SpreadBy == "" {
+		return nil
 	}
 
-	log.Printf("/verifyEnoughMachinesAvailable()")
+	machines, err := findAllFleetMachines()
+	if err != nil {
+		return err
+	}
+	c.Placement = c.Placement.Resolve(machines)
 
 	return nil
+
 }
 
 // Make sure that /couchbase.com/couchbase-node-state is empty
@@ -457,9 +657,9 @@ func (c CouchbaseFleet) setUserNamePassEtcd() error {
 
 }
 
-func (c CouchbaseFleet) generateNodeFleetUnitJson() (string, error) {
+func (c CouchbaseFleet) generateNodeFleetUnitJson(unitNumber string) (string, error) {
 
-	unitFile, err := c.generateNodeFleetUnitFile()
+	unitFile, err := c.generateNodeFleetUnitFile(unitNumber)
 	if err != nil {
 		return "", err
 	}
@@ -515,94 +715,84 @@ func unitFileToJson(unitFileContent string) ([]byte, error) {
 
 }
 
-func (c CouchbaseFleet) generateNodeFleetUnitFile() (string, error) {
+func (c CouchbaseFleet) generateNodeFleetUnitFile(unitNumber string) (string, error) {
 
 	assetName := "data/couchbase_node@.service.template"
-	content, err := Asset(assetName)
-	if err != nil {
-		return "", fmt.Errorf("could not find asset: %v.  err: %v", assetName, err)
-	}
 
 	params := struct {
-		CB_VERSION    string
-		CONTAINER_TAG string
+		CB_VERSION       string
+		CONTAINER_TAG    string
+		MACHINE_METADATA []string
 	}{
-		CB_VERSION:    c.CbVersion,
-		CONTAINER_TAG: c.ContainerTag,
+		CB_VERSION:       c.CbVersion,
+		CONTAINER_TAG:    c.ContainerTag,
+		MACHINE_METADATA: c.Placement.UnitMetadata(unitNumber),
 	}
 
 	log.Printf("Generating node from %v with params: %+v", assetName, params)
 
-	return generateUnitFileFromTemplate(content, params)
+	return c.Templates.Generate(assetName, params)
 
 }
 
 func (c CouchbaseFleet) generateSidekickFleetUnitFile(unitNumber string) (string, error) {
 
 	assetName := "data/couchbase_sidekick@.service.template"
-	content, err := Asset(assetName)
-	if err != nil {
-		return "", fmt.Errorf("could not find asset: %v.  err: %v", assetName, err)
-	}
 
 	params := struct {
-		CB_VERSION    string
-		CONTAINER_TAG string
-		UNIT_NUMBER   string
+		CB_VERSION          string
+		CONTAINER_TAG       string
+		UNIT_NUMBER         string
+		SERVICES            string
+		MEMORY_QUOTAS       string
+		MEMORY_QUOTA_POLICY string
+		ZONE                string
 	}{
-		CB_VERSION:    c.CbVersion,
-		CONTAINER_TAG: c.ContainerTag,
-		UNIT_NUMBER:   unitNumber,
+		CB_VERSION:          c.CbVersion,
+		CONTAINER_TAG:       c.ContainerTag,
+		UNIT_NUMBER:         unitNumber,
+		SERVICES:            c.servicesForUnit(unitNumber),
+		MEMORY_QUOTAS:       c.MemoryQuotas,
+		MEMORY_QUOTA_POLICY: c.MemoryQuotaPolicy,
+		ZONE:                c.zoneForUnit(unitNumber),
 	}
 
 	log.Printf("Generating sidekick from %v with params: %+v", assetName, params)
 
-	return generateUnitFileFromTemplate(content, params)
+	return c.Templates.Generate(assetName, params)
 
 }
 
-func generateUnitFileFromTemplate(templateContent []byte, params interface{}) (string, error) {
-
-	// run through go template engine
-	tmpl, err := template.New("Template").Parse(string(templateContent))
-	if err != nil {
-		return "", err
-	}
-
-	out := &bytes.Buffer{}
+func launchFleetUnitN(unitNumber int, unitName, fleetUnitJson string) error {
 
-	// execute template and write to dest
-	err = tmpl.Execute(out, params)
-	if err != nil {
-		return "", err
-	}
+	log.Printf("Launch fleet unit %v (%v)", unitName, unitNumber)
 
-	return out.String(), nil
+	return launchFleetUnit(fmt.Sprintf("%v@%v.service", unitName, unitNumber), fleetUnitJson)
 
 }
 
-func launchFleetUnitN(unitNumber int, unitName, fleetUnitJson string) error {
+// Launch a unit given its full name, eg couchbase_node@1.service
+func launchFleetUnit(unitName, fleetUnitJson string) error {
 
-	log.Printf("Launch fleet unit %v (%v)", unitName, unitNumber)
-
-	endpointUrl := fmt.Sprintf("%v/units/%v@%v.service", FLEET_API_ENDPOINT, unitName, unitNumber)
+	endpointUrl := fmt.Sprintf("%v/units/%v", FLEET_API_ENDPOINT, unitName)
 
 	return PUT(endpointUrl, fleetUnitJson)
 
 }
 
-// Launch a fleet unit file that is stored in the data dir (via go-bindata)
-func launchFleetUnitFile(unitName, unitFilePath string) error {
+// Launch a fleet unit file template that is stored in the data dir (via go-bindata),
+// or overridden in the template dir
+func launchFleetUnitFile(templates UnitTemplates, unitName, unitFilePath string, params interface{}) error {
 
 	log.Printf("Launch fleet unit file (%v)", unitName)
 
-	content, err := Asset(unitFilePath)
+	unitFile, err := templates.Generate(unitFilePath, params)
 	if err != nil {
-		return fmt.Errorf("could not find asset: %v.  err: %v", unitFilePath, err)
+		return err
 	}
 
 	// convert from text -> json
-	jsonBytes, err := unitFileToJson(string(content))
+	jsonBytes, err := unitFileToJson(unitFile)
 	if err != nil {
 		return err
 	}
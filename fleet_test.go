@@ -2,6 +2,7 @@ package cbcluster
 
 import (
 	"log"
+	"strings"
 	"testing"
 
 	"github.com/couchbaselabs/go.assert"
@@ -10,7 +11,7 @@ import (
 
 func TestGenerateNodeFleetUnitJson(t *testing.T) {
 	c := CouchbaseFleet{}
-	unitJson, err := c.generateNodeFleetUnitJson()
+	unitJson, err := c.generateNodeFleetUnitJson("1")
 
 	assert.True(t, err == nil)
 	assert.True(t, len(unitJson) > 0)
@@ -37,8 +38,7 @@ func TestFindAllUnits(t *testing.T) {
 	assert.True(t, err == nil)
 	mockFleetApi.Response(200, jsonHeaders(), string(mockResponse))
 
-	c := CouchbaseFleet{}
-	allUnits, err := c.findAllFleetUnits()
+	allUnits, err := findAllFleetUnits()
 	if err != nil {
 		log.Printf("err: %v", err)
 	}
@@ -51,3 +51,82 @@ func TestFindAllUnits(t *testing.T) {
 func jsonHeaders() map[string]string {
 	return map[string]string{"Content-Type": "application/json"}
 }
+
+func TestCbVersionMatches(t *testing.T) {
+
+	assert.True(t, cbVersionMatches("community-3.0.1", "3.0.1-1444-rel-community"))
+	assert.True(t, cbVersionMatches("enterprise-3.0.3", "3.0.3-1716-rel-enterprise"))
+	assert.True(t, cbVersionMatches("latest", "4.0.0-2213-rel-enterprise"))
+	assert.False(t, cbVersionMatches("community-3.0.1", "3.0.10-1444-rel-community"))
+	assert.False(t, cbVersionMatches("community-3.0.1", "2.2.0-837-rel-community"))
+
+}
+
+func TestFleetUnitNumber(t *testing.T) {
+
+	unitNumber, err := fleetUnitNumber("couchbase_node@3.service")
+	assert.True(t, err == nil)
+	assert.Equals(t, unitNumber, 3)
+
+	_, err = fleetUnitNumber("nginx.service")
+	assert.True(t, err != nil)
+
+}
+
+func TestNodeHostnameIp(t *testing.T) {
+
+	assert.Equals(t, nodeHostnameIp("10.0.0.12:8091"), "10.0.0.12")
+	assert.Equals(t, nodeHostnameIp("10.0.0.1"), "10.0.0.1")
+
+	// a prefix of another node's ip isn't the same node
+	assert.False(t, nodeHostnameIp("10.0.0.12:8091") == "10.0.0.1")
+
+}
+
+func TestGenerateSidekickFleetUnitServices(t *testing.T) {
+
+	c := CouchbaseFleet{
+		Services:     "data,index",
+		UnitServices: map[string]string{"3": "query"},
+	}
+
+	unitFile, err := c.generateSidekickFleetUnitFile("1")
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(unitFile, "--services=data,index"))
+
+	unitFile, err = c.generateSidekickFleetUnitFile("3")
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(unitFile, "--services=query"))
+
+	c = CouchbaseFleet{}
+	unitFile, err = c.generateSidekickFleetUnitFile("1")
+	assert.True(t, err == nil)
+	assert.False(t, strings.Contains(unitFile, "--services"))
+
+}
+
+func TestUpgradedSidekickKeepsServices(t *testing.T) {
+
+	execStart := "/bin/bash -c '/usr/bin/docker run --name couchbase-sidekick --net=host " +
+		"tleyden5iwx/couchbase-cluster-go:latest update-wrapper couchbase-cluster start-couchbase-sidekick " +
+		"--local-ip=$COREOS_PRIVATE_IPV4 --services=index,query --memory-quotas=index:512 --memory-quota-policy=reserve:1024 --zone=us-east-1b'"
+
+	flags := parseSidekickFlags(execStart)
+	assert.Equals(t, flags["--services"], "index,query")
+	assert.Equals(t, flags["--memory-quotas"], "index:512")
+
+	// the upgrade command itself doesn't know which services the unit ran
+	c := CouchbaseFleet{CbVersion: "4.0.0"}
+	upgraded := c.withSidekickFlags("2", flags)
+
+	unitFile, err := upgraded.generateSidekickFleetUnitFile("2")
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(unitFile, "--services=index,query"))
+	assert.True(t, strings.Contains(unitFile, "--memory-quotas=index:512"))
+	assert.True(t, strings.Contains(unitFile, "--memory-quota-policy=reserve:1024"))
+	assert.True(t, strings.Contains(unitFile, "--zone=us-east-1b"))
+
+	// and the original settings are left alone
+	assert.Equals(t, len(c.UnitServices), 0)
+
+}
@@ -1,9 +1,15 @@
 package cbcluster
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 type middlewareFunc func(req *http.Request)
@@ -39,3 +45,45 @@ func getJsonDataMiddleware(endpointUrl string, into interface{}, middleware midd
 func getJsonData(endpointUrl string, into interface{}) error {
 	return getJsonDataMiddleware(endpointUrl, into, func(req *http.Request) {})
 }
+
+func (c CouchbaseCluster) PUTJson(endpointUrl string, body []byte) error {
+	return c.doWithCreds("PUT", endpointUrl, "application/json", bytes.NewReader(body))
+}
+
+func (c CouchbaseCluster) PUTForm(endpointUrl string, data url.Values) error {
+	return c.doWithCreds("PUT", endpointUrl, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+func (c CouchbaseCluster) DELETE(endpointUrl string) error {
+	return c.doWithCreds("DELETE", endpointUrl, "", nil)
+}
+
+// Make a request with the admin credentials, failing on a non 2xx status
+func (c CouchbaseCluster) doWithCreds(method, endpointUrl, contentType string, body io.Reader) error {
+
+	log.Printf("%v %v", method, endpointUrl)
+
+	req, err := http.NewRequest(method, endpointUrl, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.SetBasicAuth(c.AdminUsername, c.AdminPassword)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Failed to %v %v.  Status code: %v.  Body: %v", method, endpointUrl, resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+
+}
@@ -0,0 +1,232 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/fleet/schema"
+	"github.com/coreos/go-systemd/unit"
+)
+
+const (
+	// progress of the most recent launch-cbs, so that it can be resumed
+	KEY_LAUNCH_STATE = "/couchbase.com/launch-state"
+
+	LAUNCH_STATUS_IN_PROGRESS = "in-progress"
+	LAUNCH_STATUS_COMPLETE    = "complete"
+)
+
+// What launch-cbs was asked to do, and how far it got
+type LaunchState struct {
+	Status       string    `json:"status"`
+	NumNodes     int       `json:"num_nodes"`
+	CbVersion    string    `json:"cb_version"`
+	ContainerTag string    `json:"container_tag"`
+	Units        []string  `json:"units"` // units created so far
+	Started      time.Time `json:"started"`
+	Updated      time.Time `json:"updated"`
+}
+
+// How the units fleet already has compare with the ones a launch wants
+type UnitDiff struct {
+	Missing     []string // wanted, but not in fleet yet
+	Matching    []string // in fleet with the same content
+	Conflicting []string // in fleet with different content
+	Extra       []string // in fleet, but not wanted
+}
+
+func (d UnitDiff) HasConflicts() bool {
+	return len(d.Conflicting) > 0 || len(d.Extra) > 0
+}
+
+func (d UnitDiff) String() string {
+
+	lines := []string{}
+	add := func(prefix, description string, unitNames []string) {
+		for _, unitName := range unitNames {
+			lines = append(lines, fmt.Sprintf("  %v %v (%v)", prefix, unitName, description))
+		}
+	}
+	add("+", "missing, will be created", d.Missing)
+	add("=", "already launched", d.Matching)
+	add("!", "already launched with different content", d.Conflicting)
+	add("-", "launched but not requested", d.Extra)
+
+	return strings.Join(lines, "\n")
+
+}
+
+// Compare the desired units with the existing fleet units of the same kind
+func diffUnits(desired []PlannedUnit, existing []*schema.Unit) (UnitDiff, error) {
+
+	diff := UnitDiff{}
+
+	existingByName := map[string]*schema.Unit{}
+	for _, existingUnit := range existing {
+		existingByName[existingUnit.Name] = existingUnit
+	}
+
+	desiredNames := map[string]bool{}
+	for _, desiredUnit := range desired {
+
+		desiredNames[desiredUnit.Name] = true
+
+		existingUnit, ok := existingByName[desiredUnit.Name]
+		if !ok {
+			diff.Missing = append(diff.Missing, desiredUnit.Name)
+			continue
+		}
+
+		desiredOptions, err := unit.Deserialize(strings.NewReader(desiredUnit.Content))
+		if err != nil {
+			return diff, err
+		}
+
+		if unitOptionsKey(desiredOptions) == fleetUnitOptionsKey(existingUnit.Options) {
+			diff.Matching = append(diff.Matching, desiredUnit.Name)
+		} else {
+			diff.Conflicting = append(diff.Conflicting, desiredUnit.Name)
+		}
+
+	}
+
+	for _, existingUnit := range existing {
+		if !desiredNames[existingUnit.Name] {
+			diff.Extra = append(diff.Extra, existingUnit.Name)
+		}
+	}
+	sort.Strings(diff.Extra)
+
+	return diff, nil
+
+}
+
+// A canonical form of the unit options, for comparing the unit file we'd
+// launch with what fleet has
+func unitOptionsKey(opts []*unit.UnitOption) string {
+	lines := []string{}
+	for _, opt := range opts {
+		lines = append(lines, fmt.Sprintf("[%v] %v=%v", opt.Section, opt.Name, opt.Value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func fleetUnitOptionsKey(opts []*schema.UnitOption) string {
+	lines := []string{}
+	for _, opt := range opts {
+		lines = append(lines, fmt.Sprintf("[%v] %v=%v", opt.Section, opt.Name, opt.Value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The launch state from etcd, or nil if there isn't one
+func (c CouchbaseFleet) loadLaunchState() (*LaunchState, error) {
+
+	response, err := c.etcdClient.Get(KEY_LAUNCH_STATE, false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	launchState := &LaunchState{}
+	if err := json.Unmarshal([]byte(response.Node.Value), launchState); err != nil {
+		return nil, fmt.Errorf("Invalid launch state in %v: %v", KEY_LAUNCH_STATE, err)
+	}
+
+	return launchState, nil
+
+}
+
+func (c CouchbaseFleet) saveLaunchState(launchState *LaunchState) error {
+
+	launchState.Updated = time.Now().UTC()
+
+	launchStateJson, err := json.Marshal(launchState)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcdClient.Set(KEY_LAUNCH_STATE, string(launchStateJson), TTL_NONE)
+	return err
+
+}
+
+func (c CouchbaseFleet) deleteLaunchState() error {
+	_, err := c.etcdClient.Delete(KEY_LAUNCH_STATE, false)
+	if err != nil && !isEtcdKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Work out which of the desired units still need to be created.  A
+// launch with no existing units or launch state starts from a clean slate
+// as before.  Otherwise it's a resume, which is refused if what's already
+// there doesn't match what was asked for.
+func (c CouchbaseFleet) resumableUnits(desired []PlannedUnit) (*LaunchState, UnitDiff, error) {
+
+	launchState, err := c.loadLaunchState()
+	if err != nil {
+		return nil, UnitDiff{}, err
+	}
+
+	allUnits, err := findAllFleetUnits()
+	if err != nil {
+		return nil, UnitDiff{}, err
+	}
+	existing := filterFleetUnits(allUnits, []string{
+		fmt.Sprintf("%v@", UNIT_NAME_NODE),
+		fmt.Sprintf("%v@", UNIT_NAME_SIDEKICK),
+	})
+
+	diff, err := diffUnits(desired, existing)
+	if err != nil {
+		return nil, diff, err
+	}
+
+	if launchState == nil && len(existing) == 0 {
+		if err := c.verifyCleanSlate(); err != nil {
+			return nil, diff, err
+		}
+		return nil, diff, nil
+	}
+
+	log.Printf("Found an earlier launch, comparing with what fleet has:\n%v", diff)
+
+	if diff.HasConflicts() {
+		return nil, diff, fmt.Errorf("Existing units conflict with this launch, destroy them or change the request to match:\n%v", diff)
+	}
+
+	if err := c.verifyUserPassMatches(); err != nil {
+		return nil, diff, err
+	}
+
+	return launchState, diff, nil
+
+}
+
+// A cluster that's already initialized uses the userpass it was
+// initialized with, so a different one can't be applied by resuming
+func (c CouchbaseFleet) verifyUserPassMatches() error {
+
+	response, err := c.etcdClient.Get(KEY_USER_PASS, false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if response.Node.Value != c.UserPass {
+		return fmt.Errorf("The userpass in %v differs from the one given, so this launch can't be resumed with it", KEY_USER_PASS)
+	}
+
+	return nil
+
+}
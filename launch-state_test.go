@@ -0,0 +1,50 @@
+package cbcluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreos/fleet/schema"
+	"github.com/coreos/go-systemd/unit"
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestDiffUnits(t *testing.T) {
+
+	c := CouchbaseFleet{CbVersion: "community-3.0.1", ContainerTag: "latest", NumNodes: 2}
+	desired, err := c.desiredUnits()
+	assert.True(t, err == nil)
+	assert.Equals(t, len(desired), 4)
+
+	// what fleet would have if the desired unit had been launched
+	launched := func(plannedUnit PlannedUnit) *schema.Unit {
+		opts, err := unit.Deserialize(strings.NewReader(plannedUnit.Content))
+		assert.True(t, err == nil)
+		fleetUnit := &schema.Unit{Name: plannedUnit.Name}
+		for _, opt := range opts {
+			fleetUnit.Options = append(fleetUnit.Options, &schema.UnitOption{Section: opt.Section, Name: opt.Name, Value: opt.Value})
+		}
+		return fleetUnit
+	}
+
+	// unit 1 launched, unit 2 not yet
+	existing := []*schema.Unit{launched(desired[0]), launched(desired[1])}
+	diff, err := diffUnits(desired, existing)
+	assert.True(t, err == nil)
+	assert.False(t, diff.HasConflicts())
+	assert.Equals(t, len(diff.Matching), 2)
+	assert.Equals(t, diff.Missing[0], "couchbase_node@2.service")
+
+	// unit 1 was launched with another version, and unit 3 isn't wanted
+	other := CouchbaseFleet{CbVersion: "community-2.2.0", ContainerTag: "latest", NumNodes: 3}
+	otherUnits, err := other.desiredUnits()
+	assert.True(t, err == nil)
+	existing = []*schema.Unit{launched(otherUnits[0]), launched(otherUnits[4])}
+	diff, err = diffUnits(desired, existing)
+	assert.True(t, err == nil)
+	assert.True(t, diff.HasConflicts())
+	assert.Equals(t, diff.Conflicting[0], "couchbase_node@1.service")
+	assert.Equals(t, diff.Extra[0], "couchbase_node@3.service")
+	assert.True(t, strings.Contains(diff.String(), "! couchbase_node@1.service (already launched with different content)"))
+
+}
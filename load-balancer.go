@@ -0,0 +1,364 @@
+package cbcluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	LB_TYPE_NGINX   = "nginx"
+	LB_TYPE_HAPROXY = "haproxy"
+	LB_TYPE_PROXY   = "proxy" // the built in SyncGwProxy
+
+	LB_LISTEN_PORT = 80
+
+	UNIT_NAME_LB          = "sync_gw_load_balancer"
+	UNIT_NAME_LB_SIDEKICK = "sync_gw_load_balancer_sidekick"
+)
+
+// var so that it can be overridden for testing
+var DOCKER_SOCKET_PATH = "/var/run/docker.sock"
+
+// Everything that differs between the load balancer types
+type loadBalancerType struct {
+	ConfigTemplate string // asset name of the config template
+	ConfigFile     string // file name the proxy expects its config in
+	ConfigDir      string // directory the proxy expects its config in (inside its container)
+	Image          string // docker image
+	ReloadSignal   string // signal that makes the proxy reload its config
+}
+
+var loadBalancerTypes = map[string]loadBalancerType{
+	LB_TYPE_NGINX: {
+		ConfigTemplate: "data/sync_gw_nginx.conf.template",
+		ConfigFile:     "default.conf",
+		ConfigDir:      "/etc/nginx/conf.d",
+		Image:          "nginx",
+		ReloadSignal:   "HUP",
+	},
+	LB_TYPE_HAPROXY: {
+		ConfigTemplate: "data/sync_gw_haproxy.cfg.template",
+		ConfigFile:     "haproxy.cfg",
+		ConfigDir:      "/usr/local/etc/haproxy",
+		Image:          "haproxy",
+		ReloadSignal:   "USR2",
+	},
+}
+
+// A sync gateway node that the load balancer should send traffic to
+type SyncGwUpstream struct {
+	Name      string
+	Ip        string
+	Port      int
+	AdminPort int
+	Status    string // SYNC_GW_STATUS_HEALTHY or SYNC_GW_STATUS_UNHEALTHY
+}
+
+func ValidateLoadBalancerType(lbType string) error {
+	if _, ok := loadBalancerTypes[lbType]; !ok && lbType != LB_TYPE_PROXY {
+		return fmt.Errorf("Invalid load balancer type: %v.  Expected %v, %v or %v", lbType, LB_TYPE_NGINX, LB_TYPE_HAPROXY, LB_TYPE_PROXY)
+	}
+	return nil
+}
+
+// The signal that makes the given type of load balancer reload its config
+func LoadBalancerReloadSignal(lbType string) string {
+	return loadBalancerTypes[lbType].ReloadSignal
+}
+
+// Find the healthy sync gateway nodes, which are the ones that should
+// be sent traffic.
+func (s SyncGwCluster) FindSyncGwUpstreams() ([]SyncGwUpstream, error) {
+
+	allUpstreams, err := s.FindAllSyncGwUpstreams()
+	if err != nil {
+		return nil, err
+	}
+
+	upstreams := []SyncGwUpstream{}
+	for _, upstream := range allUpstreams {
+		if upstream.Status == SYNC_GW_STATUS_UNHEALTHY {
+			log.Printf("Skipping unhealthy sync gateway %v", upstream.Ip)
+			continue
+		}
+		upstreams = append(upstreams, upstream)
+	}
+
+	return upstreams, nil
+
+}
+
+// Find the live sync gateway nodes from the entries under
+// KEY_SYNC_GW_NODE_STATE, including ones whose sidekick reports them as
+// unhealthy.  Entries expire when the sidekick stops publishing them, so
+// everything present is considered live.
+func (s SyncGwCluster) FindAllSyncGwUpstreams() ([]SyncGwUpstream, error) {
+
+	upstreams := []SyncGwUpstream{}
+
+	response, err := s.etcdClient.Get(KEY_SYNC_GW_NODE_STATE, false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return upstreams, nil
+		}
+		return nil, err
+	}
+
+	for _, node := range response.Node.Nodes {
+		_, nodeIp := path.Split(node.Key)
+		upstreams = append(upstreams, parseSyncGwUpstream(nodeIp, node.Value))
+	}
+
+	// keep the generated config stable, so that it only changes when
+	// the set of nodes changes
+	sort.Sort(upstreamsByIp(upstreams))
+
+	return upstreams, nil
+
+}
+
+// The node state value is a SyncGwNodeState json record, or "ip:port" if
+// published by an older sidekick.  If the ports can't be determined,
+// fall back to the default sync gateway ports.  Older sidekicks don't
+// publish a status, so those nodes are assumed to be healthy.
+func parseSyncGwUpstream(nodeIp, nodeState string) SyncGwUpstream {
+
+	upstream := SyncGwUpstream{
+		Name:      fmt.Sprintf("sync_gw_%v", strings.Replace(nodeIp, ".", "_", -1)),
+		Ip:        nodeIp,
+		Port:      DEFAULT_SYNC_GW_PORT,
+		AdminPort: DEFAULT_SYNC_GW_ADMIN_PORT,
+		Status:    SYNC_GW_STATUS_HEALTHY,
+	}
+
+	parsedNodeState := SyncGwNodeState{}
+	if err := json.Unmarshal([]byte(nodeState), &parsedNodeState); err == nil {
+		if parsedNodeState.Port > 0 {
+			upstream.Port = parsedNodeState.Port
+		}
+		if parsedNodeState.AdminPort > 0 {
+			upstream.AdminPort = parsedNodeState.AdminPort
+		}
+		if parsedNodeState.Status != "" {
+			upstream.Status = parsedNodeState.Status
+		}
+		return upstream
+	}
+
+	_, portStr, err := net.SplitHostPort(nodeState)
+	if err != nil {
+		return upstream
+	}
+	if port, err := strconv.Atoi(portStr); err == nil {
+		upstream.Port = port
+	}
+
+	return upstream
+
+}
+
+type upstreamsByIp []SyncGwUpstream
+
+func (u upstreamsByIp) Len() int           { return len(u) }
+func (u upstreamsByIp) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u upstreamsByIp) Less(i, j int) bool { return u[i].Ip < u[j].Ip }
+
+// Render the nginx or haproxy config for the given upstreams
+func RenderLoadBalancerConfig(lbType string, upstreams []SyncGwUpstream) (string, error) {
+
+	lb, ok := loadBalancerTypes[lbType]
+	if !ok {
+		return "", fmt.Errorf("No config to generate for load balancer type: %v.  Expected %v or %v", lbType, LB_TYPE_NGINX, LB_TYPE_HAPROXY)
+	}
+
+	assetName := lb.ConfigTemplate
+	content, err := Asset(assetName)
+	if err != nil {
+		return "", fmt.Errorf("could not find asset: %v.  err: %v", assetName, err)
+	}
+
+	tmpl, err := template.New(lbType).Parse(string(content))
+	if err != nil {
+		return "", err
+	}
+
+	params := struct {
+		UPSTREAMS   []SyncGwUpstream
+		LISTEN_PORT int
+	}{
+		UPSTREAMS:   upstreams,
+		LISTEN_PORT: LB_LISTEN_PORT,
+	}
+
+	out := &bytes.Buffer{}
+	if err := tmpl.Execute(out, params); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+
+}
+
+// Render the load balancer config from the live sync gateway nodes and
+// write it to dest, unless it's unchanged.  Returns whether it was written.
+func (s SyncGwCluster) WriteLoadBalancerConfig(lbType, dest string) (bool, error) {
+
+	upstreams, err := s.FindSyncGwUpstreams()
+	if err != nil {
+		return false, err
+	}
+
+	config, err := RenderLoadBalancerConfig(lbType, upstreams)
+	if err != nil {
+		return false, err
+	}
+
+	existingConfig, err := ioutil.ReadFile(dest)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if string(existingConfig) == config {
+		log.Printf("Load balancer config unchanged (%v upstreams)", len(upstreams))
+		return false, nil
+	}
+
+	log.Printf("Writing %v config with %v upstreams to %v", lbType, len(upstreams), dest)
+	if err := WriteFileAtomic(dest, []byte(config), 0644); err != nil {
+		return false, err
+	}
+
+	return true, nil
+
+}
+
+// Rewrite the load balancer config whenever sync gateway nodes come or go,
+// and reload the load balancer.  Never returns.
+func (s SyncGwCluster) WatchLoadBalancerConfig(lbType, dest string, reloadHook SyncGwReloadHook) {
+
+	rewrite := func() {
+		changed, err := s.WriteLoadBalancerConfig(lbType, dest)
+		if err != nil {
+			log.Printf("Error writing load balancer config: %v.  Will retry on next change", err)
+			return
+		}
+		if !changed {
+			return
+		}
+		if err := reloadHook.Reload(dest); err != nil {
+			log.Printf("Error reloading load balancer: %v", err)
+		}
+	}
+
+	rewrite()
+
+	s.watchEtcdKeys(rewrite, KEY_SYNC_GW_NODE_STATE)
+
+}
+
+// A load balancer unit, and the params to render its template with
+type loadBalancerUnit struct {
+	unitName     string
+	unitFilePath string
+	params       interface{}
+}
+
+// Launch the load balancer unit, which renders its initial config at
+// startup, along with a sidekick that keeps the config up to date.  The
+// built in proxy keeps itself up to date, so it's just a single unit.
+func (s SyncGwCluster) LaunchLoadBalancer() error {
+
+	lbUnits, err := s.loadBalancerUnits()
+	if err != nil {
+		return err
+	}
+
+	for _, lbUnit := range lbUnits {
+		if err := launchFleetUnitFile(s.Templates, lbUnit.unitName, lbUnit.unitFilePath, lbUnit.params); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+func (s SyncGwCluster) loadBalancerUnits() ([]loadBalancerUnit, error) {
+
+	if err := ValidateLoadBalancerType(s.LoadBalancerType); err != nil {
+		return nil, err
+	}
+
+	if s.LoadBalancerType == LB_TYPE_PROXY {
+		params := struct {
+			CONTAINER_TAG string
+			LISTEN_PORT   int
+		}{
+			CONTAINER_TAG: s.ContainerTag,
+			LISTEN_PORT:   LB_LISTEN_PORT,
+		}
+		return []loadBalancerUnit{
+			{UNIT_NAME_LB, "data/sync_gw_proxy.service.template", params},
+		}, nil
+	}
+
+	lb := loadBalancerTypes[s.LoadBalancerType]
+
+	params := struct {
+		CONTAINER_TAG  string
+		LB_TYPE        string
+		LB_IMAGE       string
+		LB_CONFIG_FILE string
+		LB_CONFIG_DIR  string
+	}{
+		CONTAINER_TAG:  s.ContainerTag,
+		LB_TYPE:        s.LoadBalancerType,
+		LB_IMAGE:       lb.Image,
+		LB_CONFIG_FILE: lb.ConfigFile,
+		LB_CONFIG_DIR:  lb.ConfigDir,
+	}
+
+	return []loadBalancerUnit{
+		{UNIT_NAME_LB, "data/sync_gw_load_balancer.service.template", params},
+		{UNIT_NAME_LB_SIDEKICK, "data/sync_gw_load_balancer_sidekick.service.template", params},
+	}, nil
+
+}
+
+// Send a signal to a docker container via the docker api on the unix socket,
+// for when sync-gw-cluster itself is running in a container.
+func signalDockerContainer(containerName, signalName string) error {
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", DOCKER_SOCKET_PATH)
+			},
+		},
+	}
+
+	endpointUrl := fmt.Sprintf("http://docker/containers/%v/kill?signal=%v", containerName, signalName)
+	resp, err := client.Post(endpointUrl, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Failed to send %v to container %v.  Status code: %v.  Body: %v", signalName, containerName, resp.StatusCode, string(body))
+	}
+
+	return nil
+
+}
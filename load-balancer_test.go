@@ -0,0 +1,55 @@
+package cbcluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestParseSyncGwUpstream(t *testing.T) {
+
+	upstream := parseSyncGwUpstream("10.0.0.1", "10.0.0.1:4985")
+	assert.Equals(t, upstream.Ip, "10.0.0.1")
+	assert.Equals(t, upstream.Port, 4985)
+	assert.Equals(t, upstream.Name, "sync_gw_10_0_0_1")
+
+	upstream = parseSyncGwUpstream("10.0.0.1", `{"ip": "10.0.0.1", "port": 5984, "admin_port": 5985, "databases": ["todos"]}`)
+	assert.Equals(t, upstream.Port, 5984)
+	assert.Equals(t, upstream.AdminPort, 5985)
+	assert.Equals(t, upstream.Status, SYNC_GW_STATUS_HEALTHY)
+
+	upstream = parseSyncGwUpstream("10.0.0.1", `{"ip": "10.0.0.1", "port": 4984, "status": "unhealthy", "reason": "Database todos is Offline"}`)
+	assert.Equals(t, upstream.Status, SYNC_GW_STATUS_UNHEALTHY)
+
+	upstream = parseSyncGwUpstream("10.0.0.1", "garbage")
+	assert.Equals(t, upstream.Port, DEFAULT_SYNC_GW_PORT)
+
+}
+
+func TestRenderLoadBalancerConfig(t *testing.T) {
+
+	upstreams := []SyncGwUpstream{
+		parseSyncGwUpstream("10.0.0.1", "10.0.0.1:4984"),
+		parseSyncGwUpstream("10.0.0.2", "10.0.0.2:4984"),
+	}
+
+	config, err := RenderLoadBalancerConfig(LB_TYPE_NGINX, upstreams)
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(config, "server 10.0.0.1:4984 max_fails=3"))
+	assert.True(t, strings.Contains(config, "server 10.0.0.2:4984 max_fails=3"))
+	assert.True(t, strings.Contains(config, "proxy_set_header Upgrade $http_upgrade;"))
+
+	// nginx won't start with an empty upstream block
+	config, err = RenderLoadBalancerConfig(LB_TYPE_NGINX, []SyncGwUpstream{})
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(config, "server 127.0.0.1:4984 down;"))
+
+	config, err = RenderLoadBalancerConfig(LB_TYPE_HAPROXY, upstreams)
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(config, "server sync_gw_10_0_0_2 10.0.0.2:4984 check"))
+
+	_, err = RenderLoadBalancerConfig("apache", upstreams)
+	assert.True(t, err != nil)
+
+}
@@ -0,0 +1,284 @@
+package cbcluster
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_QUOTA_PERCENT = 75
+
+	// cgroup v1 reports a huge number (close to max int64) when there is no limit,
+	// so anything above this is treated as unlimited.
+	CGROUP_UNLIMITED_THRESHOLD_BYTES = int64(1) << 60
+)
+
+// These are vars rather than consts so that tests can point them at fixtures
+var (
+	PROC_MEMINFO_PATH = "/proc/meminfo"
+
+	// the node unit has docker write the id of the couchbase container here,
+	// and the sidekick unit mounts it along with the host's cgroup tree, since
+	// it's the couchbase container's memory limit that matters, not our own
+	NODE_CONTAINER_ID_PATH = "/var/run/couchbase-node/cid"
+	HOST_CGROUP_ROOT       = "/host/sys/fs/cgroup"
+
+	// where a container's memory limit lives under HOST_CGROUP_ROOT, depending
+	// on the cgroup version and the cgroup driver docker is using
+	CGROUP_V2_MEMORY_MAX_PATHS = []string{
+		"system.slice/docker-%v.scope/memory.max",
+		"docker/%v/memory.max",
+	}
+	CGROUP_V1_MEMORY_MAX_PATHS = []string{
+		"memory/system.slice/docker-%v.scope/memory.limit_in_bytes",
+		"memory/docker/%v/memory.limit_in_bytes",
+	}
+)
+
+// How much memory is available to this node, and where that number came from
+type MemoryInfo struct {
+	TotalMB int
+	Source  string
+}
+
+// How much of the available memory should be handed to couchbase server
+type QuotaPolicy struct {
+	Percent    int // percentage of the available memory (after the reserve)
+	AbsoluteMB int // if non-zero, use exactly this much and ignore the available memory
+	ReserveMB  int // memory to hold back for the OS and other processes
+}
+
+func DefaultQuotaPolicy() QuotaPolicy {
+	return QuotaPolicy{Percent: DEFAULT_QUOTA_PERCENT}
+}
+
+// Parse a quota policy from a comma separated list of rules, eg:
+//
+//	75%               -- 75% of available memory
+//	2048              -- exactly 2048 MB
+//	reserve:1024      -- all available memory except 1024 MB
+//	80%,reserve:512   -- 80% of what's left after reserving 512 MB
+func ParseQuotaPolicy(rawPolicy string) (QuotaPolicy, error) {
+
+	policy := QuotaPolicy{}
+
+	for _, rule := range strings.Split(rawPolicy, ",") {
+		rule = strings.TrimSpace(rule)
+		switch {
+		case rule == "":
+			continue
+		case strings.HasSuffix(rule, "%"):
+			percent, err := strconv.Atoi(strings.TrimSuffix(rule, "%"))
+			if err != nil || percent <= 0 || percent > 100 {
+				return policy, fmt.Errorf("Invalid quota percentage: %v", rule)
+			}
+			policy.Percent = percent
+		case strings.HasPrefix(rule, "reserve:"):
+			reserveMb, err := strconv.Atoi(strings.TrimPrefix(rule, "reserve:"))
+			if err != nil || reserveMb < 0 {
+				return policy, fmt.Errorf("Invalid quota reserve: %v", rule)
+			}
+			policy.ReserveMB = reserveMb
+		default:
+			absoluteMb, err := strconv.Atoi(rule)
+			if err != nil || absoluteMb <= 0 {
+				return policy, fmt.Errorf("Invalid quota rule: %v.  Expected N%%, reserve:MB or MB", rule)
+			}
+			policy.AbsoluteMB = absoluteMb
+		}
+	}
+
+	if policy.AbsoluteMB > 0 && (policy.Percent > 0 || policy.ReserveMB > 0) {
+		return policy, fmt.Errorf("An absolute quota can't be combined with a percentage or reserve: %v", rawPolicy)
+	}
+
+	// a reserve on its own means "everything except the reserve"
+	if policy.AbsoluteMB == 0 && policy.Percent == 0 {
+		if policy.ReserveMB > 0 {
+			policy.Percent = 100
+		} else {
+			policy.Percent = DEFAULT_QUOTA_PERCENT
+		}
+	}
+
+	return policy, nil
+
+}
+
+// Apply the policy to the memory available on the node
+func (p QuotaPolicy) ClusterRamMB(totalMb int) (int, error) {
+
+	if p.AbsoluteMB > 0 {
+		if totalMb > 0 && p.AbsoluteMB > totalMb {
+			log.Printf("Warning, quota of %v MB is more than the %v MB available", p.AbsoluteMB, totalMb)
+		}
+		return p.AbsoluteMB, nil
+	}
+
+	availableMb := totalMb - p.ReserveMB
+	if availableMb <= 0 {
+		return -1, fmt.Errorf("Reserving %v MB leaves no memory out of %v MB", p.ReserveMB, totalMb)
+	}
+
+	return (availableMb * p.Percent) / 100, nil
+
+}
+
+func (p QuotaPolicy) String() string {
+
+	if p.AbsoluteMB > 0 {
+		return fmt.Sprintf("%v MB", p.AbsoluteMB)
+	}
+	if p.ReserveMB > 0 {
+		return fmt.Sprintf("%v%% after reserving %v MB", p.Percent, p.ReserveMB)
+	}
+	return fmt.Sprintf("%v%%", p.Percent)
+
+}
+
+// Figure out how much memory is available to the couchbase container, taking
+// into account its cgroup limit if it was started with one.  The smallest of
+// the machine memory and the cgroup limit wins.
+func DetectMemory() (MemoryInfo, error) {
+
+	totalKb, err := readMemInfoTotalKb(PROC_MEMINFO_PATH)
+	if err != nil {
+		return MemoryInfo{}, err
+	}
+
+	memoryInfo := MemoryInfo{
+		TotalMB: int(totalKb / 1024),
+		Source:  PROC_MEMINFO_PATH,
+	}
+
+	cgroupPaths, err := nodeCgroupMemoryPaths()
+	if err != nil {
+		log.Printf("Warning, could not find the couchbase container: %v.  Any memory limit "+
+			"on it is not taken into account, use an absolute --memory-quota-policy "+
+			"if it has one", err)
+		return memoryInfo, nil
+	}
+
+	for _, cgroupPath := range cgroupPaths {
+
+		if _, err := os.Stat(cgroupPath); err != nil {
+			continue
+		}
+
+		limitBytes, found, err := readCgroupLimitBytes(cgroupPath)
+		if err != nil {
+			log.Printf("Ignoring cgroup memory limit in %v: %v", cgroupPath, err)
+			return memoryInfo, nil
+		}
+		if !found {
+			return memoryInfo, nil
+		}
+
+		limitMb := int(limitBytes / (1024 * 1024))
+		if limitMb < memoryInfo.TotalMB {
+			memoryInfo.TotalMB = limitMb
+			memoryInfo.Source = fmt.Sprintf("cgroup limit in %v", cgroupPath)
+		}
+		return memoryInfo, nil
+
+	}
+
+	log.Printf("Warning, no cgroup memory limit file found for the couchbase container under %v.  "+
+		"Any memory limit on it is not taken into account, use an absolute "+
+		"--memory-quota-policy if it has one", HOST_CGROUP_ROOT)
+
+	return memoryInfo, nil
+
+}
+
+// The cgroup files that could hold the couchbase container's memory limit,
+// cgroup v2 first
+func nodeCgroupMemoryPaths() ([]string, error) {
+
+	content, err := ioutil.ReadFile(NODE_CONTAINER_ID_PATH)
+	if err != nil {
+		return nil, err
+	}
+
+	containerId := strings.TrimSpace(string(content))
+	if containerId == "" {
+		return nil, fmt.Errorf("%v is empty", NODE_CONTAINER_ID_PATH)
+	}
+
+	cgroupPaths := []string{}
+	for _, cgroupPath := range append(CGROUP_V2_MEMORY_MAX_PATHS, CGROUP_V1_MEMORY_MAX_PATHS...) {
+		cgroupPath = fmt.Sprintf(cgroupPath, containerId)
+		cgroupPaths = append(cgroupPaths, filepath.Join(HOST_CGROUP_ROOT, cgroupPath))
+	}
+
+	return cgroupPaths, nil
+
+}
+
+// Find the MemTotal line in /proc/meminfo, eg "MemTotal:  3858400 kB"
+func readMemInfoTotalKb(memInfoPath string) (int64, error) {
+
+	file, err := os.Open(memInfoPath)
+	if err != nil {
+		return -1, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		totalKb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return -1, fmt.Errorf("Could not parse MemTotal in %v: %v", memInfoPath, err)
+		}
+		return totalKb, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return -1, err
+	}
+
+	return -1, fmt.Errorf("Could not find MemTotal in %v", memInfoPath)
+
+}
+
+// Read a cgroup memory limit.  Returns found=false if the file doesn't
+// exist or if there is no limit.
+func readCgroupLimitBytes(cgroupPath string) (limitBytes int64, found bool, err error) {
+
+	content, err := ioutil.ReadFile(cgroupPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, false, nil
+		}
+		return -1, false, err
+	}
+
+	rawLimit := strings.TrimSpace(string(content))
+
+	// cgroup v2 uses "max" to mean no limit
+	if rawLimit == "max" {
+		return -1, false, nil
+	}
+
+	limitBytes, err = strconv.ParseInt(rawLimit, 10, 64)
+	if err != nil {
+		return -1, false, fmt.Errorf("Could not parse limit %q", rawLimit)
+	}
+
+	if limitBytes <= 0 || limitBytes >= CGROUP_UNLIMITED_THRESHOLD_BYTES {
+		return -1, false, nil
+	}
+
+	return limitBytes, true, nil
+
+}
@@ -0,0 +1,110 @@
+package cbcluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+const testMemInfo = `MemTotal:        3858400 kB
+MemFree:          167384 kB
+MemAvailable:    2891748 kB
+`
+
+func TestParseQuotaPolicy(t *testing.T) {
+
+	policy, err := ParseQuotaPolicy("80%")
+	assert.True(t, err == nil)
+	ramMb, _ := policy.ClusterRamMB(1000)
+	assert.Equals(t, ramMb, 800)
+
+	policy, err = ParseQuotaPolicy("2048")
+	assert.True(t, err == nil)
+	ramMb, _ = policy.ClusterRamMB(1000)
+	assert.Equals(t, ramMb, 2048)
+
+	policy, err = ParseQuotaPolicy("reserve:1024")
+	assert.True(t, err == nil)
+	ramMb, _ = policy.ClusterRamMB(4096)
+	assert.Equals(t, ramMb, 3072)
+
+	policy, err = ParseQuotaPolicy("50%,reserve:1024")
+	assert.True(t, err == nil)
+	ramMb, _ = policy.ClusterRamMB(4096)
+	assert.Equals(t, ramMb, 1536)
+
+	_, err = policy.ClusterRamMB(512)
+	assert.True(t, err != nil)
+
+	_, err = ParseQuotaPolicy("2048,reserve:1024")
+	assert.True(t, err != nil)
+
+	_, err = ParseQuotaPolicy("150%")
+	assert.True(t, err != nil)
+
+}
+
+func TestDetectMemory(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "memory_test")
+	assert.True(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	defer func(memInfo, containerId, cgroupRoot string) {
+		PROC_MEMINFO_PATH = memInfo
+		NODE_CONTAINER_ID_PATH = containerId
+		HOST_CGROUP_ROOT = cgroupRoot
+	}(PROC_MEMINFO_PATH, NODE_CONTAINER_ID_PATH, HOST_CGROUP_ROOT)
+
+	PROC_MEMINFO_PATH = filepath.Join(dir, "meminfo")
+	NODE_CONTAINER_ID_PATH = filepath.Join(dir, "cid")
+	HOST_CGROUP_ROOT = filepath.Join(dir, "cgroup")
+
+	ioutil.WriteFile(PROC_MEMINFO_PATH, []byte(testMemInfo), 0644)
+
+	// no container id, use meminfo
+	memoryInfo, err := DetectMemory()
+	assert.True(t, err == nil)
+	assert.Equals(t, memoryInfo.TotalMB, 3767)
+	assert.Equals(t, memoryInfo.Source, PROC_MEMINFO_PATH)
+
+	// container id but no cgroup files, use meminfo
+	ioutil.WriteFile(NODE_CONTAINER_ID_PATH, []byte("abc123\n"), 0644)
+	memoryInfo, err = DetectMemory()
+	assert.True(t, err == nil)
+	assert.Equals(t, memoryInfo.TotalMB, 3767)
+
+	// cgroup v1 without a limit
+	cgroupV1Dir := filepath.Join(HOST_CGROUP_ROOT, "memory", "docker", "abc123")
+	os.MkdirAll(cgroupV1Dir, 0755)
+	ioutil.WriteFile(filepath.Join(cgroupV1Dir, "memory.limit_in_bytes"), []byte("9223372036854771712\n"), 0644)
+	memoryInfo, err = DetectMemory()
+	assert.True(t, err == nil)
+	assert.Equals(t, memoryInfo.TotalMB, 3767)
+
+	// cgroup v2 with a 1 GB limit
+	cgroupV2Dir := filepath.Join(HOST_CGROUP_ROOT, "system.slice", "docker-abc123.scope")
+	os.MkdirAll(cgroupV2Dir, 0755)
+	ioutil.WriteFile(filepath.Join(cgroupV2Dir, "memory.max"), []byte("1073741824\n"), 0644)
+	memoryInfo, err = DetectMemory()
+	assert.True(t, err == nil)
+	assert.Equals(t, memoryInfo.TotalMB, 1024)
+	assert.True(t, memoryInfo.Source != PROC_MEMINFO_PATH)
+
+	// cgroup v2 without a limit
+	ioutil.WriteFile(filepath.Join(cgroupV2Dir, "memory.max"), []byte("max\n"), 0644)
+	memoryInfo, err = DetectMemory()
+	assert.True(t, err == nil)
+	assert.Equals(t, memoryInfo.TotalMB, 3767)
+
+	// the limit of some other container doesn't count
+	ioutil.WriteFile(NODE_CONTAINER_ID_PATH, []byte("def456\n"), 0644)
+	ioutil.WriteFile(filepath.Join(cgroupV2Dir, "memory.max"), []byte("1073741824\n"), 0644)
+	memoryInfo, err = DetectMemory()
+	assert.True(t, err == nil)
+	assert.Equals(t, memoryInfo.TotalMB, 3767)
+
+}
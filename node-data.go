@@ -0,0 +1,107 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+)
+
+// The uuid of the cluster that the node at nodeIp belongs to, or empty if
+// the node hasn't been initialized.  Since /opt/couchbase/var is mounted
+// from the host, a restarted node still has the uuid of the cluster it
+// was in before.
+func (c CouchbaseCluster) ClusterUuid(nodeIp string) (string, error) {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools", nodeIp, c.LocalCouchbasePort)
+
+	// no credentials, since a node from another cluster may have
+	// a different password
+	pools := struct {
+		Uuid  json.RawMessage `json:"uuid"`
+		Pools []interface{}   `json:"pools"`
+	}{}
+	if err := getJsonData(endpointUrl, &pools); err != nil {
+		return "", err
+	}
+
+	if len(pools.Pools) == 0 {
+		return "", nil
+	}
+
+	// uninitialized nodes have an empty list rather than a string
+	uuid := ""
+	if err := json.Unmarshal(pools.Uuid, &uuid); err != nil {
+		return "", nil
+	}
+
+	return uuid, nil
+
+}
+
+// Whether the local node is coming back with data and cluster config from
+// an earlier run.  If it is, it must have been in the same cluster as the
+// live node, otherwise it would take its data into a different cluster, or
+// fail to join it in confusing ways.
+func (c CouchbaseCluster) IsRejoiningCluster(liveNodeIp string) (bool, error) {
+
+	localUuid, err := c.ClusterUuid(c.LocalCouchbaseIp)
+	if err != nil {
+		return false, err
+	}
+	if localUuid == "" {
+		log.Printf("Local node has no existing cluster config, joining as a new node")
+		return false, nil
+	}
+
+	liveUuid, err := c.ClusterUuid(liveNodeIp)
+	if err != nil {
+		return false, err
+	}
+
+	if localUuid != liveUuid {
+		return false, fmt.Errorf("Node %v has existing data from cluster %v, but the live node %v is in cluster %v.  "+
+			"Refusing to join a different cluster.  To join it as a new node, remove the node's data in /opt/couchbase/var",
+			c.LocalCouchbaseIp, localUuid, liveNodeIp, liveUuid)
+	}
+
+	log.Printf("Local node has existing data from cluster %v, which is the live cluster", localUuid)
+	return true, nil
+
+}
+
+// Bring a node that was already in the cluster back into it.  A node that
+// was failed over while it was down is marked for delta recovery, so that
+// the rebalance that follows keeps its data rather than ejecting it.
+func (c CouchbaseCluster) RejoinCluster(liveNodeIp string) error {
+
+	nodeMap, err := c.GetLocalClusterNode(liveNodeIp)
+	if err != nil {
+		return fmt.Errorf("Node %v has data from this cluster, but is no longer a member of it.  "+
+			"To join it as a new node, remove the node's data in /opt/couchbase/var.  Error: %v",
+			c.LocalCouchbaseIp, err)
+	}
+
+	if nodeMap["clusterMembership"] == "inactiveFailed" {
+
+		otpNode, ok := nodeMap["otpNode"].(string)
+		if !ok {
+			return fmt.Errorf("No otpNode string found")
+		}
+
+		log.Printf("Node %v was failed over, setting delta recovery", otpNode)
+
+		endpointUrl := fmt.Sprintf("http://%v:%v/controller/setRecoveryType", liveNodeIp, c.LocalCouchbasePort)
+		data := url.Values{
+			"otpNode":      {otpNode},
+			"recoveryType": {"delta"},
+		}
+		if err := c.POST(false, endpointUrl, data); err != nil {
+			return err
+		}
+
+	}
+
+	return c.WaitUntilInClusterAndHealthy(liveNodeIp)
+
+}
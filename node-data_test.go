@@ -0,0 +1,43 @@
+package cbcluster
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestClusterUuid(t *testing.T) {
+
+	pools := `{"pools": [], "uuid": []}`
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(pools))
+	}))
+	defer node.Close()
+
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	c := CouchbaseCluster{LocalCouchbaseIp: host, LocalCouchbasePort: port}
+
+	// a fresh node
+	uuid, err := c.ClusterUuid(host)
+	assert.True(t, err == nil)
+	assert.Equals(t, uuid, "")
+
+	rejoining, err := c.IsRejoiningCluster(host)
+	assert.True(t, err == nil)
+	assert.False(t, rejoining)
+
+	// a node that came back with its data
+	pools = `{"pools": [{"name": "default"}], "uuid": "2a8f4b1e"}`
+	uuid, err = c.ClusterUuid(host)
+	assert.True(t, err == nil)
+	assert.Equals(t, uuid, "2a8f4b1e")
+
+	rejoining, err = c.IsRejoiningCluster(host)
+	assert.True(t, err == nil)
+	assert.True(t, rejoining)
+
+}
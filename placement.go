@@ -0,0 +1,187 @@
+package cbcluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/fleet/schema"
+)
+
+// Which fleet machines the node units can be scheduled on.  Metadata
+// constraints are passed through to fleet as MachineMetadata, eg
+// role=couchbase.  Giving the same key more than once allows any of the
+// values, as in fleet.  If SpreadBy is set, eg to zone, each unit is
+// pinned to one of the values of that key, round robin by unit number,
+// so that the units are spread across them.  With ServerGroups, each node
+// also joins the couchbase server group named after its SpreadBy value.
+type MachinePlacement struct {
+	Metadata     []string // key=value
+	SpreadBy     string
+	ServerGroups bool
+
+	// the distinct SpreadBy values of the eligible machines, set by Resolve
+	spreadValues []string
+}
+
+func ParseMachinePlacement(rawMetadata []string, spreadBy string) (MachinePlacement, error) {
+
+	placement := MachinePlacement{SpreadBy: strings.TrimSpace(spreadBy)}
+
+	for _, rawMetadatum := range rawMetadata {
+		key, value, err := parseMachineMetadatum(rawMetadatum)
+		if err != nil {
+			return placement, err
+		}
+		placement.Metadata = append(placement.Metadata, fmt.Sprintf("%v=%v", key, value))
+	}
+
+	return placement, nil
+
+}
+
+func parseMachineMetadatum(rawMetadatum string) (key, value string, err error) {
+	components := strings.SplitN(rawMetadatum, "=", 2)
+	if len(components) != 2 || strings.TrimSpace(components[0]) == "" || strings.TrimSpace(components[1]) == "" {
+		return "", "", fmt.Errorf("Invalid machine metadata: %v.  Expected key=value", rawMetadatum)
+	}
+	return strings.TrimSpace(components[0]), strings.TrimSpace(components[1]), nil
+}
+
+// Whether the machine satisfies every metadata key
+func (p MachinePlacement) Eligible(machine *schema.Machine) bool {
+
+	allowedValues := map[string][]string{}
+	for _, metadatum := range p.Metadata {
+		key, value, _ := parseMachineMetadatum(metadatum)
+		allowedValues[key] = append(allowedValues[key], value)
+	}
+
+	for key, values := range allowedValues {
+		if !containsString(values, machine.Metadata[key]) {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+func (p MachinePlacement) EligibleMachines(machines []*schema.Machine) []*schema.Machine {
+	eligible := []*schema.Machine{}
+	for _, machine := range machines {
+		if p.Eligible(machine) {
+			eligible = append(eligible, machine)
+		}
+	}
+	return eligible
+}
+
+// Work out the values to spread across from the machines fleet has
+func (p MachinePlacement) Resolve(machines []*schema.Machine) MachinePlacement {
+
+	if p.SpreadBy == "" {
+		return p
+	}
+
+	seen := map[string]bool{}
+	p.spreadValues = []string{}
+	for _, machine := range p.EligibleMachines(machines) {
+		value := machine.Metadata[p.SpreadBy]
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		p.spreadValues = append(p.spreadValues, value)
+	}
+	sort.Strings(p.spreadValues)
+
+	return p
+
+}
+
+// The MachineMetadata values for the given unit.  For a unit file
+// template (unit number %i) there's nothing to spread by.
+func (p MachinePlacement) UnitMetadata(unitNumber string) []string {
+
+	metadata := append([]string{}, p.Metadata...)
+
+	number, err := strconv.Atoi(unitNumber)
+	if err != nil || len(p.spreadValues) == 0 {
+		return metadata
+	}
+
+	spreadValue := p.spreadValues[(number-1)%len(p.spreadValues)]
+	return append(metadata, fmt.Sprintf("%v=%v", p.SpreadBy, spreadValue))
+
+}
+
+// The server group (zone) for the given unit, or empty if server groups
+// aren't being used
+func (p MachinePlacement) UnitServerGroup(unitNumber string) string {
+
+	if !p.ServerGroups {
+		return ""
+	}
+
+	number, err := strconv.Atoi(unitNumber)
+	if err != nil || len(p.spreadValues) == 0 {
+		return ""
+	}
+
+	return p.spreadValues[(number-1)%len(p.spreadValues)]
+
+}
+
+// Make sure there are enough eligible machines for the given unit numbers,
+// at most one unit per machine.  When spreading, each value needs enough
+// machines for the units pinned to it.
+func (p MachinePlacement) VerifyEnoughMachines(unitNumbers []int, machines []*schema.Machine) error {
+
+	eligible := p.EligibleMachines(machines)
+
+	if len(unitNumbers) > len(eligible) {
+		if len(p.Metadata) > 0 {
+			return fmt.Errorf("User requested %v nodes, only %v available matching %v (out of %v machines)", len(unitNumbers), len(eligible), strings.Join(p.Metadata, ","), len(machines))
+		}
+		return fmt.Errorf("User requested %v nodes, only %v available", len(unitNumbers), len(eligible))
+	}
+
+	if p.SpreadBy == "" {
+		return nil
+	}
+
+	if len(p.spreadValues) == 0 {
+		return fmt.Errorf("No eligible machines have a value for %v to spread across", p.SpreadBy)
+	}
+
+	available := map[string]int{}
+	for _, machine := range eligible {
+		available[machine.Metadata[p.SpreadBy]] += 1
+	}
+
+	needed := map[string]int{}
+	for _, unitNumber := range unitNumbers {
+		spreadValue := p.spreadValues[(unitNumber-1)%len(p.spreadValues)]
+		needed[spreadValue] += 1
+	}
+
+	for _, spreadValue := range p.spreadValues {
+		if needed[spreadValue] > available[spreadValue] {
+			return fmt.Errorf("%v nodes would be placed in %v=%v, which only has %v eligible machines", needed[spreadValue], p.SpreadBy, spreadValue, available[spreadValue])
+		}
+	}
+
+	return nil
+
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package cbcluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreos/fleet/schema"
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestMachinePlacement(t *testing.T) {
+
+	machines := []*schema.Machine{
+		{Id: "m1", PrimaryIP: "10.0.0.1", Metadata: map[string]string{"role": "couchbase", "zone": "us-east-1a"}},
+		{Id: "m2", PrimaryIP: "10.0.0.2", Metadata: map[string]string{"role": "couchbase", "zone": "us-east-1b"}},
+		{Id: "m3", PrimaryIP: "10.0.0.3", Metadata: map[string]string{"role": "couchbase", "zone": "us-east-1a"}},
+		{Id: "m4", PrimaryIP: "10.0.0.4", Metadata: map[string]string{"role": "sync-gateway", "zone": "us-east-1b"}},
+	}
+
+	placement, err := ParseMachinePlacement([]string{"role=couchbase"}, "zone")
+	assert.True(t, err == nil)
+	assert.Equals(t, len(placement.EligibleMachines(machines)), 3)
+
+	placement = placement.Resolve(machines)
+	assert.Equals(t, strings.Join(placement.UnitMetadata("1"), ","), "role=couchbase,zone=us-east-1a")
+	assert.Equals(t, strings.Join(placement.UnitMetadata("2"), ","), "role=couchbase,zone=us-east-1b")
+	assert.Equals(t, strings.Join(placement.UnitMetadata("3"), ","), "role=couchbase,zone=us-east-1a")
+	assert.Equals(t, strings.Join(placement.UnitMetadata("%i"), ","), "role=couchbase")
+
+	assert.True(t, placement.VerifyEnoughMachines([]int{1, 2, 3}, machines) == nil)
+
+	// unit 4 would be the second one in us-east-1b, which only has one couchbase machine
+	assert.True(t, placement.VerifyEnoughMachines([]int{1, 2, 3, 4}, machines) != nil)
+
+	// the same key more than once allows any of the values
+	placement, _ = ParseMachinePlacement([]string{"role=couchbase", "role=sync-gateway"}, "")
+	assert.True(t, placement.VerifyEnoughMachines([]int{1, 2, 3, 4}, machines) == nil)
+
+	_, err = ParseMachinePlacement([]string{"role"}, "")
+	assert.True(t, err != nil)
+
+}
+
+func TestGenerateNodeFleetUnitFileMachineMetadata(t *testing.T) {
+
+	placement, _ := ParseMachinePlacement([]string{"role=couchbase"}, "")
+	c := CouchbaseFleet{CbVersion: "community-3.0.1", Placement: placement}
+
+	unitFile, err := c.generateNodeFleetUnitFile("1")
+	assert.True(t, err == nil)
+
+	constraints, err := fleetConstraints(unitFile)
+	assert.True(t, err == nil)
+	assert.Equals(t, strings.Join(constraints, ","), "Conflicts=couchbase_node*.service,MachineMetadata=role=couchbase")
+
+}
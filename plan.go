@@ -0,0 +1,155 @@
+package cbcluster
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/coreos/go-systemd/unit"
+)
+
+// What a launch would do, for --dry-run.  Built from the same unit
+// generators as the real launch, so the rendered units are exactly what
+// would be sent to fleet.
+type LaunchPlan struct {
+	Machines []string // machines available in fleet, eg 10.0.0.1 (id a91c3944)
+	EtcdKeys []PlannedEtcdKey
+	Units    []PlannedUnit
+	Buckets  []PlannedBucket
+	Warnings []string // eg checks that would make the launch fail
+}
+
+type PlannedEtcdKey struct {
+	Key   string
+	Value string
+}
+
+type PlannedUnit struct {
+	Name        string
+	Content     string   // the rendered unit file
+	Json        string   // what would be PUT to the fleet api
+	Constraints []string // the [X-Fleet] options, eg Conflicts=couchbase_node*.service
+}
+
+type PlannedBucket struct {
+	Name          string
+	RamQuotaMB    int
+	ReplicaNumber int
+}
+
+func (p *LaunchPlan) AddEtcdKey(key, value string) {
+	p.EtcdKeys = append(p.EtcdKeys, PlannedEtcdKey{Key: key, Value: value})
+}
+
+// Add a unit, rendering its json and pulling out its fleet constraints
+func (p *LaunchPlan) AddUnit(unitName, unitFile string) error {
+
+	jsonBytes, err := unitFileToJson(unitFile)
+	if err != nil {
+		return fmt.Errorf("Invalid unit file for %v: %v", unitName, err)
+	}
+
+	constraints, err := fleetConstraints(unitFile)
+	if err != nil {
+		return err
+	}
+
+	p.Units = append(p.Units, PlannedUnit{
+		Name:        unitName,
+		Content:     unitFile,
+		Json:        string(jsonBytes),
+		Constraints: constraints,
+	})
+
+	return nil
+
+}
+
+func (p *LaunchPlan) AddWarning(format string, args ...interface{}) {
+	p.Warnings = append(p.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Record the machines available in fleet.  Failing to reach fleet isn't an
+// error for a plan, since it may be made from somewhere that can't.
+func (p *LaunchPlan) AddFleetMachines() {
+
+	machines, err := findAllFleetMachines()
+	if err != nil {
+		p.AddWarning("Could not list fleet machines: %v", err)
+		return
+	}
+
+	for _, machine := range machines {
+		p.Machines = append(p.Machines, fmt.Sprintf("%v (id %v)", machine.PrimaryIP, machine.Id))
+	}
+
+}
+
+func (p LaunchPlan) Print(w io.Writer) {
+
+	fmt.Fprintf(w, "Dry run, nothing will be changed.  Plan:\n")
+
+	fmt.Fprintf(w, "\nFleet machines available: %v\n", len(p.Machines))
+	for _, machine := range p.Machines {
+		fmt.Fprintf(w, "  %v\n", machine)
+	}
+
+	fmt.Fprintf(w, "\nEtcd keys to set: %v\n", len(p.EtcdKeys))
+	for _, etcdKey := range p.EtcdKeys {
+		fmt.Fprintf(w, "  %v = %v\n", etcdKey.Key, etcdKey.Value)
+	}
+
+	fmt.Fprintf(w, "\nBuckets to create: %v\n", len(p.Buckets))
+	for _, bucket := range p.Buckets {
+		fmt.Fprintf(w, "  %v (%v MB, %v replicas)\n", bucket.Name, bucket.RamQuotaMB, bucket.ReplicaNumber)
+	}
+
+	fmt.Fprintf(w, "\nUnits to create: %v\n", len(p.Units))
+	for _, plannedUnit := range p.Units {
+		fmt.Fprintf(w, "\n=== %v\n", plannedUnit.Name)
+		if len(plannedUnit.Constraints) == 0 {
+			fmt.Fprintf(w, "Machine constraints: none, can run on any machine\n")
+		} else {
+			fmt.Fprintf(w, "Machine constraints: %v\n", strings.Join(plannedUnit.Constraints, ", "))
+		}
+		fmt.Fprintf(w, "--- unit file\n%v\n", strings.TrimSpace(plannedUnit.Content))
+		fmt.Fprintf(w, "--- json\n%v\n", plannedUnit.Json)
+	}
+
+	if len(p.Warnings) > 0 {
+		fmt.Fprintf(w, "\nWarnings: %v\n", len(p.Warnings))
+		for _, warning := range p.Warnings {
+			fmt.Fprintf(w, "  %v\n", warning)
+		}
+	}
+
+}
+
+// The [X-Fleet] options in the unit file, which decide which machines
+// fleet can schedule it on
+func fleetConstraints(unitFile string) ([]string, error) {
+
+	opts, err := unit.Deserialize(strings.NewReader(unitFile))
+	if err != nil {
+		return nil, err
+	}
+
+	constraints := []string{}
+	for _, opt := range opts {
+		if opt.Section == "X-Fleet" {
+			constraints = append(constraints, fmt.Sprintf("%v=%v", opt.Name, opt.Value))
+		}
+	}
+
+	return constraints, nil
+
+}
+
+// Hide the password part of user:pass
+func maskUserPass(userPass string) string {
+	components := strings.SplitN(userPass, ":", 2)
+	if len(components) != 2 {
+		return "********"
+	}
+	return fmt.Sprintf("%v:********", components[0])
+}
@@ -0,0 +1,36 @@
+package cbcluster
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestLaunchPlan(t *testing.T) {
+
+	c := CouchbaseFleet{CbVersion: "community-3.0.1", ContainerTag: "latest"}
+
+	plan := LaunchPlan{}
+	plan.AddEtcdKey(KEY_USER_PASS, maskUserPass("user:passw0rd"))
+
+	nodeUnitFile, err := c.generateNodeFleetUnitFile("1")
+	assert.True(t, err == nil)
+	assert.True(t, plan.AddUnit("couchbase_node@1.service", nodeUnitFile) == nil)
+
+	sidekickUnitFile, err := c.generateSidekickFleetUnitFile("1")
+	assert.True(t, err == nil)
+	assert.True(t, plan.AddUnit("couchbase_sidekick@1.service", sidekickUnitFile) == nil)
+
+	assert.Equals(t, len(plan.Units), 2)
+	assert.Equals(t, plan.Units[0].Constraints[0], "Conflicts=couchbase_node*.service")
+	assert.Equals(t, plan.Units[1].Constraints[0], "MachineOf=couchbase_node@1.service")
+
+	out := &bytes.Buffer{}
+	plan.Print(out)
+	assert.True(t, strings.Contains(out.String(), "/couchbase.com/userpass = user:********"))
+	assert.False(t, strings.Contains(out.String(), "passw0rd"))
+	assert.True(t, strings.Contains(out.String(), "=== couchbase_sidekick@1.service"))
+
+}
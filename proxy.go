@@ -0,0 +1,307 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// cookie used to send a client back to the same sync gateway
+	PROXY_STICKY_COOKIE = "SyncGwProxyBackend"
+
+	// sync gateway database names can't start with an underscore,
+	// so this won't collide with anything sync gateway serves
+	PROXY_STATS_PATH = "/_sgw_proxy/stats"
+
+	PROXY_HEALTH_CHECK_SECONDS = 5
+	PROXY_HEALTH_CHECK_TIMEOUT = 2 * time.Second
+
+	// continuous _changes feeds need to be streamed to the client
+	PROXY_FLUSH_INTERVAL = 100 * time.Millisecond
+)
+
+// A reverse proxy that load balances across the sync gateways
+// registered in etcd, as an alternative to nginx or haproxy.
+type SyncGwProxy struct {
+	SyncGwCluster *SyncGwCluster
+	ListenAddr    string
+
+	mutex    sync.RWMutex
+	backends map[string]*proxyBackend // keyed by upstream name
+}
+
+type proxyBackend struct {
+	upstream     SyncGwUpstream
+	reverseProxy *httputil.ReverseProxy
+
+	healthy        int32 // accessed atomically, 1 = healthy
+	activeRequests int64 // accessed atomically
+	totalRequests  int64 // accessed atomically
+	failedRequests int64 // accessed atomically
+}
+
+// Per-backend stats served at PROXY_STATS_PATH
+type ProxyBackendStats struct {
+	Name           string `json:"name"`
+	Address        string `json:"address"`
+	Healthy        bool   `json:"healthy"`
+	ActiveRequests int64  `json:"active_requests"`
+	TotalRequests  int64  `json:"total_requests"`
+	FailedRequests int64  `json:"failed_requests"`
+}
+
+func NewSyncGwProxy(syncGwCluster *SyncGwCluster, listenAddr string) *SyncGwProxy {
+	return &SyncGwProxy{
+		SyncGwCluster: syncGwCluster,
+		ListenAddr:    listenAddr,
+		backends:      map[string]*proxyBackend{},
+	}
+}
+
+// Start proxying.  Blocks until the http server fails.
+func (p *SyncGwProxy) ListenAndServe() error {
+
+	if err := p.refreshBackends(); err != nil {
+		log.Printf("Error finding sync gateways: %v.  Will retry on next change", err)
+	}
+
+	go p.SyncGwCluster.watchEtcdKeys(func() {
+		if err := p.refreshBackends(); err != nil {
+			log.Printf("Error finding sync gateways: %v", err)
+		}
+	}, KEY_SYNC_GW_NODE_STATE)
+
+	go p.healthCheckLoop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PROXY_STATS_PATH, p.serveStats)
+	mux.Handle("/", p)
+
+	// no read or write timeouts, since _changes feeds are long lived
+	server := &http.Server{
+		Addr:    p.ListenAddr,
+		Handler: mux,
+	}
+
+	log.Printf("Sync gw proxy listening on %v", p.ListenAddr)
+	return server.ListenAndServe()
+
+}
+
+// Sync the backends with the sync gateways in etcd.  Backends whose key
+// expired are removed, and new ones are added as healthy.
+func (p *SyncGwProxy) refreshBackends() error {
+
+	upstreams, err := p.SyncGwCluster.FindSyncGwUpstreams()
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	live := map[string]bool{}
+	for _, upstream := range upstreams {
+		live[upstream.Name] = true
+		if existing, ok := p.backends[upstream.Name]; ok && existing.upstream == upstream {
+			continue
+		}
+		log.Printf("Adding backend %v (%v:%v)", upstream.Name, upstream.Ip, upstream.Port)
+		p.backends[upstream.Name] = p.newBackend(upstream)
+	}
+
+	for name := range p.backends {
+		if !live[name] {
+			log.Printf("Removing backend %v", name)
+			delete(p.backends, name)
+		}
+	}
+
+	return nil
+
+}
+
+func (p *SyncGwProxy) newBackend(upstream SyncGwUpstream) *proxyBackend {
+
+	backend := &proxyBackend{
+		upstream: upstream,
+		healthy:  1,
+	}
+
+	target := &url.URL{
+		Scheme: "http",
+		Host:   fmt.Sprintf("%v:%v", upstream.Ip, upstream.Port),
+	}
+	backend.reverseProxy = httputil.NewSingleHostReverseProxy(target)
+	backend.reverseProxy.FlushInterval = PROXY_FLUSH_INTERVAL
+	backend.reverseProxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		// the client went away, eg a longpoll _changes request that was
+		// cancelled, which says nothing about the backend.  Leave that to
+		// the health checks.
+		if req.Context().Err() != nil {
+			return
+		}
+		log.Printf("Error proxying to %v: %v.  Marking unhealthy", upstream.Name, err)
+		atomic.AddInt64(&backend.failedRequests, 1)
+		atomic.StoreInt32(&backend.healthy, 0)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	return backend
+
+}
+
+func (p *SyncGwProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	backend := p.chooseBackend(req)
+	if backend == nil {
+		http.Error(w, "No healthy sync gateways available", http.StatusServiceUnavailable)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     PROXY_STICKY_COOKIE,
+		Value:    backend.upstream.Name,
+		Path:     "/",
+		HttpOnly: true,
+	})
+
+	atomic.AddInt64(&backend.activeRequests, 1)
+	atomic.AddInt64(&backend.totalRequests, 1)
+	defer atomic.AddInt64(&backend.activeRequests, -1)
+
+	backend.reverseProxy.ServeHTTP(w, req)
+
+}
+
+// Use the backend from the sticky cookie if it's still healthy, otherwise
+// the healthy backend with the fewest active requests.
+func (p *SyncGwProxy) chooseBackend(req *http.Request) *proxyBackend {
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if cookie, err := req.Cookie(PROXY_STICKY_COOKIE); err == nil {
+		if backend, ok := p.backends[cookie.Value]; ok && backend.isHealthy() {
+			return backend
+		}
+	}
+
+	var chosen *proxyBackend
+	for _, name := range p.sortedBackendNames() {
+		backend := p.backends[name]
+		if !backend.isHealthy() {
+			continue
+		}
+		if chosen == nil || atomic.LoadInt64(&backend.activeRequests) < atomic.LoadInt64(&chosen.activeRequests) {
+			chosen = backend
+		}
+	}
+
+	return chosen
+
+}
+
+func (p *SyncGwProxy) healthCheckLoop() {
+
+	client := &http.Client{Timeout: PROXY_HEALTH_CHECK_TIMEOUT}
+
+	for {
+
+		p.mutex.RLock()
+		backends := []*proxyBackend{}
+		for _, backend := range p.backends {
+			backends = append(backends, backend)
+		}
+		p.mutex.RUnlock()
+
+		for _, backend := range backends {
+			backend.healthCheck(client)
+		}
+
+		<-time.After(time.Second * PROXY_HEALTH_CHECK_SECONDS)
+
+	}
+
+}
+
+func (b *proxyBackend) healthCheck(client *http.Client) {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/", b.upstream.Ip, b.upstream.Port)
+
+	healthy := false
+	resp, err := client.Get(endpointUrl)
+	if err == nil {
+		resp.Body.Close()
+		healthy = resp.StatusCode == 200
+	}
+
+	wasHealthy := b.isHealthy()
+	switch {
+	case healthy && !wasHealthy:
+		log.Printf("Backend %v is healthy again", b.upstream.Name)
+		atomic.StoreInt32(&b.healthy, 1)
+	case !healthy && wasHealthy:
+		log.Printf("Backend %v failed health check (err: %v).  Marking unhealthy", b.upstream.Name, err)
+		atomic.StoreInt32(&b.healthy, 0)
+	}
+
+}
+
+func (b *proxyBackend) isHealthy() bool {
+	return atomic.LoadInt32(&b.healthy) == 1
+}
+
+func (b *proxyBackend) stats() ProxyBackendStats {
+	return ProxyBackendStats{
+		Name:           b.upstream.Name,
+		Address:        fmt.Sprintf("%v:%v", b.upstream.Ip, b.upstream.Port),
+		Healthy:        b.isHealthy(),
+		ActiveRequests: atomic.LoadInt64(&b.activeRequests),
+		TotalRequests:  atomic.LoadInt64(&b.totalRequests),
+		FailedRequests: atomic.LoadInt64(&b.failedRequests),
+	}
+}
+
+// The stats for each backend, sorted by name
+func (p *SyncGwProxy) Stats() []ProxyBackendStats {
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	stats := []ProxyBackendStats{}
+	for _, name := range p.sortedBackendNames() {
+		stats = append(stats, p.backends[name].stats())
+	}
+	return stats
+
+}
+
+func (p *SyncGwProxy) serveStats(w http.ResponseWriter, req *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.Stats()); err != nil {
+		log.Printf("Error writing proxy stats: %v", err)
+	}
+
+}
+
+// must be called with the mutex held
+func (p *SyncGwProxy) sortedBackendNames() []string {
+
+	names := []string{}
+	for name := range p.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+
+}
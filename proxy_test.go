@@ -0,0 +1,95 @@
+package cbcluster
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func newTestProxy(addrs ...string) *SyncGwProxy {
+
+	p := NewSyncGwProxy(nil, ":0")
+	for _, addr := range addrs {
+		host, portStr, _ := net.SplitHostPort(addr)
+		port, _ := strconv.Atoi(portStr)
+		upstream := SyncGwUpstream{Name: "sync_gw_" + portStr, Ip: host, Port: port}
+		p.backends[upstream.Name] = p.newBackend(upstream)
+	}
+	return p
+
+}
+
+func TestProxyChooseBackend(t *testing.T) {
+
+	p := newTestProxy("10.0.0.1:4984", "10.0.0.2:4985")
+	req, _ := http.NewRequest("GET", "/db/_changes", nil)
+
+	// fewest active requests wins
+	p.backends["sync_gw_4984"].activeRequests = 2
+	assert.Equals(t, p.chooseBackend(req).upstream.Name, "sync_gw_4985")
+
+	// sticky cookie wins
+	req.AddCookie(&http.Cookie{Name: PROXY_STICKY_COOKIE, Value: "sync_gw_4984"})
+	assert.Equals(t, p.chooseBackend(req).upstream.Name, "sync_gw_4984")
+
+	// unless that backend is unhealthy
+	p.backends["sync_gw_4984"].healthy = 0
+	assert.Equals(t, p.chooseBackend(req).upstream.Name, "sync_gw_4985")
+
+	p.backends["sync_gw_4985"].healthy = 0
+	assert.True(t, p.chooseBackend(req) == nil)
+
+}
+
+func TestProxyServeHTTP(t *testing.T) {
+
+	syncGw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"couchdb":"Welcome"}`))
+	}))
+	defer syncGw.Close()
+
+	p := newTestProxy(syncGw.Listener.Addr().String())
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	p.ServeHTTP(recorder, req)
+	assert.Equals(t, recorder.Code, 200)
+	assert.Equals(t, recorder.Body.String(), `{"couchdb":"Welcome"}`)
+
+	stats := []ProxyBackendStats{}
+	recorder = httptest.NewRecorder()
+	p.serveStats(recorder, req)
+	assert.True(t, json.Unmarshal(recorder.Body.Bytes(), &stats) == nil)
+	assert.Equals(t, len(stats), 1)
+	assert.Equals(t, stats[0].TotalRequests, int64(1))
+	assert.Equals(t, stats[0].ActiveRequests, int64(0))
+
+}
+
+func TestProxyClientCancelLeavesBackendHealthy(t *testing.T) {
+
+	// a longpoll _changes feed that never returns by itself
+	syncGw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer syncGw.Close()
+
+	p := newTestProxy(syncGw.Listener.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "/db/_changes?feed=longpoll", nil)
+	p.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+	backend := p.backends["sync_gw_"+strconv.Itoa(syncGw.Listener.Addr().(*net.TCPAddr).Port)]
+	assert.True(t, backend.isHealthy())
+	assert.Equals(t, backend.failedRequests, int64(0))
+
+}
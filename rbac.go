@@ -0,0 +1,187 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+)
+
+const (
+	// optional json list of RbacUsers, created by the node that
+	// bootstraps the cluster, eg:
+	// [{"username": "sync_gateway", "password": "...", "roles": ["bucket_full_access[default]"]}]
+	KEY_RBAC_USERS = "/couchbase.com/users"
+)
+
+// A local (couchbase managed) user and the roles bound to it, eg admin,
+// or bucket_full_access[default] for a role on a single bucket
+type RbacUser struct {
+	Username string   `json:"username"`
+	Name     string   `json:"name,omitempty"` // full name
+	Password string   `json:"password,omitempty"`
+	Roles    []string `json:"roles"`
+}
+
+// Parse roles like "bucket_full_access[default],query_select[*]"
+func ParseRbacRoles(rawRoles string) ([]string, error) {
+
+	roles := []string{}
+	for _, role := range strings.Split(rawRoles, ",") {
+		role = strings.TrimSpace(role)
+		if role == "" {
+			continue
+		}
+		roles = append(roles, role)
+	}
+
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("At least one role is required")
+	}
+
+	return roles, nil
+
+}
+
+func (u RbacUser) Validate() error {
+	if u.Username == "" {
+		return fmt.Errorf("A username is required")
+	}
+	if len(u.Roles) == 0 {
+		return fmt.Errorf("User %v needs at least one role", u.Username)
+	}
+	return nil
+}
+
+// Whether the cluster has role based access control, rather than a single
+// admin plus per-bucket passwords
+func (c CouchbaseCluster) SupportsRbac() (bool, error) {
+
+	version, err := c.CouchbaseVersion()
+	if err != nil {
+		return false, err
+	}
+
+	return version.Supports(CAPABILITY_RBAC), nil
+
+}
+
+func (c CouchbaseCluster) rbacUserUrl(liveNodeIp, username string) string {
+	return fmt.Sprintf("http://%v:%v/settings/rbac/users/local/%v", liveNodeIp, c.LocalCouchbasePort, url.QueryEscape(username))
+}
+
+// Create the user, or replace its name, password and roles if it exists
+func (c CouchbaseCluster) UpsertRbacUser(liveNodeIp string, user RbacUser) error {
+
+	if err := user.Validate(); err != nil {
+		return err
+	}
+
+	log.Printf("Creating user %v with roles %v", user.Username, user.Roles)
+
+	data := url.Values{
+		"roles": {strings.Join(user.Roles, ",")},
+	}
+	if user.Name != "" {
+		data.Set("name", user.Name)
+	}
+	if user.Password != "" {
+		data.Set("password", user.Password)
+	}
+
+	return c.PUTForm(c.rbacUserUrl(liveNodeIp, user.Username), data)
+
+}
+
+func (c CouchbaseCluster) DeleteRbacUser(liveNodeIp, username string) error {
+	log.Printf("Deleting user %v", username)
+	return c.DELETE(c.rbacUserUrl(liveNodeIp, username))
+}
+
+// The local users, with their roles in the same form they're given in
+func (c CouchbaseCluster) GetRbacUsers(liveNodeIp string) ([]RbacUser, error) {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/settings/rbac/users/local", liveNodeIp, c.LocalCouchbasePort)
+
+	rawUsers := []struct {
+		Id    string `json:"id"`
+		Name  string `json:"name"`
+		Roles []struct {
+			Role       string `json:"role"`
+			BucketName string `json:"bucket_name"`
+		} `json:"roles"`
+	}{}
+	if err := c.getJsonData(endpointUrl, &rawUsers); err != nil {
+		return nil, err
+	}
+
+	users := []RbacUser{}
+	for _, rawUser := range rawUsers {
+		user := RbacUser{Username: rawUser.Id, Name: rawUser.Name}
+		for _, role := range rawUser.Roles {
+			if role.BucketName != "" {
+				user.Roles = append(user.Roles, fmt.Sprintf("%v[%v]", role.Role, role.BucketName))
+			} else {
+				user.Roles = append(user.Roles, role.Role)
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+
+}
+
+func (c CouchbaseCluster) PrintRbacUsers(w io.Writer, liveNodeIp string) error {
+
+	users, err := c.GetRbacUsers(liveNodeIp)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		fmt.Fprintf(w, "%v %v\n", user.Username, strings.Join(user.Roles, ","))
+	}
+
+	return nil
+
+}
+
+// Create the users in etcd, if there are any.  Called by the node that
+// bootstraps the cluster, after the default bucket exists so that roles
+// can refer to it.
+func (c CouchbaseCluster) CreateRbacUsersFromEtcd() error {
+
+	response, err := c.etcdClient.Get(KEY_RBAC_USERS, false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	users := []RbacUser{}
+	if err := json.Unmarshal([]byte(response.Node.Value), &users); err != nil {
+		return fmt.Errorf("Invalid users in %v: %v", KEY_RBAC_USERS, err)
+	}
+
+	supportsRbac, err := c.SupportsRbac()
+	if err != nil {
+		return err
+	}
+	if !supportsRbac {
+		log.Printf("Warning: ignoring the users in %v, couchbase server %v doesn't support them", KEY_RBAC_USERS, c.LocalCouchbaseVersion)
+		return nil
+	}
+
+	for _, user := range users {
+		if err := c.UpsertRbacUser(c.LocalCouchbaseIp, user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
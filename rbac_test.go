@@ -0,0 +1,73 @@
+package cbcluster
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestParseRbacRoles(t *testing.T) {
+
+	roles, err := ParseRbacRoles("bucket_full_access[default], query_select[*]")
+	assert.True(t, err == nil)
+	assert.Equals(t, len(roles), 2)
+	assert.Equals(t, roles[1], "query_select[*]")
+
+	_, err = ParseRbacRoles(" , ")
+	assert.True(t, err != nil)
+
+	assert.True(t, RbacUser{Username: "sync_gateway"}.Validate() != nil)
+
+}
+
+func TestGetRbacUsers(t *testing.T) {
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`[{"id": "sync_gateway", "domain": "local", "roles": [{"role": "bucket_full_access", "bucket_name": "default"}, {"role": "ro_admin"}]}]`))
+	}))
+	defer node.Close()
+
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	c := CouchbaseCluster{LocalCouchbasePort: port}
+
+	users, err := c.GetRbacUsers(host)
+	assert.True(t, err == nil)
+	assert.Equals(t, len(users), 1)
+	assert.Equals(t, users[0].Username, "sync_gateway")
+	assert.Equals(t, len(users[0].Roles), 2)
+	assert.Equals(t, users[0].Roles[0], "bucket_full_access[default]")
+	assert.Equals(t, users[0].Roles[1], "ro_admin")
+
+}
+
+func TestCreateBucketLegacyParams(t *testing.T) {
+
+	var form map[string][]string
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		form = req.PostForm
+	}))
+	defer node.Close()
+
+	host, port, _ := net.SplitHostPort(node.Listener.Addr().String())
+	c := CouchbaseCluster{LocalCouchbaseIp: host, LocalCouchbasePort: port}
+	params := bucketParams{Name: "default", RamQuotaMB: "128", AuthType: "none", ReplicaNumber: "0"}
+
+	c.LocalCouchbaseVersion = "3.0.1-1444-rel-community"
+	assert.True(t, c.CreateBucket(params) == nil)
+	assert.Equals(t, form["authType"][0], "none")
+	assert.Equals(t, form["proxyPort"][0], "11215")
+
+	c.LocalCouchbaseVersion = "5.0.1-5003-enterprise"
+	assert.True(t, c.CreateBucket(params) == nil)
+	_, hasAuthType := form["authType"]
+	assert.False(t, hasAuthType)
+	_, hasProxyPort := form["proxyPort"]
+	assert.False(t, hasProxyPort)
+	assert.Equals(t, form["ramQuotaMB"][0], "128")
+
+}
@@ -0,0 +1,214 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// A couchbase server group, as returned by /pools/default/serverGroups.
+// Couchbase puts replicas in a different group than the active copy where
+// it can, so a group per availability zone lets the data survive losing one.
+type ServerGroup struct {
+	Name       string            `json:"name"`
+	Uri        string            `json:"uri"`
+	AddNodeUri string            `json:"addNodeURI,omitempty"`
+	Nodes      []ServerGroupNode `json:"nodes"`
+}
+
+type ServerGroupNode struct {
+	Hostname string   `json:"hostname,omitempty"`
+	OtpNode  string   `json:"otpNode"`
+	Status   string   `json:"status,omitempty"`
+	Services []string `json:"services,omitempty"`
+}
+
+type serverGroups struct {
+	Groups []ServerGroup `json:"groups"`
+	Uri    string        `json:"uri"` // includes the revision, needed to move nodes between groups
+}
+
+func (c CouchbaseCluster) getServerGroups(liveNodeIp string) (serverGroups, error) {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/serverGroups", liveNodeIp, c.LocalCouchbasePort)
+
+	groups := serverGroups{}
+	if err := c.getJsonData(endpointUrl, &groups); err != nil {
+		return groups, err
+	}
+
+	return groups, nil
+
+}
+
+// The server groups in the cluster, sorted by name
+func (c CouchbaseCluster) GetServerGroups(liveNodeIp string) ([]ServerGroup, error) {
+
+	groups, err := c.getServerGroups(liveNodeIp)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(serverGroupsByName(groups.Groups))
+
+	return groups.Groups, nil
+
+}
+
+// Find the server group with the given name, creating it if it doesn't
+// exist yet.  Several nodes in the same zone may race to create it, so a
+// failed create is only an error if the group still isn't there.
+func (c CouchbaseCluster) EnsureServerGroup(liveNodeIp, name string) (ServerGroup, error) {
+
+	groups, err := c.GetServerGroups(liveNodeIp)
+	if err != nil {
+		return ServerGroup{}, err
+	}
+	if group, ok := findServerGroup(groups, name); ok {
+		return group, nil
+	}
+
+	log.Printf("Creating server group %v", name)
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/serverGroups", liveNodeIp, c.LocalCouchbasePort)
+	data := url.Values{
+		"name": {name},
+	}
+	createErr := c.POST(false, endpointUrl, data)
+
+	groups, err = c.GetServerGroups(liveNodeIp)
+	if err != nil {
+		return ServerGroup{}, err
+	}
+	if group, ok := findServerGroup(groups, name); ok {
+		return group, nil
+	}
+
+	if createErr != nil {
+		return ServerGroup{}, fmt.Errorf("Unable to create server group %v: %v", name, createErr)
+	}
+	return ServerGroup{}, fmt.Errorf("Server group %v not found after creating it", name)
+
+}
+
+// Make sure this node is in the server group for its zone, moving it there
+// if it's in a different one.  This is how the first node, which couchbase
+// puts in the default group, ends up in the right one.
+func (c CouchbaseCluster) JoinServerGroup(liveNodeIp string) error {
+
+	if c.Zone == "" {
+		return nil
+	}
+
+	if _, err := c.EnsureServerGroup(liveNodeIp, c.Zone); err != nil {
+		return err
+	}
+
+	groups, err := c.getServerGroups(liveNodeIp)
+	if err != nil {
+		return err
+	}
+
+	moved, changed := moveNodeToServerGroup(groups, c.LocalCouchbaseIp, c.Zone)
+	if !changed {
+		log.Printf("Node %v is in server group %v", c.LocalCouchbaseIp, c.Zone)
+		return nil
+	}
+
+	log.Printf("Moving node %v to server group %v", c.LocalCouchbaseIp, c.Zone)
+
+	movedJson, err := json.Marshal(moved)
+	if err != nil {
+		return err
+	}
+
+	endpointUrl := fmt.Sprintf("http://%v:%v%v", liveNodeIp, c.LocalCouchbasePort, groups.Uri)
+	return c.PUTJson(endpointUrl, movedJson)
+
+}
+
+// The group assignments with the node moved into the named group, in the
+// form PUT /pools/default/serverGroups expects, and whether anything changed.
+// Every node in the cluster has to be listed.
+func moveNodeToServerGroup(groups serverGroups, ip, groupName string) (serverGroups, bool) {
+
+	var movedNode *ServerGroupNode
+	for _, group := range groups.Groups {
+		for _, node := range group.Nodes {
+			if nodeHostnameIp(node.Hostname) == ip {
+				if group.Name == groupName {
+					return groups, false
+				}
+				node := node
+				movedNode = &node
+			}
+		}
+	}
+	if movedNode == nil {
+		return groups, false
+	}
+
+	moved := serverGroups{Uri: groups.Uri}
+	for _, group := range groups.Groups {
+		nodes := []ServerGroupNode{}
+		for _, node := range group.Nodes {
+			if nodeHostnameIp(node.Hostname) != ip {
+				nodes = append(nodes, ServerGroupNode{OtpNode: node.OtpNode})
+			}
+		}
+		if group.Name == groupName {
+			nodes = append(nodes, ServerGroupNode{OtpNode: movedNode.OtpNode})
+		}
+		moved.Groups = append(moved.Groups, ServerGroup{
+			Name:  group.Name,
+			Uri:   group.Uri,
+			Nodes: nodes,
+		})
+	}
+
+	return moved, true
+
+}
+
+func findServerGroup(groups []ServerGroup, name string) (ServerGroup, bool) {
+	for _, group := range groups {
+		if group.Name == name {
+			return group, true
+		}
+	}
+	return ServerGroup{}, false
+}
+
+// Print the nodes in each server group
+func (c CouchbaseCluster) PrintServerGroups(w io.Writer) error {
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+
+	groups, err := c.GetServerGroups(liveNodeIp)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		fmt.Fprintf(w, "%v (%v nodes)\n", group.Name, len(group.Nodes))
+		for _, node := range group.Nodes {
+			fmt.Fprintf(w, "  %v %v %v\n", node.Hostname, node.Status, strings.Join(node.Services, ","))
+		}
+	}
+
+	return nil
+
+}
+
+type serverGroupsByName []ServerGroup
+
+func (s serverGroupsByName) Len() int           { return len(s) }
+func (s serverGroupsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s serverGroupsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
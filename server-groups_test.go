@@ -0,0 +1,72 @@
+package cbcluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreos/fleet/schema"
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestMoveNodeToServerGroup(t *testing.T) {
+
+	groups := serverGroups{
+		Uri: "/pools/default/serverGroups?rev=42",
+		Groups: []ServerGroup{
+			{
+				Name: "Group 1",
+				Uri:  "/pools/default/serverGroups/0",
+				Nodes: []ServerGroupNode{
+					{Hostname: "10.0.0.1:8091", OtpNode: "ns_1@10.0.0.1"},
+					{Hostname: "10.0.0.2:8091", OtpNode: "ns_1@10.0.0.2"},
+				},
+			},
+			{
+				Name:  "us-east-1b",
+				Uri:   "/pools/default/serverGroups/1",
+				Nodes: []ServerGroupNode{},
+			},
+		},
+	}
+
+	moved, changed := moveNodeToServerGroup(groups, "10.0.0.2", "us-east-1b")
+	assert.True(t, changed)
+	assert.Equals(t, moved.Uri, groups.Uri)
+	assert.Equals(t, len(moved.Groups), 2)
+	assert.Equals(t, len(moved.Groups[0].Nodes), 1)
+	assert.Equals(t, moved.Groups[0].Nodes[0].OtpNode, "ns_1@10.0.0.1")
+	assert.Equals(t, len(moved.Groups[1].Nodes), 1)
+	assert.Equals(t, moved.Groups[1].Nodes[0].OtpNode, "ns_1@10.0.0.2")
+
+	// already in the group
+	_, changed = moveNodeToServerGroup(groups, "10.0.0.1", "Group 1")
+	assert.False(t, changed)
+
+	// not in the cluster
+	_, changed = moveNodeToServerGroup(groups, "10.0.0.3", "us-east-1b")
+	assert.False(t, changed)
+
+}
+
+func TestSidekickFleetUnitFileZone(t *testing.T) {
+
+	machines := []*schema.Machine{
+		{Id: "m1", Metadata: map[string]string{"zone": "us-east-1a"}},
+		{Id: "m2", Metadata: map[string]string{"zone": "us-east-1b"}},
+	}
+
+	placement, _ := ParseMachinePlacement([]string{}, "zone")
+	placement.ServerGroups = true
+	c := CouchbaseFleet{CbVersion: "community-3.0.1", Placement: placement.Resolve(machines)}
+
+	unitFile, err := c.generateSidekickFleetUnitFile("2")
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(unitFile, "--zone=us-east-1b"))
+
+	// without server groups, the zone is only used for scheduling
+	c.Placement.ServerGroups = false
+	unitFile, err = c.generateSidekickFleetUnitFile("2")
+	assert.True(t, err == nil)
+	assert.False(t, strings.Contains(unitFile, "--zone"))
+
+}
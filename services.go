@@ -0,0 +1,183 @@
+package cbcluster
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	SERVICE_DATA      = "data"
+	SERVICE_INDEX     = "index"
+	SERVICE_QUERY     = "query"
+	SERVICE_FTS       = "fts"
+	SERVICE_EVENTING  = "eventing"
+	SERVICE_ANALYTICS = "analytics"
+
+	// the smallest quota couchbase server will accept for a service
+	MIN_SERVICE_QUOTA_MB = 256
+)
+
+// Maps the service names used on the command line to the names
+// the REST api expects in the services parameter
+var restServiceNames = map[string]string{
+	SERVICE_DATA:      "kv",
+	SERVICE_INDEX:     "index",
+	SERVICE_QUERY:     "n1ql",
+	SERVICE_FTS:       "fts",
+	SERVICE_EVENTING:  "eventing",
+	SERVICE_ANALYTICS: "cbas",
+}
+
+// Maps services to the REST api parameter that holds their memory quota.
+// The query service doesn't have a quota.
+var serviceQuotaParams = map[string]string{
+	SERVICE_DATA:      "memoryQuota",
+	SERVICE_INDEX:     "indexMemoryQuota",
+	SERVICE_FTS:       "ftsMemoryQuota",
+	SERVICE_EVENTING:  "eventingMemoryQuota",
+	SERVICE_ANALYTICS: "cbasMemoryQuota",
+}
+
+// The quota a service gets if it runs on the node but the user didn't
+// ask for a specific value.  The data service gets whatever is left over.
+var defaultServiceQuotasMB = map[string]int{
+	SERVICE_INDEX:     256,
+	SERVICE_FTS:       256,
+	SERVICE_EVENTING:  256,
+	SERVICE_ANALYTICS: 1024,
+}
+
+// Convert from a comma separated list like "data,index,query" to a string slice,
+// checking that each service is one we know about.
+func ParseServices(rawServices string) ([]string, error) {
+
+	services := []string{}
+
+	for _, service := range strings.Split(rawServices, ",") {
+		service = strings.TrimSpace(service)
+		if service == "" {
+			continue
+		}
+		if _, ok := restServiceNames[service]; !ok {
+			return nil, fmt.Errorf("Invalid service: %v.  Valid services: %v", service, validServiceNames())
+		}
+		services = append(services, service)
+	}
+
+	if len(services) == 0 {
+		return nil, fmt.Errorf("No services given in: %v", rawServices)
+	}
+
+	return services, nil
+
+}
+
+// Convert from a comma separated list like "data:1024,index:512" to a map
+// of service name -> quota in MB.
+func ParseMemoryQuotas(rawQuotas string) (map[string]int, error) {
+
+	quotas := map[string]int{}
+
+	for _, quotaPair := range strings.Split(rawQuotas, ",") {
+		quotaPair = strings.TrimSpace(quotaPair)
+		if quotaPair == "" {
+			continue
+		}
+		components := strings.Split(quotaPair, ":")
+		if len(components) != 2 {
+			return nil, fmt.Errorf("Invalid memory quota: %v.  Expected service:mb", quotaPair)
+		}
+		service := strings.TrimSpace(components[0])
+		if _, ok := serviceQuotaParams[service]; !ok {
+			return nil, fmt.Errorf("Service %v does not have a memory quota", service)
+		}
+		quotaMb, err := strconv.Atoi(strings.TrimSpace(components[1]))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid memory quota for %v: %v", service, err)
+		}
+		quotas[service] = quotaMb
+	}
+
+	return quotas, nil
+
+}
+
+// Convert the service names to what the REST api expects, ie "kv,index,n1ql"
+func restServicesParam(services []string) string {
+
+	restServices := []string{}
+	for _, service := range services {
+		restServices = append(restServices, restServiceNames[service])
+	}
+	return strings.Join(restServices, ",")
+
+}
+
+// Split the ram available to the cluster between the services.  Quotas
+// explicitly given by the user are used as-is, services running on this
+// node get their default quota, and the data service gets the rest.
+func calculateMemoryQuotas(clusterRamMb int, services []string, explicitQuotas map[string]int) map[string]int {
+
+	quotas := map[string]int{}
+	for service, quotaMb := range explicitQuotas {
+		quotas[service] = quotaMb
+	}
+
+	for _, service := range services {
+		if _, ok := quotas[service]; ok {
+			continue
+		}
+		if defaultQuotaMb, ok := defaultServiceQuotasMB[service]; ok {
+			quotas[service] = defaultQuotaMb
+		}
+	}
+
+	if _, ok := quotas[SERVICE_DATA]; !ok {
+		dataQuotaMb := clusterRamMb
+		for _, quotaMb := range quotas {
+			dataQuotaMb -= quotaMb
+		}
+		if dataQuotaMb < MIN_SERVICE_QUOTA_MB {
+			dataQuotaMb = MIN_SERVICE_QUOTA_MB
+		}
+		quotas[SERVICE_DATA] = dataQuotaMb
+	}
+
+	return quotas
+
+}
+
+func sumMemoryQuotas(quotas map[string]int) int {
+
+	totalMb := 0
+	for _, quotaMb := range quotas {
+		totalMb += quotaMb
+	}
+	return totalMb
+
+}
+
+// Convert the memory quotas to the form values expected by /pools/default
+func memoryQuotaParams(quotas map[string]int) url.Values {
+
+	data := url.Values{}
+	for service, quotaMb := range quotas {
+		data.Set(serviceQuotaParams[service], fmt.Sprintf("%v", quotaMb))
+	}
+	return data
+
+}
+
+func validServiceNames() []string {
+
+	names := []string{}
+	for name := range restServiceNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+
+}
@@ -0,0 +1,56 @@
+package cbcluster
+
+import (
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestParseServices(t *testing.T) {
+
+	services, err := ParseServices("data, index,query")
+	assert.True(t, err == nil)
+	assert.Equals(t, services, []string{"data", "index", "query"})
+	assert.Equals(t, restServicesParam(services), "kv,index,n1ql")
+
+	_, err = ParseServices("data,bogus")
+	assert.True(t, err != nil)
+
+}
+
+func TestParseMemoryQuotas(t *testing.T) {
+
+	quotas, err := ParseMemoryQuotas("data:1024,index:512")
+	assert.True(t, err == nil)
+	assert.Equals(t, quotas[SERVICE_DATA], 1024)
+	assert.Equals(t, quotas[SERVICE_INDEX], 512)
+
+	// query doesn't have a quota
+	_, err = ParseMemoryQuotas("query:512")
+	assert.True(t, err != nil)
+
+	_, err = ParseMemoryQuotas("data=512")
+	assert.True(t, err != nil)
+
+}
+
+func TestCalculateMemoryQuotas(t *testing.T) {
+
+	// no services given, data gets all the cluster ram
+	quotas := calculateMemoryQuotas(3000, []string{}, map[string]int{})
+	assert.Equals(t, len(quotas), 1)
+	assert.Equals(t, quotas[SERVICE_DATA], 3000)
+
+	// index gets its default, data gets the rest
+	quotas = calculateMemoryQuotas(3000, []string{"data", "index", "query"}, map[string]int{})
+	assert.Equals(t, len(quotas), 2)
+	assert.Equals(t, quotas[SERVICE_INDEX], 256)
+	assert.Equals(t, quotas[SERVICE_DATA], 2744)
+
+	// explicit quotas win
+	explicit := map[string]int{SERVICE_INDEX: 1000}
+	quotas = calculateMemoryQuotas(3000, []string{"data", "index"}, explicit)
+	assert.Equals(t, quotas[SERVICE_INDEX], 1000)
+	assert.Equals(t, quotas[SERVICE_DATA], 2000)
+
+}
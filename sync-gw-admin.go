@@ -0,0 +1,286 @@
+package cbcluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// A client for the sync gateway admin REST api on a single node
+type SyncGwAdminClient struct {
+	AdminUrl string // eg http://10.0.0.1:4985
+	client   *http.Client
+}
+
+// A sync gateway user, as accepted by PUT /db/_user/name
+type SyncGwUser struct {
+	Name          string   `json:"name"`
+	Password      string   `json:"password,omitempty"`
+	AdminChannels []string `json:"admin_channels,omitempty"`
+	AdminRoles    []string `json:"admin_roles,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	Disabled      bool     `json:"disabled,omitempty"`
+	AllChannels   []string `json:"all_channels,omitempty"` // read only
+	AllRoles      []string `json:"roles,omitempty"`        // read only
+}
+
+// A sync gateway role, as accepted by PUT /db/_role/name
+type SyncGwRole struct {
+	Name          string   `json:"name"`
+	AdminChannels []string `json:"admin_channels,omitempty"`
+	AllChannels   []string `json:"all_channels,omitempty"` // read only
+}
+
+// A non-2xx response from the admin api
+type SyncGwAdminError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Body       string
+}
+
+func (e SyncGwAdminError) Error() string {
+	return fmt.Sprintf("%v %v failed.  Status code: %v.  Body: %v", e.Method, e.Url, e.StatusCode, e.Body)
+}
+
+func NewSyncGwAdminClient(adminUrl string) *SyncGwAdminClient {
+	return &SyncGwAdminClient{
+		AdminUrl: strings.TrimSuffix(adminUrl, "/"),
+		client:   &http.Client{},
+	}
+}
+
+// Admin api clients for the given node, or for every sync gateway
+// registered in etcd if nodeIp is empty.  Unhealthy nodes are included,
+// since eg an offline database needs to be brought back online.
+func (s SyncGwCluster) SyncGwAdminClients(nodeIp string) ([]*SyncGwAdminClient, error) {
+
+	upstreams, err := s.FindAllSyncGwUpstreams()
+	if err != nil {
+		return nil, err
+	}
+	clients := []*SyncGwAdminClient{}
+	for _, upstream := range upstreams {
+		if nodeIp != "" && upstream.Ip != nodeIp {
+			continue
+		}
+		clients = append(clients, NewSyncGwAdminClient(fmt.Sprintf("http://%v:%v", upstream.Ip, upstream.AdminPort)))
+	}
+
+	if len(clients) > 0 {
+		return clients, nil
+	}
+
+	if nodeIp == "" {
+		return nil, fmt.Errorf("No sync gateways found in etcd under %v", KEY_SYNC_GW_NODE_STATE)
+	}
+
+	// a node that isn't registered in etcd, assume the default admin port
+	return []*SyncGwAdminClient{
+		NewSyncGwAdminClient(fmt.Sprintf("http://%v:%v", nodeIp, DEFAULT_SYNC_GW_ADMIN_PORT)),
+	}, nil
+
+}
+
+func (c SyncGwAdminClient) ListDatabases() ([]string, error) {
+	databases := []string{}
+	err := c.getJson("/_all_dbs", &databases)
+	return databases, err
+}
+
+// Returns the database info, eg {"db_name": "db", "state": "Online", ...}
+func (c SyncGwAdminClient) GetDatabase(db string) (map[string]interface{}, error) {
+	info := map[string]interface{}{}
+	err := c.getJson(fmt.Sprintf("/%v/", db), &info)
+	return info, err
+}
+
+// Returns false (and no error) if the database doesn't exist on this node
+func (c SyncGwAdminClient) DatabaseExists(db string) (bool, error) {
+	_, err := c.GetDatabase(db)
+	if adminErr, ok := err.(SyncGwAdminError); ok && adminErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c SyncGwAdminClient) CreateDatabase(db string, config []byte) error {
+	return c.call("PUT", fmt.Sprintf("/%v/", db), config, nil)
+}
+
+func (c SyncGwAdminClient) DeleteDatabase(db string) error {
+	return c.call("DELETE", fmt.Sprintf("/%v/", db), nil, nil)
+}
+
+func (c SyncGwAdminClient) GetDatabaseConfig(db string) (json.RawMessage, error) {
+	config := json.RawMessage{}
+	err := c.getJson(fmt.Sprintf("/%v/_config", db), &config)
+	return config, err
+}
+
+func (c SyncGwAdminClient) SetDatabaseConfig(db string, config []byte) error {
+	return c.call("PUT", fmt.Sprintf("/%v/_config", db), config, nil)
+}
+
+func (c SyncGwAdminClient) TakeDatabaseOffline(db string) error {
+	return c.call("POST", fmt.Sprintf("/%v/_offline", db), nil, nil)
+}
+
+func (c SyncGwAdminClient) BringDatabaseOnline(db string) error {
+	return c.call("POST", fmt.Sprintf("/%v/_online", db), nil, nil)
+}
+
+// Re-run the sync function on every document.  The database has to be
+// offline.  Returns the number of documents that changed.
+func (c SyncGwAdminClient) Resync(db string) (int, error) {
+	result := struct {
+		Changes int `json:"changes"`
+	}{}
+	err := c.call("POST", fmt.Sprintf("/%v/_resync", db), nil, &result)
+	return result.Changes, err
+}
+
+// Resync a database across the sync gateway cluster.  Every node has to take
+// the database offline, otherwise the nodes that are still online would keep
+// running the old sync function against documents while they are being
+// rewritten, so the resync itself only runs on the first node and the rest
+// are just held offline until it's done.  Returns the number of documents
+// that changed.
+func ResyncDatabase(clients []*SyncGwAdminClient, db string) (int, error) {
+
+	if len(clients) == 0 {
+		return 0, fmt.Errorf("No sync gateway nodes to resync %v on", db)
+	}
+
+	offline := []*SyncGwAdminClient{}
+	bringOnline := func() error {
+		var firstErr error
+		for _, client := range offline {
+			if err := client.BringDatabaseOnline(db); err != nil {
+				log.Printf("Failed to bring %v back online on %v: %v", db, client.AdminUrl, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		return firstErr
+	}
+
+	for _, client := range clients {
+		log.Printf("Taking %v offline on %v", db, client.AdminUrl)
+		if err := client.TakeDatabaseOffline(db); err != nil {
+			bringOnline()
+			return 0, err
+		}
+		offline = append(offline, client)
+	}
+
+	log.Printf("Resyncing %v on %v", db, clients[0].AdminUrl)
+	changes, resyncErr := clients[0].Resync(db)
+
+	if err := bringOnline(); err != nil {
+		return changes, err
+	}
+
+	return changes, resyncErr
+
+}
+
+func (c SyncGwAdminClient) ListUsers(db string) ([]string, error) {
+	users := []string{}
+	err := c.getJson(fmt.Sprintf("/%v/_user/", db), &users)
+	return users, err
+}
+
+func (c SyncGwAdminClient) GetUser(db, name string) (SyncGwUser, error) {
+	user := SyncGwUser{}
+	err := c.getJson(fmt.Sprintf("/%v/_user/%v", db, name), &user)
+	return user, err
+}
+
+// Create the user, or update it if it already exists
+func (c SyncGwAdminClient) PutUser(db string, user SyncGwUser) error {
+	userJson, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return c.call("PUT", fmt.Sprintf("/%v/_user/%v", db, user.Name), userJson, nil)
+}
+
+func (c SyncGwAdminClient) DeleteUser(db, name string) error {
+	return c.call("DELETE", fmt.Sprintf("/%v/_user/%v", db, name), nil, nil)
+}
+
+func (c SyncGwAdminClient) ListRoles(db string) ([]string, error) {
+	roles := []string{}
+	err := c.getJson(fmt.Sprintf("/%v/_role/", db), &roles)
+	return roles, err
+}
+
+func (c SyncGwAdminClient) GetRole(db, name string) (SyncGwRole, error) {
+	role := SyncGwRole{}
+	err := c.getJson(fmt.Sprintf("/%v/_role/%v", db, name), &role)
+	return role, err
+}
+
+// Create the role, or update it if it already exists
+func (c SyncGwAdminClient) PutRole(db string, role SyncGwRole) error {
+	roleJson, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+	return c.call("PUT", fmt.Sprintf("/%v/_role/%v", db, role.Name), roleJson, nil)
+}
+
+func (c SyncGwAdminClient) DeleteRole(db, name string) error {
+	return c.call("DELETE", fmt.Sprintf("/%v/_role/%v", db, name), nil, nil)
+}
+
+func (c SyncGwAdminClient) getJson(path string, into interface{}) error {
+	return c.call("GET", path, nil, into)
+}
+
+// Make a request to the admin api, and if into is non-nil, decode the
+// json response into it.  Any non-2xx status is returned as a SyncGwAdminError.
+func (c SyncGwAdminClient) call(method, path string, body []byte, into interface{}) error {
+
+	endpointUrl := fmt.Sprintf("%v%v", c.AdminUrl, path)
+
+	req, err := http.NewRequest(method, endpointUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return SyncGwAdminError{
+			Method:     method,
+			Url:        endpointUrl,
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(respBody)),
+		}
+	}
+
+	if into == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, into)
+
+}
@@ -0,0 +1,100 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestSyncGwAdminClient(t *testing.T) {
+
+	requests := []string{}
+	var putUser SyncGwUser
+
+	adminApi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		switch req.URL.Path {
+		case "/todos/":
+			w.Write([]byte(`{"db_name": "todos", "state": "Online"}`))
+		case "/todos/_user/":
+			w.Write([]byte(`["alice", "bob"]`))
+		case "/todos/_user/carol":
+			body, _ := ioutil.ReadAll(req.Body)
+			json.Unmarshal(body, &putUser)
+			w.WriteHeader(201)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":"not_found"}`))
+		}
+	}))
+	defer adminApi.Close()
+
+	client := NewSyncGwAdminClient(adminApi.URL + "/")
+
+	exists, err := client.DatabaseExists("todos")
+	assert.True(t, err == nil)
+	assert.True(t, exists)
+
+	exists, err = client.DatabaseExists("nope")
+	assert.True(t, err == nil)
+	assert.False(t, exists)
+
+	users, err := client.ListUsers("todos")
+	assert.True(t, err == nil)
+	assert.Equals(t, len(users), 2)
+
+	err = client.PutUser("todos", SyncGwUser{Name: "carol", Password: "s3cret", AdminChannels: []string{"public"}})
+	assert.True(t, err == nil)
+	assert.Equals(t, putUser.Password, "s3cret")
+	assert.Equals(t, putUser.AdminChannels[0], "public")
+
+	err = client.TakeDatabaseOffline("nope")
+	adminErr, ok := err.(SyncGwAdminError)
+	assert.True(t, ok)
+	assert.Equals(t, adminErr.StatusCode, 404)
+	assert.Equals(t, requests[len(requests)-1], "POST /nope/_offline")
+
+}
+
+func TestResyncDatabase(t *testing.T) {
+
+	requests := []string{}
+
+	newNode := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, name+" "+req.Method+" "+req.URL.Path)
+			switch req.URL.Path {
+			case "/todos/_resync":
+				w.Write([]byte(`{"changes": 7}`))
+			default:
+				w.WriteHeader(200)
+			}
+		}))
+	}
+	node1 := newNode("node1")
+	defer node1.Close()
+	node2 := newNode("node2")
+	defer node2.Close()
+
+	clients := []*SyncGwAdminClient{
+		NewSyncGwAdminClient(node1.URL + "/"),
+		NewSyncGwAdminClient(node2.URL + "/"),
+	}
+
+	changes, err := ResyncDatabase(clients, "todos")
+	assert.True(t, err == nil)
+	assert.Equals(t, changes, 7)
+
+	// every node goes offline before the resync, and back online after it
+	assert.Equals(t, len(requests), 5)
+	assert.Equals(t, requests[0], "node1 POST /todos/_offline")
+	assert.Equals(t, requests[1], "node2 POST /todos/_offline")
+	assert.Equals(t, requests[2], "node1 POST /todos/_resync")
+	assert.Equals(t, requests[3], "node1 POST /todos/_online")
+	assert.Equals(t, requests[4], "node2 POST /todos/_online")
+
+}
@@ -0,0 +1,224 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the revision number of the config that sync gateways should use
+	KEY_SYNC_GW_CONFIG_CURRENT = "/couchbase.com/sync-gateway/config-current"
+
+	// one key per revision of the config, eg config-history/00000003
+	KEY_SYNC_GW_CONFIG_HISTORY = "/couchbase.com/sync-gateway/config-history"
+
+	// older revisions are pruned from etcd
+	MAX_SYNC_GW_CONFIG_REVISIONS = 50
+)
+
+// A version of the sync gateway config stored in etcd
+type SyncGwConfigRevision struct {
+	Revision int       `json:"revision"`
+	Source   string    `json:"source"` // where the config came from, eg a url or file path
+	Created  time.Time `json:"created"`
+	Content  string    `json:"content"`
+}
+
+// Store the config in etcd as a new revision, and make it the current one.
+// If the config is the same as the current revision, nothing is stored.
+func (s SyncGwCluster) StoreSyncGwConfig(content, source string) (SyncGwConfigRevision, error) {
+
+	if err := ValidateSyncGwConfig(content); err != nil {
+		return SyncGwConfigRevision{}, err
+	}
+
+	nextRevision := 1
+
+	current, err := s.CurrentSyncGwConfig()
+	switch {
+	case err == nil:
+		if current.Content == content {
+			log.Printf("Config from %v is the same as current revision %v, not storing", source, current.Revision)
+			return current, nil
+		}
+		nextRevision = current.Revision + 1
+	case !isEtcdKeyNotFound(err):
+		return SyncGwConfigRevision{}, err
+	}
+
+	revision := SyncGwConfigRevision{
+		Source:  source,
+		Created: time.Now().UTC(),
+		Content: content,
+	}
+
+	// if someone else is storing a config at the same time, the create
+	// will fail and we'll try the next revision number
+	maxAttempts := 10
+	for i := 0; ; i++ {
+
+		revision.Revision = nextRevision
+		revisionJson, err := json.Marshal(revision)
+		if err != nil {
+			return revision, err
+		}
+
+		_, err = s.etcdClient.Create(syncGwConfigRevisionKey(nextRevision), string(revisionJson), TTL_NONE)
+		if err == nil {
+			break
+		}
+		if !strings.Contains(err.Error(), "Key already exists") || i >= maxAttempts {
+			return revision, err
+		}
+		nextRevision += 1
+
+	}
+
+	if _, err := s.etcdClient.Set(KEY_SYNC_GW_CONFIG_CURRENT, strconv.Itoa(revision.Revision), TTL_NONE); err != nil {
+		return revision, err
+	}
+
+	log.Printf("Stored config from %v as revision %v", source, revision.Revision)
+
+	s.pruneSyncGwConfigHistory(revision.Revision)
+
+	return revision, nil
+
+}
+
+// The revision of the config that sync gateways should currently be using
+func (s SyncGwCluster) CurrentSyncGwConfig() (SyncGwConfigRevision, error) {
+
+	response, err := s.etcdClient.Get(KEY_SYNC_GW_CONFIG_CURRENT, false, false)
+	if err != nil {
+		return SyncGwConfigRevision{}, err
+	}
+
+	revisionNumber, err := strconv.Atoi(response.Node.Value)
+	if err != nil {
+		return SyncGwConfigRevision{}, fmt.Errorf("Invalid revision in %v: %v", KEY_SYNC_GW_CONFIG_CURRENT, response.Node.Value)
+	}
+
+	return s.GetSyncGwConfigRevision(revisionNumber)
+
+}
+
+func (s SyncGwCluster) GetSyncGwConfigRevision(revisionNumber int) (SyncGwConfigRevision, error) {
+
+	revision := SyncGwConfigRevision{}
+
+	response, err := s.etcdClient.Get(syncGwConfigRevisionKey(revisionNumber), false, false)
+	if err != nil {
+		return revision, err
+	}
+
+	if err := json.Unmarshal([]byte(response.Node.Value), &revision); err != nil {
+		return revision, fmt.Errorf("Invalid config revision %v: %v", revisionNumber, err)
+	}
+
+	return revision, nil
+
+}
+
+// All of the revisions still stored in etcd, oldest first
+func (s SyncGwCluster) SyncGwConfigHistory() ([]SyncGwConfigRevision, error) {
+
+	revisions := []SyncGwConfigRevision{}
+
+	response, err := s.etcdClient.Get(KEY_SYNC_GW_CONFIG_HISTORY, true, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return revisions, nil
+		}
+		return nil, err
+	}
+
+	for _, node := range response.Node.Nodes {
+		revision := SyncGwConfigRevision{}
+		if err := json.Unmarshal([]byte(node.Value), &revision); err != nil {
+			log.Printf("Skipping invalid config revision %v: %v", node.Key, err)
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+
+}
+
+// Make an older revision current again.  This stores the old config as a new
+// revision, so that the rollback itself shows up in the history.
+func (s SyncGwCluster) RollbackSyncGwConfig(revisionNumber int) (SyncGwConfigRevision, error) {
+
+	revision, err := s.GetSyncGwConfigRevision(revisionNumber)
+	if err != nil {
+		return revision, fmt.Errorf("Could not find config revision %v: %v", revisionNumber, err)
+	}
+
+	source := fmt.Sprintf("rollback to revision %v (%v)", revision.Revision, revision.Source)
+	return s.StoreSyncGwConfig(revision.Content, source)
+
+}
+
+// Remove revisions that are too old to be worth keeping around
+func (s SyncGwCluster) pruneSyncGwConfigHistory(latestRevision int) {
+
+	for revisionNumber := latestRevision - MAX_SYNC_GW_CONFIG_REVISIONS; revisionNumber > 0; revisionNumber-- {
+		_, err := s.etcdClient.Delete(syncGwConfigRevisionKey(revisionNumber), false)
+		if err != nil {
+			// older revisions were already pruned on an earlier pass
+			return
+		}
+		log.Printf("Pruned config revision %v", revisionNumber)
+	}
+
+}
+
+// Zero padded so that etcd sorts the keys in revision order
+func syncGwConfigRevisionKey(revisionNumber int) string {
+	return fmt.Sprintf("%v/%08d", KEY_SYNC_GW_CONFIG_HISTORY, revisionNumber)
+}
+
+func isEtcdKeyNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Key not found")
+}
+
+func fetchSyncGwConfigUrl(configUrl string) (string, error) {
+
+	resp, err := http.Get(configUrl)
+	if err != nil {
+		return "", fmt.Errorf("Error %v getting sync gw config from %v", err, configUrl)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("Invalid status %v getting sync gw config from %v", resp.StatusCode, configUrl)
+	}
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+
+}
+
+// Read the config from a local file or a url, for storing in etcd
+func LoadSyncGwConfig(configFile, configUrl string) (content, source string, err error) {
+
+	if configFile != "" {
+		contentBytes, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return "", "", err
+		}
+		return string(contentBytes), configFile, nil
+	}
+
+	content, err = fetchSyncGwConfigUrl(configUrl)
+	return content, configUrl, err
+
+}
@@ -0,0 +1,81 @@
+package cbcluster
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	SYNC_GW_STATUS_HEALTHY   = "healthy"
+	SYNC_GW_STATUS_UNHEALTHY = "unhealthy"
+
+	// short enough to probe everything within a heartbeat interval
+	SYNC_GW_PROBE_TIMEOUT = 2 * time.Second
+)
+
+// Check that the local sync gateway is answering on its public and admin
+// ports, and that each of its databases is online.  Returns an error
+// describing the first probe that failed.
+//
+// The admin api is probed on localhost, since sync gateway only listens
+// on localhost for admin requests by default.
+func (s SyncGwCluster) ProbeSyncGw() error {
+
+	client := &http.Client{Timeout: SYNC_GW_PROBE_TIMEOUT}
+
+	publicUrl := fmt.Sprintf("http://%v:%v/", s.LocalIp, s.Port)
+	if err := probeUrl(client, publicUrl); err != nil {
+		return err
+	}
+
+	adminClient := NewSyncGwAdminClient(fmt.Sprintf("http://localhost:%v", s.AdminPort))
+	adminClient.client = client
+
+	if err := probeUrl(client, adminClient.AdminUrl+"/"); err != nil {
+		return err
+	}
+
+	for _, db := range s.Databases {
+		if err := probeDatabase(adminClient, db); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+func probeUrl(client *http.Client, endpointUrl string) error {
+
+	resp, err := client.Get(endpointUrl)
+	if err != nil {
+		return fmt.Errorf("Error connecting to %v: %v", endpointUrl, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Unexpected status code %v from %v", resp.StatusCode, endpointUrl)
+	}
+
+	return nil
+
+}
+
+// Older versions of sync gateway don't report a state, in which case
+// the database is considered online as long as it exists.
+func probeDatabase(adminClient *SyncGwAdminClient, db string) error {
+
+	info, err := adminClient.GetDatabase(db)
+	if err != nil {
+		return fmt.Errorf("Error getting database %v: %v", db, err)
+	}
+
+	state, ok := info["state"].(string)
+	if ok && state != "Online" {
+		return fmt.Errorf("Database %v is %v", db, state)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,55 @@
+package cbcluster
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestProbeSyncGw(t *testing.T) {
+
+	photosState := "Online"
+
+	// serves both the public and the admin api
+	syncGw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/":
+			w.Write([]byte(`{"couchdb":"Welcome"}`))
+		case "/todos/":
+			w.Write([]byte(`{"db_name": "todos"}`))
+		case "/photos/":
+			w.Write([]byte(`{"db_name": "photos", "state": "` + photosState + `"}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer syncGw.Close()
+
+	host, portStr, _ := net.SplitHostPort(syncGw.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	s := SyncGwCluster{
+		LocalIp:   host,
+		Port:      port,
+		AdminPort: port,
+		Databases: []string{"todos", "photos"},
+	}
+	assert.True(t, s.ProbeSyncGw() == nil)
+
+	photosState = "Offline"
+	err := s.ProbeSyncGw()
+	assert.True(t, err != nil)
+	assert.Equals(t, err.Error(), "Database photos is Offline")
+
+	s.Databases = []string{"missing"}
+	assert.True(t, s.ProbeSyncGw() != nil)
+
+	syncGw.Close()
+	s.Databases = []string{}
+	assert.True(t, s.ProbeSyncGw() != nil)
+
+}
@@ -0,0 +1,231 @@
+package cbcluster
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/coreos/fleet/schema"
+)
+
+const (
+	// how long to wait after a sync gateway is taken out of the load
+	// balancer before stopping it, so that in-flight requests can finish
+	DEFAULT_SYNC_GW_DRAIN_SECONDS = 30
+)
+
+// The units that make up a sync gateway cluster.  The confd and nginx units
+// are the ones launched by older versions.
+var syncGwUnitNamePatterns = []string{
+	fmt.Sprintf("%v@", UNIT_NAME_SYNC_GW_NODE),
+	fmt.Sprintf("%v@", UNIT_NAME_SYNC_GW_SIDEKICK),
+	fmt.Sprintf("%v.service", UNIT_NAME_LB),
+	fmt.Sprintf("%v.service", UNIT_NAME_LB_SIDEKICK),
+	"confd.service",
+	"confdata.service",
+	"nginx.service",
+}
+
+// Call Fleet API and tell it to stop the sync gateway units, leaving
+// the couchbase server units (and anything else) alone.
+func (s SyncGwCluster) StopUnits() error {
+
+	unitStopper := func(unit *schema.Unit) error {
+		endpointUrl := fmt.Sprintf("%v/units/%v", FLEET_API_ENDPOINT, unit.Name)
+		log.Printf("Stop unit %v via PUT %v", unit.Name, endpointUrl)
+		return PUT(endpointUrl, `{"desiredState": "inactive"}`)
+	}
+
+	return s.ManipulateUnits(unitStopper)
+
+}
+
+// Call Fleet API and tell it to destroy the sync gateway units, leaving
+// the couchbase server units (and anything else) alone.
+func (s SyncGwCluster) DestroyUnits() error {
+
+	unitDestroyer := func(unit *schema.Unit) error {
+		endpointUrl := fmt.Sprintf("%v/units/%v", FLEET_API_ENDPOINT, unit.Name)
+		log.Printf("Destroy unit %v via DELETE %v", unit.Name, endpointUrl)
+		return DELETE(endpointUrl)
+	}
+
+	return s.ManipulateUnits(unitDestroyer)
+
+}
+
+func (s SyncGwCluster) ManipulateUnits(unitManipulator UnitManipulator) error {
+
+	allUnits, err := findAllFleetUnits()
+	if err != nil {
+		return err
+	}
+
+	units := filterFleetUnits(allUnits, syncGwUnitNamePatterns)
+	if len(units) == 0 {
+		log.Printf("No sync gateway units found")
+	}
+
+	for _, unit := range units {
+		if err := unitManipulator(unit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// Change the number of sync gateway nodes to s.NumNodes.  New nodes are
+// launched with the next free unit numbers.  Nodes are removed highest
+// unit number first, and each one is drained before it's destroyed.
+func (s SyncGwCluster) Scale(drainSeconds int) error {
+
+	unitNumbers, err := findFleetUnitNumbers(UNIT_NAME_SYNC_GW_NODE)
+	if err != nil {
+		return err
+	}
+
+	numRunning := len(unitNumbers)
+	log.Printf("Scaling sync gateway from %v to %v nodes", numRunning, s.NumNodes)
+
+	switch {
+	case s.NumNodes > numRunning:
+		return s.scaleOut(unitNumbers, s.NumNodes-numRunning)
+	case s.NumNodes < numRunning:
+		// unitNumbers is sorted, so the last ones are the highest
+		return s.scaleIn(unitNumbers[s.NumNodes:], drainSeconds)
+	default:
+		log.Printf("Already running %v sync gateway nodes, nothing to do", numRunning)
+		return nil
+	}
+
+}
+
+func (s SyncGwCluster) scaleOut(existingUnitNumbers []int, numToAdd int) error {
+
+	firstUnitNumber := 1
+	if len(existingUnitNumbers) > 0 {
+		firstUnitNumber = existingUnitNumbers[len(existingUnitNumbers)-1] + 1
+	}
+	unitNumbers := unitNumberRange(firstUnitNumber, firstUnitNumber+numToAdd-1)
+
+	// the new units need machines on top of the ones the existing units use
+	if err := s.placeUnits(append(append([]int{}, existingUnitNumbers...), unitNumbers...)); err != nil {
+		return err
+	}
+
+	if err := s.kickOffFleetUnits(unitNumbers); err != nil {
+		return err
+	}
+
+	if err := s.kickOffFleetSidekickUnits(unitNumbers); err != nil {
+		return err
+	}
+
+	if err := s.waitForAllSyncGwNodesRunning(); err != nil {
+		return err
+	}
+
+	log.Printf("Added sync gateway units %v", unitNumbers)
+
+	return nil
+
+}
+
+func (s SyncGwCluster) scaleIn(unitNumbers []int, drainSeconds int) error {
+
+	// remove the highest unit number first
+	for i := len(unitNumbers) - 1; i >= 0; i-- {
+		if err := s.removeSyncGwNode(unitNumbers[i], drainSeconds); err != nil {
+			return fmt.Errorf("Failed to remove %v@%v: %v", UNIT_NAME_SYNC_GW_NODE, unitNumbers[i], err)
+		}
+	}
+
+	return nil
+
+}
+
+// Drain a single sync gateway and destroy its units:
+//
+//   - destroy the sidekick, so that it stops publishing the node into etcd
+//   - remove the node from etcd, so load balancers stop sending it new requests
+//   - wait for in-flight requests to finish
+//   - take its databases offline, which closes any remaining _changes feeds
+//   - destroy the node unit
+func (s SyncGwCluster) removeSyncGwNode(unitNumber int, drainSeconds int) error {
+
+	nodeUnitName := fmt.Sprintf("%v@%v.service", UNIT_NAME_SYNC_GW_NODE, unitNumber)
+	sidekickUnitName := fmt.Sprintf("%v@%v.service", UNIT_NAME_SYNC_GW_SIDEKICK, unitNumber)
+
+	nodeIp, err := findUnitMachineIp(nodeUnitName)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Draining sync gateway %v on %v", nodeUnitName, nodeIp)
+
+	// find the admin port while the node is still registered in etcd
+	adminClients, err := s.SyncGwAdminClients(nodeIp)
+	if err != nil {
+		return err
+	}
+
+	if err := DELETE(fmt.Sprintf("%v/units/%v", FLEET_API_ENDPOINT, sidekickUnitName)); err != nil {
+		return err
+	}
+	if err := waitUntilUnitDestroyed(sidekickUnitName); err != nil {
+		return err
+	}
+
+	_, err = s.etcdClient.Delete(path.Join(KEY_SYNC_GW_NODE_STATE, nodeIp), false)
+	if err != nil && !isEtcdKeyNotFound(err) {
+		return err
+	}
+
+	log.Printf("Waiting %v seconds for requests to %v to drain", drainSeconds, nodeIp)
+	<-time.After(time.Second * time.Duration(drainSeconds))
+
+	takeDatabasesOffline(adminClients)
+
+	if err := DELETE(fmt.Sprintf("%v/units/%v", FLEET_API_ENDPOINT, nodeUnitName)); err != nil {
+		return err
+	}
+	if err := waitUntilUnitDestroyed(nodeUnitName); err != nil {
+		return err
+	}
+
+	log.Printf("Removed sync gateway %v", nodeUnitName)
+
+	return nil
+
+}
+
+// Best effort, since the admin api may not be reachable from here, and
+// the node is about to be destroyed anyway.
+func takeDatabasesOffline(clients []*SyncGwAdminClient) {
+
+	for _, client := range clients {
+		databases, err := client.ListDatabases()
+		if err != nil {
+			log.Printf("Not taking databases on %v offline: %v", client.AdminUrl, err)
+			continue
+		}
+		for _, db := range databases {
+			if err := client.TakeDatabaseOffline(db); err != nil {
+				log.Printf("Error taking %v on %v offline: %v", db, client.AdminUrl, err)
+			}
+		}
+	}
+
+}
+
+// The unit numbers first through last, inclusive
+func unitNumberRange(first, last int) []int {
+	unitNumbers := []int{}
+	for i := first; i <= last; i++ {
+		unitNumbers = append(unitNumbers, i)
+	}
+	return unitNumbers
+}
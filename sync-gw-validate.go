@@ -0,0 +1,199 @@
+package cbcluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A problem found in a sync gateway config.  Line and Column are 1-based,
+// and are 0 if unknown.
+type SyncGwConfigError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e SyncGwConfigError) Error() string {
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		return fmt.Sprintf("line %v, column %v: %v", e.Line, e.Column, e.Message)
+	case e.Line > 0:
+		return fmt.Sprintf("line %v: %v", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+type SyncGwConfigErrors []SyncGwConfigError
+
+func (errs SyncGwConfigErrors) Error() string {
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("Invalid sync gw config:\n  %v", strings.Join(messages, "\n  "))
+}
+
+// eg "template: sgw_config:3: unexpected ..." or "template: sgw_config:3:15: executing ..."
+var templateErrorRegexp = regexp.MustCompile(`^template: [^:]+:(\d+)(?::(\d+))?: (.*)$`)
+
+// Values used to render the config template during validation, in place
+// of the ones that would be discovered from the cluster.
+func SampleSyncGwConfigParams() SyncGwConfigParams {
+	return SyncGwConfigParams{
+		COUCHBASE_SERVER_IP:   "127.0.0.1",
+		COUCHBASE_SERVER_IPS:  []string{"127.0.0.1", "127.0.0.2"},
+		COUCHBASE_SERVER_LIST: "127.0.0.1,127.0.0.2",
+		BUCKETS:               []string{"default"},
+		ADMIN_USERNAME:        "Administrator",
+		ADMIN_PASSWORD:        "password",
+		ENV:                   environmentMap(),
+	}
+}
+
+// Check that the config template can be rendered, and that the result
+// is json with the fields sync gateway needs.  Returns a SyncGwConfigErrors
+// if there are any problems.
+func ValidateSyncGwConfig(config string) error {
+
+	s := SyncGwCluster{}
+	rendered, err := s.UpdateConfig(SampleSyncGwConfigParams(), config)
+	if err != nil {
+		return SyncGwConfigErrors{templateError(err)}
+	}
+
+	jsonConfig := SyncGwConfigToJson(rendered)
+
+	var parsed interface{}
+	if err := json.Unmarshal(jsonConfig, &parsed); err != nil {
+		return SyncGwConfigErrors{jsonError(jsonConfig, err)}
+	}
+
+	errs := checkSyncGwConfigFields(jsonConfig, parsed)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+
+}
+
+// Make sure there is at least one database, and that each has a server and bucket
+func checkSyncGwConfigFields(jsonConfig []byte, parsed interface{}) SyncGwConfigErrors {
+
+	errs := SyncGwConfigErrors{}
+
+	configMap, ok := parsed.(map[string]interface{})
+	if !ok {
+		return append(errs, SyncGwConfigError{Line: 1, Column: 1, Message: "Config must be a json object"})
+	}
+
+	databasesOffset := bytes.Index(jsonConfig, []byte(`"databases"`))
+
+	databases, ok := configMap["databases"].(map[string]interface{})
+	if !ok || len(databases) == 0 {
+		err := SyncGwConfigError{Message: `Missing or empty "databases"`}
+		if databasesOffset != -1 {
+			err.Line, err.Column = lineAndColumn(jsonConfig, databasesOffset)
+		}
+		return append(errs, err)
+	}
+
+	for _, dbName := range sortedKeys(databases) {
+
+		err := SyncGwConfigError{}
+		if databasesOffset != -1 {
+			dbOffset := bytes.Index(jsonConfig[databasesOffset:], []byte(strconv.Quote(dbName)))
+			if dbOffset != -1 {
+				err.Line, err.Column = lineAndColumn(jsonConfig, databasesOffset+dbOffset)
+			}
+		}
+
+		dbConfig, ok := databases[dbName].(map[string]interface{})
+		if !ok {
+			err.Message = fmt.Sprintf("Database %v must be a json object", dbName)
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, field := range []string{"server", "bucket"} {
+			value, ok := dbConfig[field].(string)
+			if !ok || value == "" {
+				err.Message = fmt.Sprintf("Database %v is missing %q", dbName, field)
+				errs = append(errs, err)
+			}
+		}
+
+	}
+
+	return errs
+
+}
+
+func templateError(err error) SyncGwConfigError {
+
+	configErr := SyncGwConfigError{Message: err.Error()}
+
+	match := templateErrorRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return configErr
+	}
+
+	configErr.Line, _ = strconv.Atoi(match[1])
+	configErr.Column, _ = strconv.Atoi(match[2])
+	configErr.Message = match[3]
+	return configErr
+
+}
+
+func jsonError(jsonConfig []byte, err error) SyncGwConfigError {
+
+	configErr := SyncGwConfigError{Message: err.Error()}
+
+	offset := int64(-1)
+	switch jsonErr := err.(type) {
+	case *json.SyntaxError:
+		offset = jsonErr.Offset
+	case *json.UnmarshalTypeError:
+		offset = jsonErr.Offset
+	}
+
+	if offset >= 0 {
+		// the offset is just past the offending character
+		if offset > 0 {
+			offset -= 1
+		}
+		configErr.Line, configErr.Column = lineAndColumn(jsonConfig, int(offset))
+	}
+
+	return configErr
+
+}
+
+// Convert a byte offset into a 1-based line and column
+func lineAndColumn(content []byte, offset int) (line, column int) {
+
+	if offset > len(content) {
+		offset = len(content)
+	}
+	before := content[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = offset - bytes.LastIndex(before, []byte("\n"))
+	return line, column
+
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+
+}
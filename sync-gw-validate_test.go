@@ -0,0 +1,58 @@
+package cbcluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestValidateSyncGwConfig(t *testing.T) {
+
+	config := `{
+  "databases": {
+    "todos": {
+      "server": "http://{{ .COUCHBASE_SERVER_IP }}:8091",
+      "bucket": "todos",
+      "sync": ` + "`" + `
+        function(doc) {
+          channel(doc.channels);
+        }
+      ` + "`" + `
+    }
+  }
+}`
+	assert.True(t, ValidateSyncGwConfig(config) == nil)
+
+}
+
+func TestValidateSyncGwConfigErrors(t *testing.T) {
+
+	// bad template
+	err := ValidateSyncGwConfig("{\n  \"databases\": {{ .NOPE }\n}")
+	errs, ok := err.(SyncGwConfigErrors)
+	assert.True(t, ok)
+	assert.Equals(t, errs[0].Line, 2)
+
+	// bad json after a multi-line sync function -- the line number should
+	// still match the original config
+	config := "{\n  \"sync\": `function(doc) {\n\n}`,\n  \"databases\": {\n}"
+	errs, ok = ValidateSyncGwConfig(config).(SyncGwConfigErrors)
+	assert.True(t, ok)
+	assert.Equals(t, errs[0].Line, 6)
+
+	// missing fields
+	config = "{\n  \"databases\": {\n    \"todos\": {\n      \"server\": \"walrus:\"\n    }\n  }\n}"
+	errs, ok = ValidateSyncGwConfig(config).(SyncGwConfigErrors)
+	assert.True(t, ok)
+	assert.Equals(t, len(errs), 1)
+	assert.Equals(t, errs[0].Line, 3)
+	assert.Equals(t, errs[0].Column, 5)
+	assert.True(t, strings.Contains(errs[0].Error(), `"bucket"`))
+
+	// no databases
+	errs, ok = ValidateSyncGwConfig(`{"log": ["REST"]}`).(SyncGwConfigErrors)
+	assert.True(t, ok)
+	assert.Equals(t, len(errs), 1)
+
+}
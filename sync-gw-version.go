@@ -0,0 +1,137 @@
+package cbcluster
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	SYNC_GW_IMAGE = "couchbase/sync-gateway"
+)
+
+// The range of Couchbase Server versions that each Sync Gateway release
+// supports, as major.minor.  A MaxServer of "" means no known upper bound.
+// Only used to warn, so it errs on the side of being permissive.
+var syncGwCompatibility = []struct {
+	SyncGw    string
+	MinServer string
+	MaxServer string
+}{
+	{"1.0", "2.5", "3.1"},
+	{"1.1", "3.0", "4.6"},
+	{"1.2", "3.0", "4.6"},
+	{"1.3", "3.0", "4.6"},
+	{"1.4", "4.0", "5.5"},
+	{"1.5", "4.0", "5.5"},
+	{"2.0", "5.0", "6.0"},
+	{"2.1", "5.0", "6.0"},
+	{"2.5", "5.0", "6.5"},
+	{"2.6", "5.0", "6.5"},
+	{"2.7", "5.5", "6.6"},
+	{"2.8", "5.5", "7.0"},
+	{"3.0", "6.5", ""},
+}
+
+// The docker tag for the sync gateway image, eg 1.1.0-community.  If no
+// version is given, the image is unpinned and pulls latest, which can't be
+// combined with an edition.
+func syncGwImageTag(version, edition string) (string, error) {
+
+	if version == "" || version == "latest" {
+		if edition != "" {
+			return "", fmt.Errorf("The %v edition needs a sync gateway version, eg 1.1.0, "+
+				"since the latest image is not tied to an edition", edition)
+		}
+		return "latest", nil
+	}
+
+	if _, err := ParseCouchbaseVersion(version); err != nil {
+		return "", fmt.Errorf("Invalid sync gateway version: %v.  Expected eg 1.1.0", version)
+	}
+
+	if edition == "" {
+		edition = "community"
+	}
+
+	switch edition {
+	case "community", "enterprise":
+		return fmt.Sprintf("%v-%v", version, edition), nil
+	default:
+		return "", fmt.Errorf("Invalid value for edition: %v", edition)
+	}
+
+}
+
+// Whether the given sync gateway version is known to work with the given
+// couchbase server version, eg "1.1.0" and "3.0.1-1444-rel-community".
+// Versions that aren't in the compatibility table are assumed to work.
+// Sync gateway versions have the same form as couchbase server ones, and
+// both are compared by major.minor.
+func syncGwSupportsServer(syncGwVersion, serverVersion string) (bool, error) {
+
+	syncGw, err := ParseCouchbaseVersion(syncGwVersion)
+	if err != nil {
+		return false, err
+	}
+	server, err := ParseCouchbaseVersion(serverVersion)
+	if err != nil {
+		return false, err
+	}
+	syncGw, server = syncGw.MajorMinor(), server.MajorMinor()
+
+	for _, compat := range syncGwCompatibility {
+
+		if syncGw.Compare(mustParseCouchbaseVersion(compat.SyncGw)) != 0 {
+			continue
+		}
+
+		if !server.AtLeast(compat.MinServer) {
+			return false, nil
+		}
+		if compat.MaxServer != "" && server.Compare(mustParseCouchbaseVersion(compat.MaxServer)) > 0 {
+			return false, nil
+		}
+		return true, nil
+
+	}
+
+	return true, nil
+
+}
+
+// Warn if the pinned sync gateway version isn't known to support the
+// version of couchbase server that's running.  This never fails the launch,
+// since the compatibility table can't cover every release.
+func (s SyncGwCluster) warnIfIncompatible() {
+
+	if s.SyncGwVersion == "" || s.SyncGwVersion == "latest" || !s.RequiresCouchbaseServer {
+		return
+	}
+
+	cb := NewCouchbaseCluster(s.EtcdServers)
+
+	liveNodeIp, err := cb.FindLiveNode()
+	if err != nil {
+		log.Printf("Warning: could not find a couchbase server node to check compatibility with: %v", err)
+		return
+	}
+	cb.LocalCouchbaseIp = liveNodeIp
+
+	if err := cb.FetchClusterDetails(); err != nil {
+		log.Printf("Warning: could not get the couchbase server version to check compatibility with: %v", err)
+		return
+	}
+
+	supported, err := syncGwSupportsServer(s.SyncGwVersion, cb.LocalCouchbaseVersion)
+	if err != nil {
+		log.Printf("Warning: could not check compatibility: %v", err)
+		return
+	}
+	if !supported {
+		log.Printf("WARNING: Sync Gateway %v is not known to support Couchbase Server %v", s.SyncGwVersion, cb.LocalCouchbaseVersion)
+		return
+	}
+
+	log.Printf("Sync Gateway %v supports Couchbase Server %v", s.SyncGwVersion, cb.LocalCouchbaseVersion)
+
+}
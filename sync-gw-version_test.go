@@ -0,0 +1,71 @@
+package cbcluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestSyncGwImageTag(t *testing.T) {
+
+	tag, err := syncGwImageTag("", "")
+	assert.True(t, err == nil)
+	assert.Equals(t, tag, "latest")
+
+	tag, err = syncGwImageTag("1.1.0", "")
+	assert.True(t, err == nil)
+	assert.Equals(t, tag, "1.1.0-community")
+
+	tag, err = syncGwImageTag("1.1.0", "enterprise")
+	assert.True(t, err == nil)
+	assert.Equals(t, tag, "1.1.0-enterprise")
+
+	_, err = syncGwImageTag("1.1.0", "premium")
+	assert.True(t, err != nil)
+
+	_, err = syncGwImageTag("master", "")
+	assert.True(t, err != nil)
+
+	// an edition without a version would silently pull latest
+	_, err = syncGwImageTag("", "enterprise")
+	assert.True(t, err != nil)
+
+	_, err = syncGwImageTag("latest", "community")
+	assert.True(t, err != nil)
+
+}
+
+func TestSyncGwSupportsServer(t *testing.T) {
+
+	supported, err := syncGwSupportsServer("1.1.0", "3.0.1-1444-rel-community")
+	assert.True(t, err == nil)
+	assert.True(t, supported)
+
+	supported, _ = syncGwSupportsServer("1.0.4", "4.0.0-4051-enterprise")
+	assert.False(t, supported)
+
+	supported, _ = syncGwSupportsServer("2.0.0", "4.5.1-2844-enterprise")
+	assert.False(t, supported)
+
+	// the max server version covers its patch releases
+	supported, _ = syncGwSupportsServer("1.3.1", "4.6.3-4136-enterprise")
+	assert.True(t, supported)
+
+	// not in the table, so assumed to work
+	supported, _ = syncGwSupportsServer("9.9.0", "3.0.1")
+	assert.True(t, supported)
+
+	_, err = syncGwSupportsServer("1.1.0", "garbage")
+	assert.True(t, err != nil)
+
+}
+
+func TestGenerateSyncGwNodeFleetUnitFileVersion(t *testing.T) {
+
+	s := SyncGwCluster{SyncGwVersion: "1.1.0", SyncGwEdition: "enterprise"}
+	unitFile, err := s.generateNodeFleetUnitFile("1")
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(unitFile, "docker pull couchbase/sync-gateway:1.1.0-enterprise"))
+
+}
@@ -0,0 +1,356 @@
+package cbcluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tleyden/go-etcd/etcd"
+)
+
+const (
+	// how long to wait before re-establishing a watch that failed (eg, etcd restarted)
+	WATCH_RETRY_SLEEP_SECONDS = 10
+
+	// how long to let a burst of changes settle before re-rendering the config
+	WATCH_SETTLE_SECONDS = 2
+)
+
+var reloadSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// How to get a running process (Sync Gateway, or a load balancer) to pick
+// up a rewritten config.  Only one of Command, Pid, Container or AdminUrl
+// should be set.
+type SyncGwReloadHook struct {
+	Command   string         // shell command to run, eg "docker restart sync_gw"
+	Pid       string         // pid, or path to a pid file, of the process to signal
+	Container string         // name of a docker container to signal
+	Signal    syscall.Signal // signal to send to Pid or Container
+	AdminUrl  string         // sync gw admin api, eg http://localhost:4985
+}
+
+// Watch the sync gw config keys and the couchbase node state directory
+// in etcd, and call onChange whenever either of them changes.  Bursts of
+// changes are coalesced into a single call.  Never returns.
+func (s SyncGwCluster) WatchConfigChanges(onChange func()) {
+
+	s.watchEtcdKeys(onChange, KEY_SYNC_GW_CONFIG, KEY_SYNC_GW_CONFIG_CURRENT, KEY_NODE_STATE)
+
+}
+
+// Watch the given keys (recursively, if they are directories) and call
+// onChange whenever any of them change.  Never returns.
+func (s SyncGwCluster) watchEtcdKeys(onChange func(), keys ...string) {
+
+	changes := make(chan string, 1)
+
+	for _, key := range keys {
+		go s.watchEtcdKey(key, changes)
+	}
+
+	for reason := range changes {
+		log.Printf("Change detected: %v", reason)
+		<-time.After(time.Second * WATCH_SETTLE_SECONDS)
+		onChange()
+	}
+
+}
+
+// Watch a key in etcd and send a message to the changes channel for every
+// relevant change.  If the watch fails it is re-established, and a change is
+// sent since there's no way to know what was missed in the meantime.
+func (s SyncGwCluster) watchEtcdKey(key string, changes chan<- string) {
+
+	for {
+
+		receiver := make(chan *etcd.Response)
+		go func() {
+			for response := range receiver {
+				if isRelevantEtcdChange(response) {
+					notifyChange(changes, fmt.Sprintf("%v %v", response.Action, response.Node.Key))
+				}
+			}
+		}()
+
+		// closes receiver when it returns
+		_, err := s.etcdClient.Watch(key, 0, true, receiver, nil)
+		log.Printf("Watch on %v stopped: %v.  Will retry in %v seconds", key, err, WATCH_RETRY_SLEEP_SECONDS)
+		<-time.After(time.Second * WATCH_RETRY_SLEEP_SECONDS)
+
+		notifyChange(changes, fmt.Sprintf("re-established watch on %v", key))
+
+	}
+
+}
+
+// Send without blocking -- if there is already a pending change, there's no
+// need to queue up another one.
+func notifyChange(changes chan<- string, reason string) {
+	select {
+	case changes <- reason:
+	default:
+	}
+}
+
+// The node state keys are re-set with the same value every few seconds to
+// refresh their TTL, which shouldn't trigger a config rewrite.
+func isRelevantEtcdChange(response *etcd.Response) bool {
+
+	if response == nil || response.Node == nil {
+		return false
+	}
+
+	if response.PrevNode == nil {
+		return true
+	}
+
+	switch response.Action {
+	case "set", "update", "compareAndSwap":
+		return response.PrevNode.Value != response.Node.Value
+	}
+
+	return true
+
+}
+
+// Write the file to a temp file in the same directory and then rename it
+// into place, so that readers never see a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), fmt.Sprintf(".%v.", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Chmod(tempPath, perm); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+
+}
+
+// Convert from a signal name like "HUP" or "SIGHUP" to a signal
+func ParseSignal(name string) (syscall.Signal, error) {
+
+	name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	signal, ok := reloadSignals[name]
+	if !ok {
+		return 0, fmt.Errorf("Unsupported signal: %v", name)
+	}
+	return signal, nil
+
+}
+
+// The inverse of ParseSignal, eg syscall.SIGHUP -> "HUP"
+func signalName(signal syscall.Signal) string {
+
+	for name, candidate := range reloadSignals {
+		if candidate == signal {
+			return name
+		}
+	}
+	return strconv.Itoa(int(signal))
+
+}
+
+// Tell sync gateway about the config that was just written to configPath
+func (h SyncGwReloadHook) Reload(configPath string) error {
+
+	switch {
+	case h.Command != "":
+		return h.reloadCommand()
+	case h.Pid != "":
+		return h.reloadSignal()
+	case h.Container != "":
+		log.Printf("Sending %v to container %v", h.Signal, h.Container)
+		return signalDockerContainer(h.Container, signalName(h.Signal))
+	case h.AdminUrl != "":
+		config, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return err
+		}
+		return h.reloadAdminApi(config)
+	}
+
+	log.Printf("No reload hook configured, the new config will be used after a restart")
+	return nil
+
+}
+
+func (h SyncGwReloadHook) reloadCommand() error {
+
+	log.Printf("Running reload command: %v", h.Command)
+	cmd := exec.Command("/bin/sh", "-c", h.Command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Reload command %v failed: %v", h.Command, err)
+	}
+	return nil
+
+}
+
+func (h SyncGwReloadHook) reloadSignal() error {
+
+	pid, err := resolvePid(h.Pid)
+	if err != nil {
+		return err
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Sending %v to pid %v", h.Signal, pid)
+	return process.Signal(h.Signal)
+
+}
+
+// The pid can either be given directly, or via a pid file, which is
+// re-read each time since the pid will change when the process restarts.
+func resolvePid(pidOrFile string) (int, error) {
+
+	if pid, err := strconv.Atoi(pidOrFile); err == nil {
+		return pid, nil
+	}
+
+	content, err := ioutil.ReadFile(pidOrFile)
+	if err != nil {
+		return -1, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return -1, fmt.Errorf("Invalid pid in %v: %v", pidOrFile, err)
+	}
+	return pid, nil
+
+}
+
+// Push the config for each database to sync gateway via the admin api.
+// Existing databases are taken offline, reconfigured, and brought back
+// online.  New databases are created.  Databases that were removed from
+// the config are left alone, since deleting them is not something that
+// should happen automatically.
+func (h SyncGwReloadHook) reloadAdminApi(config []byte) error {
+
+	parsedConfig := struct {
+		Databases map[string]json.RawMessage `json:"databases"`
+	}{}
+	if err := json.Unmarshal(SyncGwConfigToJson(config), &parsedConfig); err != nil {
+		return fmt.Errorf("Could not parse sync gw config: %v", err)
+	}
+
+	client := NewSyncGwAdminClient(h.AdminUrl)
+
+	for dbName, dbConfig := range parsedConfig.Databases {
+
+		exists, err := client.DatabaseExists(dbName)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			log.Printf("Creating database %v", dbName)
+			if err := client.CreateDatabase(dbName, dbConfig); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Printf("Reconfiguring database %v", dbName)
+		if err := client.TakeDatabaseOffline(dbName); err != nil {
+			return err
+		}
+		if err := client.SetDatabaseConfig(dbName, dbConfig); err != nil {
+			return err
+		}
+		if err := client.BringDatabaseOnline(dbName); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+
+}
+
+// Sync gateway configs allow the sync function to be wrapped in backticks,
+// eg "sync": `function(doc) {...}`, which isn't valid json.  Convert any
+// backtick strings to regular json strings.  Line numbers are preserved.
+func SyncGwConfigToJson(config []byte) []byte {
+
+	out := &bytes.Buffer{}
+	inString := false
+
+	for i := 0; i < len(config); i++ {
+
+		c := config[i]
+
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(config) {
+				i++
+				out.WriteByte(config[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '`':
+			end := bytes.IndexByte(config[i+1:], '`')
+			if end == -1 {
+				// unterminated, let the json parser report it
+				out.Write(config[i:])
+				return out.Bytes()
+			}
+			backtickString := config[i+1 : i+1+end]
+			quoted, _ := json.Marshal(string(backtickString))
+			out.Write(quoted)
+			// pad with the newlines that were escaped, so that line
+			// numbers in the json match the original config
+			out.Write(bytes.Repeat([]byte("\n"), bytes.Count(backtickString, []byte("\n"))))
+			i += end + 1
+		default:
+			out.WriteByte(c)
+		}
+
+	}
+
+	return out.Bytes()
+
+}
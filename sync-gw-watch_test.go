@@ -0,0 +1,92 @@
+package cbcluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+	"github.com/tleyden/go-etcd/etcd"
+)
+
+func TestIsRelevantEtcdChange(t *testing.T) {
+
+	nodeState := `{"ip":"10.0.0.1","port":8091}`
+
+	// a new node showing up
+	response := &etcd.Response{
+		Action: "set",
+		Node:   &etcd.Node{Key: "/couchbase.com/couchbase-node-state/10.0.0.1", Value: nodeState},
+	}
+	assert.True(t, isRelevantEtcdChange(response))
+
+	// the same node refreshing its ttl
+	response.PrevNode = &etcd.Node{Key: response.Node.Key, Value: nodeState}
+	assert.False(t, isRelevantEtcdChange(response))
+
+	// the node going away
+	response.Action = "expire"
+	assert.True(t, isRelevantEtcdChange(response))
+
+	// the config url changing
+	response = &etcd.Response{
+		Action:   "set",
+		Node:     &etcd.Node{Key: KEY_SYNC_GW_CONFIG, Value: "http://foo.com/b.json"},
+		PrevNode: &etcd.Node{Key: KEY_SYNC_GW_CONFIG, Value: "http://foo.com/a.json"},
+	}
+	assert.True(t, isRelevantEtcdChange(response))
+
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "sync-gw-watch")
+	assert.True(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, "config.json")
+	assert.True(t, WriteFileAtomic(dest, []byte("one"), 0644) == nil)
+	assert.True(t, WriteFileAtomic(dest, []byte("two"), 0644) == nil)
+
+	content, err := ioutil.ReadFile(dest)
+	assert.True(t, err == nil)
+	assert.Equals(t, string(content), "two")
+
+	// no temp files left behind
+	entries, err := ioutil.ReadDir(dir)
+	assert.True(t, err == nil)
+	assert.Equals(t, len(entries), 1)
+
+}
+
+func TestParseSignal(t *testing.T) {
+
+	signal, err := ParseSignal("hup")
+	assert.True(t, err == nil)
+	assert.Equals(t, signal, syscall.SIGHUP)
+
+	signal, err = ParseSignal("SIGUSR1")
+	assert.True(t, err == nil)
+	assert.Equals(t, signal, syscall.SIGUSR1)
+
+	_, err = ParseSignal("KILLALL")
+	assert.True(t, err != nil)
+
+}
+
+func TestSyncGwConfigToJson(t *testing.T) {
+
+	config := "{\"databases\": {\"db\": {\"sync\": `function(doc) {\n  channel(\"ab\");\n}`, \"note\": \"a `quoted` string\"}}}"
+
+	parsed := struct {
+		Databases map[string]map[string]string `json:"databases"`
+	}{}
+	err := json.Unmarshal(SyncGwConfigToJson([]byte(config)), &parsed)
+	assert.True(t, err == nil)
+	assert.Equals(t, parsed.Databases["db"]["sync"], "function(doc) {\n  channel(\"ab\");\n}")
+	assert.Equals(t, parsed.Databases["db"]["note"], "a `quoted` string")
+
+}
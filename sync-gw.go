@@ -2,11 +2,15 @@ package cbcluster
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -17,20 +21,45 @@ import (
 const (
 	KEY_SYNC_GW_NODE_STATE = "/couchbase.com/sync-gw-node-state"
 	KEY_SYNC_GW_CONFIG     = "/couchbase.com/sync-gateway/config"
+
+	DEFAULT_SYNC_GW_PORT       = 4984
+	DEFAULT_SYNC_GW_ADMIN_PORT = 4985
+
+	UNIT_NAME_SYNC_GW_NODE     = "sync_gw_node"
+	UNIT_NAME_SYNC_GW_SIDEKICK = "sync_gw_sidekick"
 )
 
+// What each sync gw sidekick publishes into etcd under KEY_SYNC_GW_NODE_STATE
+type SyncGwNodeState struct {
+	Ip        string   `json:"ip"`
+	Port      int      `json:"port"`
+	AdminPort int      `json:"admin_port"`
+	Databases []string `json:"databases,omitempty"`
+	Status    string   `json:"status,omitempty"` // SYNC_GW_STATUS_HEALTHY or SYNC_GW_STATUS_UNHEALTHY
+	Reason    string   `json:"reason,omitempty"` // why the node is unhealthy
+}
+
 type SyncGwCluster struct {
 	etcdClient               *etcd.Client
 	EtcdServers              []string
 	NumNodes                 int
 	ContainerTag             string
+	SyncGwVersion            string // sync gateway image version, eg 1.1.0, or empty for latest
+	SyncGwEdition            string // community or enterprise
 	ConfigUrl                string
+	ConfigFile               string
 	CreateBucketName         string
 	CreateBucketSize         int
 	CreateBucketReplicaCount int
 	LocalIp                  string
+	Port                     int      // sync gw public port, published by the sidekick
+	AdminPort                int      // sync gw admin port, published by the sidekick
+	Databases                []string // databases in the sync gw config, published by the sidekick
 	RequiresCouchbaseServer  bool
-	LaunchNginxEnabled       bool
+	LoadBalancerType         string // nginx, haproxy, or empty for no load balancer
+	Templates                UnitTemplates
+	DryRun                   bool // print what would be launched, without changing anything
+	Placement                MachinePlacement
 }
 
 func NewSyncGwCluster(etcdServers []string) *SyncGwCluster {
@@ -55,6 +84,17 @@ func (s *SyncGwCluster) ConnectToEtcd() {
 	s.etcdClient.SetConsistency(etcd.STRONG_CONSISTENCY)
 }
 
+// Extract --sgw-version and --edition, and make sure they make a valid image tag
+func (s *SyncGwCluster) ExtractSyncGwVersion(arguments map[string]interface{}) error {
+
+	s.SyncGwVersion, _ = ExtractStringArg(arguments, "--sgw-version")
+	s.SyncGwEdition, _ = ExtractStringArg(arguments, "--edition")
+
+	_, err := syncGwImageTag(s.SyncGwVersion, s.SyncGwEdition)
+	return err
+
+}
+
 func (s *SyncGwCluster) ExtractDocOptArgs(arguments map[string]interface{}) error {
 
 	numnodes, err := ExtractNumNodes(arguments)
@@ -63,14 +103,11 @@ func (s *SyncGwCluster) ExtractDocOptArgs(arguments map[string]interface{}) erro
 	}
 	s.NumNodes = numnodes
 
-	configUrl, err := ExtractStringArg(arguments, "--config-url")
-	if err != nil {
-		return err
+	s.ConfigUrl, _ = ExtractStringArg(arguments, "--config-url")
+	s.ConfigFile, _ = ExtractStringArg(arguments, "--config-file")
+	if s.ConfigUrl == "" && s.ConfigFile == "" {
+		return fmt.Errorf("Missing or empty config url or config file")
 	}
-	if configUrl == "" {
-		return fmt.Errorf("Missing or empty config url")
-	}
-	s.ConfigUrl = configUrl
 
 	createBucketName, _ := ExtractStringArg(arguments, "--create-bucket")
 	if createBucketName != "" {
@@ -91,24 +128,122 @@ func (s *SyncGwCluster) ExtractDocOptArgs(arguments map[string]interface{}) erro
 
 	s.ContainerTag = ExtractDockerTagOrLatest(arguments)
 
+	if err := s.ExtractSyncGwVersion(arguments); err != nil {
+		return err
+	}
+
+	templates, err := ExtractUnitTemplates(arguments)
+	if err != nil {
+		return err
+	}
+	s.Templates = templates
+
+	s.DryRun = ExtractBoolArg(arguments, "--dry-run")
+
+	placement, err := ExtractMachinePlacement(arguments)
+	if err != nil {
+		return err
+	}
+	s.Placement = placement
+
 	s.RequiresCouchbaseServer = !ExtractBoolArg(arguments, "--in-memory-db")
 
-	s.LaunchNginxEnabled = ExtractBoolArg(arguments, "--launch-nginx")
+	s.LoadBalancerType, _ = ExtractStringArg(arguments, "--load-balancer")
+	if ExtractBoolArg(arguments, "--launch-nginx") {
+		s.LoadBalancerType = LB_TYPE_NGINX
+	}
+	if s.LoadBalancerType != "" {
+		if err := ValidateLoadBalancerType(s.LoadBalancerType); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (s SyncGwCluster) UpdateConfig(liveNodeIp, configTemplate string) (config []byte, err error) {
+// The values available to the sync gateway config template, eg:
+//
+//	"server": "http://{{ .COUCHBASE_SERVER_IP }}:8091"
+//	"server": "couchbase://{{ .COUCHBASE_SERVER_LIST }}"
+type SyncGwConfigParams struct {
+	COUCHBASE_SERVER_IP   string            // a single live couchbase node
+	COUCHBASE_SERVER_IPS  []string          // all live couchbase nodes
+	COUCHBASE_SERVER_LIST string            // all live couchbase nodes, comma separated
+	BUCKETS               []string          // the buckets in the couchbase cluster
+	ADMIN_USERNAME        string            // couchbase admin creds from etcd
+	ADMIN_PASSWORD        string            //
+	ENV                   map[string]string // the environment variables of this process
+}
+
+// Discover the values for the sync gateway config template from etcd
+// and the couchbase cluster.  The live nodes are required, since a config
+// without a server isn't usable, but the credentials and buckets are best
+// effort and are left empty if they can't be found.
+func (s SyncGwCluster) BuildConfigParams() (SyncGwConfigParams, error) {
+
+	params := SyncGwConfigParams{
+		COUCHBASE_SERVER_IPS: []string{},
+		BUCKETS:              []string{},
+		ENV:                  environmentMap(),
+	}
 
-	tmpl, err := template.New("sgw_config").Parse(configTemplate)
+	cb := NewCouchbaseCluster(s.EtcdServers)
+
+	liveNodeIps, err := cb.FindLiveNodes()
 	if err != nil {
-		return nil, err
+		return params, err
 	}
+	log.Printf("Live couchbase nodes: %v", liveNodeIps)
 
-	params := struct {
-		COUCHBASE_SERVER_IP string
-	}{
-		COUCHBASE_SERVER_IP: liveNodeIp,
+	if len(liveNodeIps) == 0 {
+		return params, fmt.Errorf("No live couchbase server nodes found under %v in etcd", KEY_NODE_STATE)
+	}
+
+	params.COUCHBASE_SERVER_IP = liveNodeIps[0]
+	params.COUCHBASE_SERVER_IPS = liveNodeIps
+	params.COUCHBASE_SERVER_LIST = strings.Join(liveNodeIps, ",")
+
+	if err := cb.LoadAdminCredsFromEtcd(); err != nil {
+		log.Printf("Warning, could not load couchbase admin credentials: %v.  "+
+			"Leaving ADMIN_USERNAME and ADMIN_PASSWORD empty", err)
+	} else {
+		params.ADMIN_USERNAME = cb.AdminUsername
+		params.ADMIN_PASSWORD = cb.AdminPassword
+	}
+
+	buckets, err := cb.GetBucketNames(liveNodeIps[0])
+	if err != nil {
+		log.Printf("Warning, could not list couchbase buckets: %v.  Leaving BUCKETS empty", err)
+		return params, nil
+	}
+	params.BUCKETS = buckets
+
+	return params, nil
+
+}
+
+func environmentMap() map[string]string {
+
+	env := map[string]string{}
+	for _, keyValue := range os.Environ() {
+		components := strings.SplitN(keyValue, "=", 2)
+		if len(components) == 2 {
+			env[components[0]] = components[1]
+		}
+	}
+	return env
+
+}
+
+func (s SyncGwCluster) UpdateConfig(params SyncGwConfigParams, configTemplate string) (config []byte, err error) {
+
+	funcMap := template.FuncMap{
+		"join": strings.Join,
+	}
+
+	tmpl, err := template.New("sgw_config").Funcs(funcMap).Parse(configTemplate)
+	if err != nil {
+		return nil, err
 	}
 
 	out := &bytes.Buffer{}
@@ -123,25 +258,24 @@ func (s SyncGwCluster) UpdateConfig(liveNodeIp, configTemplate string) (config [
 
 }
 
+// Get the current config stored in etcd, or if there isn't one (clusters
+// launched before the config content was stored in etcd), fetch it
+// from the config url.
 func (s SyncGwCluster) FetchSyncGwConfig() (config string, err error) {
 	log.Printf("FetchSyncGwConfig()")
-	configUrl, err := s.FetchSyncGwConfigUrl()
-	if err != nil {
-		return "", err
+	revision, err := s.CurrentSyncGwConfig()
+	if err == nil {
+		log.Printf("Using config revision %v from %v", revision.Revision, revision.Source)
+		return revision.Content, nil
 	}
-	resp, err := http.Get(configUrl)
-	if err != nil {
-		return "", fmt.Errorf("Error %v getting sync gw config from %v", err, configUrl)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Invalid status %v getting sync gw config from %v", resp.StatusCode, configUrl)
+	if !isEtcdKeyNotFound(err) {
+		return "", err
 	}
-	bytes, err := ioutil.ReadAll(resp.Body)
+	configUrl, err := s.FetchSyncGwConfigUrl()
 	if err != nil {
 		return "", err
 	}
-	return string(bytes), nil
+	return fetchSyncGwConfigUrl(configUrl)
 }
 
 func (s SyncGwCluster) FetchSyncGwConfigUrl() (configUrl string, err error) {
@@ -154,25 +288,56 @@ func (s SyncGwCluster) FetchSyncGwConfigUrl() (configUrl string, err error) {
 
 func (s SyncGwCluster) LaunchSyncGateway() error {
 
+	if s.DryRun {
+		plan, err := s.Plan()
+		if err != nil {
+			return err
+		}
+		plan.Print(os.Stdout)
+		return nil
+	}
+
 	log.Printf("Launching sync gw")
 
+	if s.SyncGwVersion == "" {
+		log.Printf("Warning: no --sgw-version given, sync gateway image is unpinned and will pull latest")
+	}
+
+	// load and check the config before doing anything else, so that a
+	// bad config doesn't leave behind a half launched cluster
+	configContent, configSource, err := LoadSyncGwConfig(s.ConfigFile, s.ConfigUrl)
+	if err != nil {
+		return err
+	}
+	if err := ValidateSyncGwConfig(configContent); err != nil {
+		return err
+	}
+
+	// make sure the units have somewhere to run
+	unitNumbers := unitNumberRange(1, s.NumNodes)
+	if err := s.placeUnits(unitNumbers); err != nil {
+		return err
+	}
+
 	// create bucket (if user asked for this)
 	if err := s.createBucketIfNeeded(); err != nil {
 		return err
 	}
 
+	s.warnIfIncompatible()
+
 	// stash some values into etcd
-	if err := s.addValuesEtcd(); err != nil {
+	if err := s.addValuesEtcd(configContent, configSource); err != nil {
 		return err
 	}
 
 	// kick off fleet units
-	if err := s.kickOffFleetUnits(); err != nil {
+	if err := s.kickOffFleetUnits(unitNumbers); err != nil {
 		return err
 	}
 
 	// kick off fleet sidekicks
-	if err := s.kickOffFleetSidekickUnits(); err != nil {
+	if err := s.kickOffFleetSidekickUnits(unitNumbers); err != nil {
 		return err
 	}
 
@@ -181,14 +346,14 @@ func (s SyncGwCluster) LaunchSyncGateway() error {
 		return err
 	}
 
-	// launch nginx (if enabled by command line arg)
-	if s.LaunchNginxEnabled {
-		log.Printf("Launching Nginx")
-		if err := s.LaunchNginx(); err != nil {
+	// launch load balancer (if enabled by command line arg)
+	if s.LoadBalancerType != "" {
+		log.Printf("Launching %v load balancer", s.LoadBalancerType)
+		if err := s.LaunchLoadBalancer(); err != nil {
 			return err
 		}
 	} else {
-		log.Printf("Not Launching Nginx")
+		log.Printf("Not launching load balancer")
 	}
 
 	log.Printf("Your sync gateway cluster has been launched successfully!")
@@ -196,26 +361,144 @@ func (s SyncGwCluster) LaunchSyncGateway() error {
 	return nil
 }
 
+// Everything LaunchSyncGateway would do, without doing it.  Checks that
+// would make the launch fail are reported as warnings rather than errors,
+// so that the whole plan can be reviewed.
+func (s SyncGwCluster) Plan() (LaunchPlan, error) {
+
+	plan := LaunchPlan{}
+
+	plan.AddFleetMachines()
+
+	if s.SyncGwVersion == "" {
+		plan.AddWarning("No --sgw-version given, sync gateway image is unpinned and will pull latest")
+	}
+
+	configContent, configSource, err := LoadSyncGwConfig(s.ConfigFile, s.ConfigUrl)
+	if err != nil {
+		plan.AddWarning("Launch would fail: %v", err)
+	} else if err := ValidateSyncGwConfig(configContent); err != nil {
+		plan.AddWarning("Launch would fail, invalid config: %v", err)
+	} else {
+		s.planConfigRevision(&plan, configContent, configSource)
+	}
+
+	if s.ConfigUrl != "" {
+		plan.AddEtcdKey(KEY_SYNC_GW_CONFIG, s.ConfigUrl)
+	}
+
+	if s.CreateBucketName != "" {
+		plan.Buckets = append(plan.Buckets, PlannedBucket{
+			Name:          s.CreateBucketName,
+			RamQuotaMB:    s.CreateBucketSize,
+			ReplicaNumber: s.CreateBucketReplicaCount,
+		})
+	}
+
+	if err := s.placeUnits(unitNumberRange(1, s.NumNodes)); err != nil {
+		plan.AddWarning("Launch would fail: %v", err)
+	}
+
+	for _, i := range unitNumberRange(1, s.NumNodes) {
+		nodeUnitFile, err := s.generateNodeFleetUnitFile(fmt.Sprintf("%v", i))
+		if err != nil {
+			return plan, err
+		}
+		if err := plan.AddUnit(fmt.Sprintf("%v@%v.service", UNIT_NAME_SYNC_GW_NODE, i), nodeUnitFile); err != nil {
+			return plan, err
+		}
+	}
+
+	for _, i := range unitNumberRange(1, s.NumNodes) {
+		sidekickUnitFile, err := s.generateSidekickFleetUnitFile(fmt.Sprintf("%v", i))
+		if err != nil {
+			return plan, err
+		}
+		if err := plan.AddUnit(fmt.Sprintf("%v@%v.service", UNIT_NAME_SYNC_GW_SIDEKICK, i), sidekickUnitFile); err != nil {
+			return plan, err
+		}
+	}
+
+	if s.LoadBalancerType != "" {
+		lbUnits, err := s.loadBalancerUnits()
+		if err != nil {
+			return plan, err
+		}
+		for _, lbUnit := range lbUnits {
+			unitFile, err := s.Templates.Generate(lbUnit.unitFilePath, lbUnit.params)
+			if err != nil {
+				return plan, err
+			}
+			if err := plan.AddUnit(fmt.Sprintf("%v.service", lbUnit.unitName), unitFile); err != nil {
+				return plan, err
+			}
+		}
+	}
+
+	return plan, nil
+
+}
+
+// The etcd keys StoreSyncGwConfig would set for this config
+func (s SyncGwCluster) planConfigRevision(plan *LaunchPlan, configContent, configSource string) {
+
+	nextRevision := 1
+
+	current, err := s.CurrentSyncGwConfig()
+	switch {
+	case err == nil:
+		if current.Content == configContent {
+			plan.AddWarning("Config from %v is the same as current revision %v, it won't be stored again", configSource, current.Revision)
+			return
+		}
+		nextRevision = current.Revision + 1
+	case !isEtcdKeyNotFound(err):
+		plan.AddWarning("Could not get the current config revision: %v", err)
+	}
+
+	plan.AddEtcdKey(
+		syncGwConfigRevisionKey(nextRevision),
+		fmt.Sprintf("config revision %v, %v bytes from %v", nextRevision, len(configContent), configSource),
+	)
+	plan.AddEtcdKey(KEY_SYNC_GW_CONFIG_CURRENT, fmt.Sprintf("%v", nextRevision))
+
+}
+
+// Resolve the values to spread the sync gateways across, and make sure
+// there are enough eligible machines for all of the given unit numbers
+func (s *SyncGwCluster) placeUnits(unitNumbers []int) error {
+
+	machines, err := findAllFleetMachines()
+	if err != nil {
+		return err
+	}
+
+	s.Placement = s.Placement.Resolve(machines)
+
+	return s.Placement.VerifyEnoughMachines(unitNumbers, machines)
+
+}
+
 // wait for s.NumNodes to appear in etcd /couchbase.com/sgw-node-state
-// and able to be reached on port 4984
+// and able to be reached on the port they advertise
 func (s SyncGwCluster) waitForAllSyncGwNodesRunning() error {
 
 	maxAttempts := 50
 
 	worker := func() (finished bool, err error) {
 
-		ipAddresses, err := s.syncGwIpAddresses()
+		upstreams, err := s.FindSyncGwUpstreams()
 		if err != nil {
-			log.Printf("syncGwIpAddresses returned err: %v", err)
+			log.Printf("FindSyncGwUpstreams returned err: %v", err)
 			return false, nil
 		}
 
-		if len(ipAddresses) < s.NumNodes {
-			log.Printf("%v sync gateways running, expected %v", len(ipAddresses), s.NumNodes)
+		if len(upstreams) < s.NumNodes {
+			log.Printf("%v sync gateways running, expected %v", len(upstreams), s.NumNodes)
 			return false, nil
 		}
 
-		err = s.checkSyncGwNodesRunning(ipAddresses)
+		err = s.checkSyncGwNodesRunning(upstreams)
 		if err != nil {
 			log.Printf("checkSyncGwNodesRunning returned err: %v", err)
 			return false, nil
@@ -237,13 +520,11 @@ func (s SyncGwCluster) waitForAllSyncGwNodesRunning() error {
 
 }
 
-func (s SyncGwCluster) checkSyncGwNodesRunning(nodeIpAddresses []string) error {
+func (s SyncGwCluster) checkSyncGwNodesRunning(upstreams []SyncGwUpstream) error {
 
-	for _, syncGwIpAddress := range nodeIpAddresses {
+	for _, upstream := range upstreams {
 
-		// TODO: don't use hardcoded port.  I guess this could get pulled from
-		// the sync gateway configuration
-		endpointUrl := fmt.Sprintf("http://%v:4984/", syncGwIpAddress)
+		endpointUrl := fmt.Sprintf("http://%v:%v/", upstream.Ip, upstream.Port)
 		log.Printf("Waiting for Sync Gw at %v to be up", endpointUrl)
 		resp, err := http.Get(endpointUrl)
 		if err != nil {
@@ -260,55 +541,134 @@ func (s SyncGwCluster) checkSyncGwNodesRunning(nodeIpAddresses []string) error {
 
 }
 
-func (s SyncGwCluster) syncGwIpAddresses() (nodeIpAddresses []string, err error) {
+func (s SyncGwCluster) LaunchSyncGatewaySidekick() error {
 
-	response, err := s.etcdClient.Get(KEY_SYNC_GW_NODE_STATE, false, false)
-	if err != nil {
-		return nil, fmt.Errorf("Error getting key.  Err: %v", err)
+	if s.LocalIp == "" {
+		return fmt.Errorf("You must define LocalIp before calling")
 	}
 
-	node := response.Node
-
-	if node == nil {
-		log.Printf("node is nil, returning")
-		return nil, nil
+	// figure out which ports to advertise
+	if err := s.resolveEndpoints(); err != nil {
+		return err
 	}
 
-	if len(node.Nodes) == 0 {
-		log.Printf("len(node.Nodes) == 0, returning")
-		return nil, nil
+	// create /couchbase.com/sync-gw-node-state/ directory
+	if err := s.CreateNodeStateDirectoryKey(); err != nil {
+		return err
 	}
 
-	nodeIpAddresses = []string{}
+	s.EventLoop()
+
+	return fmt.Errorf("Event loop died") // should never get here
+
+}
 
-	for _, subNode := range node.Nodes {
+// Fill in any ports that weren't given explicitly, and the databases, from
+// the sync gw config in etcd.  The config is rendered with sample values,
+// since the ports and database names don't depend on the couchbase nodes.
+func (s *SyncGwCluster) resolveEndpoints() error {
 
-		// the key will be: /couchbase.com/sync-gw-node-state/172.17.8.101, but we
-		// only want the last element in the path
-		_, subNodeIp := path.Split(subNode.Key)
+	if s.Port == 0 || s.AdminPort == 0 || len(s.Databases) == 0 {
 
-		nodeIpAddresses = append(nodeIpAddresses, subNodeIp)
+		config, err := s.FetchSyncGwConfig()
+		if err != nil {
+			log.Printf("Could not fetch sync gw config (%v), using default ports", err)
+			config = "{}"
+		}
+
+		rendered, err := s.UpdateConfig(SampleSyncGwConfigParams(), config)
+		if err != nil {
+			return err
+		}
+
+		endpoints, err := parseSyncGwConfigEndpoints(rendered)
+		if err != nil {
+			return err
+		}
+
+		if s.Port == 0 {
+			s.Port = endpoints.Port
+		}
+		if s.AdminPort == 0 {
+			s.AdminPort = endpoints.AdminPort
+		}
+		if len(s.Databases) == 0 {
+			s.Databases = endpoints.Databases
+		}
 
 	}
 
-	return nodeIpAddresses, nil
+	log.Printf("Advertising port: %v, admin port: %v, databases: %v", s.Port, s.AdminPort, s.Databases)
+
+	return nil
 
 }
 
-func (s SyncGwCluster) LaunchSyncGatewaySidekick() error {
+// Find the ports and databases in a (rendered) sync gw config, eg:
+//
+//	{"interface": ":4984", "adminInterface": "0.0.0.0:4985", "databases": {"todos": {...}}}
+func parseSyncGwConfigEndpoints(config []byte) (SyncGwNodeState, error) {
 
-	if s.LocalIp == "" {
-		return fmt.Errorf("You must define LocalIp before calling")
+	endpoints := SyncGwNodeState{
+		Port:      DEFAULT_SYNC_GW_PORT,
+		AdminPort: DEFAULT_SYNC_GW_ADMIN_PORT,
+		Databases: []string{},
 	}
 
-	// create /couchbase.com/sync-gw-node-state/ directory
-	if err := s.CreateNodeStateDirectoryKey(); err != nil {
-		return err
+	parsedConfig := struct {
+		Interface      string                     `json:"interface"`
+		AdminInterface string                     `json:"adminInterface"`
+		Databases      map[string]json.RawMessage `json:"databases"`
+	}{}
+	if err := json.Unmarshal(SyncGwConfigToJson(config), &parsedConfig); err != nil {
+		return endpoints, fmt.Errorf("Could not parse sync gw config: %v", err)
 	}
 
-	s.EventLoop()
+	if parsedConfig.Interface != "" {
+		port, err := interfacePort(parsedConfig.Interface)
+		if err != nil {
+			return endpoints, err
+		}
+		endpoints.Port = port
+	}
 
-	return fmt.Errorf("Event loop died") // should never get here
+	if parsedConfig.AdminInterface != "" {
+		port, err := interfacePort(parsedConfig.AdminInterface)
+		if err != nil {
+			return endpoints, err
+		}
+		endpoints.AdminPort = port
+	}
+
+	// sync gateway's default admin interface is 127.0.0.1:4985
+	if parsedConfig.AdminInterface == "" || strings.HasPrefix(parsedConfig.AdminInterface, "127.0.0.1:") ||
+		strings.HasPrefix(parsedConfig.AdminInterface, "localhost:") {
+		log.Printf("Warning: the sync gw admin interface is only reachable from localhost.  " +
+			"Set \"adminInterface\": \":4985\" in the config to manage it remotely")
+	}
+
+	for dbName := range parsedConfig.Databases {
+		endpoints.Databases = append(endpoints.Databases, dbName)
+	}
+	sort.Strings(endpoints.Databases)
+
+	return endpoints, nil
+
+}
+
+// Get the port from an interface like ":4984", "0.0.0.0:4984" or "4984"
+func interfacePort(iface string) (int, error) {
+
+	portStr := iface
+	if _, port, err := net.SplitHostPort(iface); err == nil {
+		portStr = port
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return -1, fmt.Errorf("Invalid interface in sync gw config: %v", iface)
+	}
+	return port, nil
 
 }
 
@@ -348,7 +708,14 @@ func (s SyncGwCluster) EventLoop() {
 			log.Printf(msg)
 		}
 
-		if err := s.PublishNodeStateEtcd(ttlSeconds); err != nil {
+		// make sure sync gateway is actually answering, so that a crashed
+		// gateway isn't advertised for as long as the sidekick lives
+		probeErr := s.ProbeSyncGw()
+		if probeErr != nil {
+			log.Printf("Sync gw failed health check: %v.  Publishing as unhealthy", probeErr)
+		}
+
+		if err := s.PublishNodeStateEtcd(ttlSeconds, probeErr); err != nil {
 			msg := fmt.Sprintf("Error publishing node state to etcd: %v. "+
 				"Check if etcd is running.",
 				err)
@@ -362,27 +729,41 @@ func (s SyncGwCluster) EventLoop() {
 
 }
 
-func (s SyncGwCluster) PublishNodeStateEtcd(ttlSeconds uint64) error {
+func (s SyncGwCluster) PublishNodeStateEtcd(ttlSeconds uint64, probeErr error) error {
 
 	key := path.Join(KEY_SYNC_GW_NODE_STATE, s.LocalIp)
 
-	// TODO: don't hardcode port
-	ipAndPort := fmt.Sprintf("%v:4984", s.LocalIp)
-	_, err := s.etcdClient.Set(key, ipAndPort, ttlSeconds)
+	nodeState := SyncGwNodeState{
+		Ip:        s.LocalIp,
+		Port:      s.Port,
+		AdminPort: s.AdminPort,
+		Databases: s.Databases,
+		Status:    SYNC_GW_STATUS_HEALTHY,
+	}
+	if probeErr != nil {
+		nodeState.Status = SYNC_GW_STATUS_UNHEALTHY
+		nodeState.Reason = probeErr.Error()
+	}
+	nodeStateJson, err := json.Marshal(nodeState)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.etcdClient.Set(key, string(nodeStateJson), ttlSeconds)
 
 	return err
 }
 
-func (s SyncGwCluster) kickOffFleetUnits() error {
+func (s SyncGwCluster) kickOffFleetUnits(unitNumbers []int) error {
 
-	fleetUnitJson, err := s.generateFleetUnitJson()
-	if err != nil {
-		return err
-	}
+	for _, i := range unitNumbers {
 
-	for i := 1; i < s.NumNodes+1; i++ {
+		fleetUnitJson, err := s.generateFleetUnitJson(fmt.Sprintf("%v", i))
+		if err != nil {
+			return err
+		}
 
-		if err := launchFleetUnitN(i, "sync_gw_node", fleetUnitJson); err != nil {
+		if err := launchFleetUnitN(i, UNIT_NAME_SYNC_GW_NODE, fleetUnitJson); err != nil {
 			return err
 		}
 
@@ -391,19 +772,24 @@ func (s SyncGwCluster) kickOffFleetUnits() error {
 	return nil
 }
 
-func (s SyncGwCluster) generateNodeFleetUnitFile() (string, error) {
+func (s SyncGwCluster) generateNodeFleetUnitFile(unitNumber string) (string, error) {
 
 	assetName := "data/sync_gw_node@.service.template"
-	content, err := Asset(assetName)
+
+	syncGwImageTag, err := syncGwImageTag(s.SyncGwVersion, s.SyncGwEdition)
 	if err != nil {
-		return "", fmt.Errorf("could not find asset: %v.  err: %v", assetName, err)
+		return "", err
 	}
 
 	params := struct {
 		CONTAINER_TAG      string
+		SYNC_GW_IMAGE      string
 		WAIT_UNTIL_RUNNING string
+		MACHINE_METADATA   []string
 	}{
-		CONTAINER_TAG: s.ContainerTag,
+		CONTAINER_TAG:    s.ContainerTag,
+		SYNC_GW_IMAGE:    fmt.Sprintf("%v:%v", SYNC_GW_IMAGE, syncGwImageTag),
+		MACHINE_METADATA: s.Placement.UnitMetadata(unitNumber),
 	}
 
 	if s.RequiresCouchbaseServer {
@@ -414,17 +800,13 @@ func (s SyncGwCluster) generateNodeFleetUnitFile() (string, error) {
 		log.Printf("params.!!WAIT_UNTIL_RUNNING")
 	}
 
-	return generateUnitFileFromTemplate(content, params)
+	return s.Templates.Generate(assetName, params)
 
 }
 
 func (s SyncGwCluster) generateSidekickFleetUnitFile(unitNumber string) (string, error) {
 
 	assetName := "data/sync_gw_sidekick@.service.template"
-	content, err := Asset(assetName)
-	if err != nil {
-		return "", fmt.Errorf("could not find asset: %v.  err: %v", assetName, err)
-	}
 
 	params := struct {
 		CONTAINER_TAG string
@@ -434,13 +816,13 @@ func (s SyncGwCluster) generateSidekickFleetUnitFile(unitNumber string) (string,
 		UNIT_NUMBER:   unitNumber,
 	}
 
-	return generateUnitFileFromTemplate(content, params)
+	return s.Templates.Generate(assetName, params)
 
 }
 
-func (s SyncGwCluster) generateFleetUnitJson() (string, error) {
+func (s SyncGwCluster) generateFleetUnitJson(unitNumber string) (string, error) {
 
-	unitFile, err := s.generateNodeFleetUnitFile()
+	unitFile, err := s.generateNodeFleetUnitFile(unitNumber)
 	if err != nil {
 		return "", err
 	}
@@ -456,16 +838,16 @@ func (s SyncGwCluster) generateFleetUnitJson() (string, error) {
 
 }
 
-func (s SyncGwCluster) kickOffFleetSidekickUnits() error {
+func (s SyncGwCluster) kickOffFleetSidekickUnits(unitNumbers []int) error {
 
-	for i := 1; i < s.NumNodes+1; i++ {
+	for _, i := range unitNumbers {
 
 		fleetUnitJson, err := s.generateFleetSidekickUnitJson(i)
 		if err != nil {
 			return err
 		}
 
-		if err := launchFleetUnitN(i, "sync_gw_sidekick", fleetUnitJson); err != nil {
+		if err := launchFleetUnitN(i, UNIT_NAME_SYNC_GW_SIDEKICK, fleetUnitJson); err != nil {
 			return err
 		}
 
@@ -493,15 +875,22 @@ func (s SyncGwCluster) generateFleetSidekickUnitJson(unitNumber int) (string, er
 
 }
 
-func (s SyncGwCluster) addValuesEtcd() error {
+func (s SyncGwCluster) addValuesEtcd(configContent, configSource string) error {
 
-	// add values to etcd
-	_, err := s.etcdClient.Set(KEY_SYNC_GW_CONFIG, s.ConfigUrl, 0)
-	if err != nil {
+	// store the config content itself, so that sync gateways don't
+	// depend on the config url being reachable when they start
+	if _, err := s.StoreSyncGwConfig(configContent, configSource); err != nil {
 		return err
 	}
 
-	return nil
+	if s.ConfigUrl == "" {
+		return nil
+	}
+
+	// keep the url around too, for sync-gw-config binaries that predate
+	// the config being stored in etcd
+	_, err := s.etcdClient.Set(KEY_SYNC_GW_CONFIG, s.ConfigUrl, 0)
+	return err
 
 }
 
@@ -536,21 +925,3 @@ func (s SyncGwCluster) createBucketIfNeeded() error {
 	return cb.CreateBucket(bucketParams)
 
 }
-
-func (s SyncGwCluster) LaunchNginx() error {
-
-	fleetUnits := map[string]string{
-		"confdata": "data/confdata.service",
-		"confd":    "data/confd.service",
-		"nginx":    "data/nginx.service",
-	}
-
-	for unitName, unitFilePath := range fleetUnits {
-		if err := launchFleetUnitFile(unitName, unitFilePath); err != nil {
-			return err
-		}
-	}
-
-	return nil
-
-}
@@ -1,14 +1,16 @@
 package cbcluster
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/coreos/fleet/schema"
 	"github.com/couchbaselabs/go.assert"
 )
 
 func TestGenerateSyncGwNodeFleetUnitJson(t *testing.T) {
 	s := SyncGwCluster{}
-	unitJson, err := s.generateFleetUnitJson()
+	unitJson, err := s.generateFleetUnitJson("1")
 	assert.True(t, err == nil)
 	assert.True(t, len(unitJson) > 0)
 
@@ -20,3 +22,76 @@ func TestGenerateSyncGwSidekickFleetUnitJson(t *testing.T) {
 	assert.True(t, err == nil)
 	assert.True(t, len(unitJson) > 0)
 }
+
+func TestUpdateConfig(t *testing.T) {
+
+	s := SyncGwCluster{}
+	params := SyncGwConfigParams{
+		COUCHBASE_SERVER_IP:   "10.0.0.1",
+		COUCHBASE_SERVER_IPS:  []string{"10.0.0.1", "10.0.0.2"},
+		COUCHBASE_SERVER_LIST: "10.0.0.1,10.0.0.2",
+		BUCKETS:               []string{"todos"},
+		ENV:                   map[string]string{"SG_DB": "todos"},
+	}
+
+	configTemplate := `{"server": "couchbase://{{ .COUCHBASE_SERVER_LIST }}", "db": "{{ .ENV.SG_DB }}", "ips": "{{ join .COUCHBASE_SERVER_IPS ";" }}"}`
+	config, err := s.UpdateConfig(params, configTemplate)
+	assert.True(t, err == nil)
+	assert.Equals(t, string(config), `{"server": "couchbase://10.0.0.1,10.0.0.2", "db": "todos", "ips": "10.0.0.1;10.0.0.2"}`)
+
+}
+
+func TestSyncGwConfigRevisionKey(t *testing.T) {
+
+	// zero padded so that etcd sorts revisions in order
+	assert.Equals(t, syncGwConfigRevisionKey(12), "/couchbase.com/sync-gateway/config-history/00000012")
+	assert.True(t, syncGwConfigRevisionKey(9) < syncGwConfigRevisionKey(10))
+
+}
+
+func TestParseSyncGwConfigEndpoints(t *testing.T) {
+
+	config := "{\"interface\": \":5984\", \"adminInterface\": \"0.0.0.0:5985\", \"databases\": {\"todos\": {\"sync\": `function(doc) {}`}, \"photos\": {}}}"
+	endpoints, err := parseSyncGwConfigEndpoints([]byte(config))
+	assert.True(t, err == nil)
+	assert.Equals(t, endpoints.Port, 5984)
+	assert.Equals(t, endpoints.AdminPort, 5985)
+	assert.Equals(t, len(endpoints.Databases), 2)
+	assert.Equals(t, endpoints.Databases[0], "photos")
+
+	// sync gateway defaults
+	endpoints, err = parseSyncGwConfigEndpoints([]byte(`{}`))
+	assert.True(t, err == nil)
+	assert.Equals(t, endpoints.Port, DEFAULT_SYNC_GW_PORT)
+	assert.Equals(t, endpoints.AdminPort, DEFAULT_SYNC_GW_ADMIN_PORT)
+
+	_, err = parseSyncGwConfigEndpoints([]byte(`{"interface": "http"}`))
+	assert.True(t, err != nil)
+
+}
+
+func TestSyncGwUnitNamePatterns(t *testing.T) {
+
+	units := []*schema.Unit{}
+	for _, name := range []string{
+		"couchbase_node@1.service",
+		"couchbase_sidekick@1.service",
+		"sync_gw_node@1.service",
+		"sync_gw_sidekick@1.service",
+		"sync_gw_load_balancer.service",
+		"sync_gw_load_balancer_sidekick.service",
+	} {
+		units = append(units, &schema.Unit{Name: name})
+	}
+
+	// only the sync gateway units, never the couchbase server ones
+	filtered := filterFleetUnits(units, syncGwUnitNamePatterns)
+	assert.Equals(t, len(filtered), 4)
+	assert.Equals(t, filtered[0].Name, "sync_gw_node@1.service")
+
+}
+
+func TestUnitNumberRange(t *testing.T) {
+	assert.Equals(t, fmt.Sprintf("%v", unitNumberRange(3, 5)), "[3 4 5]")
+	assert.Equals(t, len(unitNumberRange(4, 3)), 0)
+}
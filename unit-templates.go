@@ -0,0 +1,132 @@
+package cbcluster
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The unit file templates, which are compiled in via go-bindata but can be
+// overridden one at a time by a file with the same name in Dir, eg
+// couchbase_node@.service.template.  Vars are extra values supplied by the
+// user, available in the templates as {{ var "NAME" }}.
+type UnitTemplates struct {
+	Dir  string
+	Vars map[string]string
+}
+
+// Make sure the template dir exists, and warn about files in it that
+// don't override anything, since that's probably a typo.
+func (t UnitTemplates) Validate() error {
+
+	if t.Dir == "" {
+		return nil
+	}
+
+	fileInfos, err := ioutil.ReadDir(t.Dir)
+	if err != nil {
+		return fmt.Errorf("Invalid template dir: %v", err)
+	}
+
+	knownTemplates := map[string]bool{}
+	for _, assetName := range AssetNames() {
+		knownTemplates[path.Base(assetName)] = true
+	}
+
+	for _, fileInfo := range fileInfos {
+		if !knownTemplates[fileInfo.Name()] {
+			log.Printf("Warning: %v in template dir %v does not override any template", fileInfo.Name(), t.Dir)
+		}
+	}
+
+	return nil
+
+}
+
+// The template content, from the template dir if it has an override,
+// otherwise the compiled in default.
+func (t UnitTemplates) Load(assetName string) ([]byte, error) {
+
+	if t.Dir != "" {
+		overridePath := filepath.Join(t.Dir, path.Base(assetName))
+		content, err := ioutil.ReadFile(overridePath)
+		if err == nil {
+			log.Printf("Using template override %v", overridePath)
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	content, err := Asset(assetName)
+	if err != nil {
+		return nil, fmt.Errorf("could not find asset: %v.  err: %v", assetName, err)
+	}
+	return content, nil
+
+}
+
+// Load the template and render it with the given params and the user vars
+func (t UnitTemplates) Generate(assetName string, params interface{}) (string, error) {
+
+	content, err := t.Load(assetName)
+	if err != nil {
+		return "", err
+	}
+
+	return generateUnitFileFromTemplate(content, params, t.Vars)
+
+}
+
+func generateUnitFileFromTemplate(templateContent []byte, params interface{}, templateVars map[string]string) (string, error) {
+
+	funcMap := template.FuncMap{
+		// user vars are things like docker flags, and shouldn't be
+		// html escaped.  Missing vars are empty, so that the default
+		// templates can reference optional vars.
+		"var": func(name string) template.HTML {
+			return template.HTML(templateVars[name])
+		},
+	}
+
+	// run through go template engine
+	tmpl, err := template.New("Template").Funcs(funcMap).Parse(string(templateContent))
+	if err != nil {
+		return "", err
+	}
+
+	out := &bytes.Buffer{}
+
+	// execute template and write to dest
+	err = tmpl.Execute(out, params)
+	if err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+
+}
+
+// Parse --template-var values, eg DOCKER_RUN_ARGS=-v /data:/opt/couchbase/var
+func parseTemplateVars(rawTemplateVars []string) (map[string]string, error) {
+
+	templateVars := map[string]string{}
+
+	for _, rawTemplateVar := range rawTemplateVars {
+		components := strings.SplitN(rawTemplateVar, "=", 2)
+		if len(components) != 2 || strings.TrimSpace(components[0]) == "" {
+			return nil, fmt.Errorf("Invalid template var: %v.  Expected name=value", rawTemplateVar)
+		}
+		templateVars[strings.TrimSpace(components[0])] = components[1]
+	}
+
+	return templateVars, nil
+
+}
@@ -0,0 +1,57 @@
+package cbcluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestUnitTemplatesOverride(t *testing.T) {
+
+	templateDir, err := ioutil.TempDir("", "unit-templates")
+	assert.True(t, err == nil)
+	defer os.RemoveAll(templateDir)
+
+	override := `ExecStart=/usr/bin/docker run {{ var "DOCKER_RUN_ARGS" }} couchbase/server:{{ .CB_VERSION }}`
+	err = ioutil.WriteFile(filepath.Join(templateDir, "couchbase_node@.service.template"), []byte(override), 0644)
+	assert.True(t, err == nil)
+
+	c := CouchbaseFleet{
+		CbVersion: "enterprise-4.0.0",
+		Templates: UnitTemplates{
+			Dir:  templateDir,
+			Vars: map[string]string{"DOCKER_RUN_ARGS": `-v /data:/opt/couchbase/var --memory="4g"`},
+		},
+	}
+	assert.True(t, c.Templates.Validate() == nil)
+
+	// overridden, and the var isn't html escaped
+	unitFile, err := c.generateNodeFleetUnitFile("1")
+	assert.True(t, err == nil)
+	assert.Equals(t, unitFile, `ExecStart=/usr/bin/docker run -v /data:/opt/couchbase/var --memory="4g" couchbase/server:enterprise-4.0.0`)
+
+	// not overridden, so falls back to the built in template
+	unitFile, err = c.generateSidekickFleetUnitFile("1")
+	assert.True(t, err == nil)
+	assert.True(t, strings.Contains(unitFile, "couchbase_sidekick"))
+
+	missing := UnitTemplates{Dir: filepath.Join(templateDir, "missing")}
+	assert.True(t, missing.Validate() != nil)
+
+}
+
+func TestParseTemplateVars(t *testing.T) {
+
+	templateVars, err := parseTemplateVars([]string{"DOCKER_RUN_ARGS=--memory=4g", "EMPTY="})
+	assert.True(t, err == nil)
+	assert.Equals(t, templateVars["DOCKER_RUN_ARGS"], "--memory=4g")
+	assert.Equals(t, templateVars["EMPTY"], "")
+
+	_, err = parseTemplateVars([]string{"no-equals"})
+	assert.True(t, err != nil)
+
+}
@@ -0,0 +1,473 @@
+package cbcluster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/fleet/schema"
+)
+
+// Replace the couchbase server nodes one at a time with nodes running
+// c.CbVersion.  Each node is removed from the cluster (via the
+// remove-and-rebalance in the node unit's ExecStop), relaunched with the
+// new version, and then added back and rebalanced by its sidekick.
+// If any node fails to come back healthy on the new version, the upgrade
+// is aborted and the remaining nodes are left untouched.
+func (c *CouchbaseFleet) UpgradeCouchbaseServer() error {
+
+	if err := c.VerifyFleetAPIAvailable(); err != nil {
+		msg := "Unable to connect to Fleet API, see http://bit.ly/1AC1iRX " +
+			"for instructions on how to fix this"
+		return errors.New(msg)
+	}
+
+	unitNumbers, err := findFleetUnitNumbers(UNIT_NAME_NODE)
+	if err != nil {
+		return err
+	}
+	if len(unitNumbers) == 0 {
+		return fmt.Errorf("No %v units found, nothing to upgrade", UNIT_NAME_NODE)
+	}
+
+	// a rolling upgrade needs another node to hold the data while each
+	// node is replaced, and would otherwise wait forever for the only
+	// node to be rebalanced out
+	if len(unitNumbers) == 1 {
+		return fmt.Errorf("Only one %v unit found, a rolling upgrade needs at least two nodes.  "+
+			"Scale the cluster up first, or back it up and relaunch it on %v", UNIT_NAME_NODE, c.CbVersion)
+	}
+	c.NumNodes = len(unitNumbers)
+
+	if err := c.resolvePlacement(); err != nil {
+		return err
+	}
+
+	cb := NewCouchbaseCluster(c.EtcdServers)
+	if err := cb.LoadAdminCredsFromEtcd(); err != nil {
+		return err
+	}
+
+	// if remove-rebalance is disabled, stopping a node would just drop
+	// it (and its data) from the cluster without rebalancing first
+	if cb.CheckRemoveRebalanceDisabled() {
+		return fmt.Errorf("Found key %v in etcd, refusing to upgrade since nodes "+
+			"would not be rebalanced out before being replaced", KEY_REMOVE_REBALANCE_DISABLED)
+	}
+
+	for i, unitNumber := range unitNumbers {
+
+		log.Printf("Upgrading node %v/%v (unit number %v) to %v", i+1, len(unitNumbers), unitNumber, c.CbVersion)
+
+		if err := c.upgradeNode(cb, unitNumber); err != nil {
+			return fmt.Errorf("Upgrade aborted on %v@%v.service: %v.  "+
+				"%v node(s) were upgraded to %v, the remaining %v were not touched",
+				UNIT_NAME_NODE, unitNumber, err, i, c.CbVersion, len(unitNumbers)-i-1)
+		}
+
+		log.Printf("Node %v/%v upgraded to %v", i+1, len(unitNumbers), c.CbVersion)
+
+	}
+
+	log.Printf("All %v nodes upgraded to %v", len(unitNumbers), c.CbVersion)
+
+	return nil
+
+}
+
+// Replace a single node + sidekick unit pair with units running c.CbVersion
+func (c CouchbaseFleet) upgradeNode(cb *CouchbaseCluster, unitNumber int) error {
+
+	nodeUnitName := fmt.Sprintf("%v@%v.service", UNIT_NAME_NODE, unitNumber)
+	sidekickUnitName := fmt.Sprintf("%v@%v.service", UNIT_NAME_SIDEKICK, unitNumber)
+
+	oldNodeIp, err := findUnitMachineIp(nodeUnitName)
+	if err != nil {
+		return err
+	}
+	log.Printf("%v is running on %v", nodeUnitName, oldNodeIp)
+
+	// the relaunched sidekick has to run the same services with the same
+	// memory quotas, so read them back before the unit is destroyed
+	sidekickFlags, err := c.findSidekickUnitFlags(sidekickUnitName)
+	if err != nil {
+		return err
+	}
+	upgraded := c.withSidekickFlags(fmt.Sprintf("%v", unitNumber), sidekickFlags)
+
+	// destroy the sidekick first so that it stops publishing the node
+	// into etcd, then the node itself, which will remove and rebalance
+	// itself out of the cluster as part of ExecStop
+	for _, unitName := range []string{sidekickUnitName, nodeUnitName} {
+		endpointUrl := fmt.Sprintf("%v/units/%v", FLEET_API_ENDPOINT, unitName)
+		log.Printf("Destroy unit %v via DELETE %v", unitName, endpointUrl)
+		if err := DELETE(endpointUrl); err != nil {
+			return err
+		}
+	}
+
+	if err := c.waitUntilNodeRemoved(cb, oldNodeIp); err != nil {
+		return err
+	}
+
+	// fleet won't accept a new unit under the same name until the old
+	// one is completely gone
+	for _, unitName := range []string{sidekickUnitName, nodeUnitName} {
+		if err := waitUntilUnitDestroyed(unitName); err != nil {
+			return err
+		}
+	}
+
+	nodeFleetUnitJson, err := c.generateNodeFleetUnitJson(fmt.Sprintf("%v", unitNumber))
+	if err != nil {
+		return err
+	}
+	if err := launchFleetUnitN(unitNumber, UNIT_NAME_NODE, nodeFleetUnitJson); err != nil {
+		return err
+	}
+
+	sidekickFleetUnitJson, err := upgraded.generateSidekickFleetUnitJson(fmt.Sprintf("%v", unitNumber))
+	if err != nil {
+		return err
+	}
+	if err := launchFleetUnitN(unitNumber, UNIT_NAME_SIDEKICK, sidekickFleetUnitJson); err != nil {
+		return err
+	}
+
+	// wait for the new node to join and the cluster to be healthy again
+	numRetries := 100
+	if err := cb.WaitUntilNumNodesRunning(c.NumNodes, numRetries); err != nil {
+		return err
+	}
+
+	liveNodeIp, err := cb.FindLiveNode()
+	if err != nil {
+		return err
+	}
+	if liveNodeIp == "" {
+		return fmt.Errorf("Could not find live node")
+	}
+	if err := cb.WaitUntilNoRebalanceRunning(liveNodeIp, 10); err != nil {
+		return err
+	}
+
+	return c.verifyNodeVersion(cb, nodeUnitName)
+
+}
+
+// Get the --flag=value arguments that the given sidekick unit was launched
+// with, eg {"--services": "index,query"}
+func (c CouchbaseFleet) findSidekickUnitFlags(sidekickUnitName string) (map[string]string, error) {
+
+	endpointUrl := fmt.Sprintf("%v/units/%v", FLEET_API_ENDPOINT, sidekickUnitName)
+
+	unit := schema.Unit{}
+	if err := getJsonData(endpointUrl, &unit); err != nil {
+		return nil, err
+	}
+
+	for _, option := range unit.Options {
+		if option.Section == "Service" && option.Name == "ExecStart" {
+			return parseSidekickFlags(option.Value), nil
+		}
+	}
+
+	return nil, fmt.Errorf("No ExecStart found in unit %v", sidekickUnitName)
+
+}
+
+// Extract the --flag=value arguments from a sidekick ExecStart line
+func parseSidekickFlags(execStart string) map[string]string {
+
+	flags := map[string]string{}
+	for _, field := range strings.Fields(execStart) {
+		field = strings.Trim(field, "'")
+		if !strings.HasPrefix(field, "--") {
+			continue
+		}
+		components := strings.SplitN(field, "=", 2)
+		if len(components) != 2 {
+			continue
+		}
+		flags[components[0]] = components[1]
+	}
+	return flags
+
+}
+
+// Return a copy of the fleet settings that will regenerate the sidekick
+// for the given unit number with the flags it was originally launched with
+func (c CouchbaseFleet) withSidekickFlags(unitNumber string, flags map[string]string) CouchbaseFleet {
+
+	unitServices := map[string]string{}
+	for k, v := range c.UnitServices {
+		unitServices[k] = v
+	}
+	unitServices[unitNumber] = flags["--services"]
+
+	c.UnitServices = unitServices
+	c.MemoryQuotas = flags["--memory-quotas"]
+	c.MemoryQuotaPolicy = flags["--memory-quota-policy"]
+
+	// only keep the zone if the upgrade wasn't asked to assign server groups
+	if zone, ok := flags["--zone"]; ok && c.Placement.UnitServerGroup(unitNumber) == "" {
+		unitZones := map[string]string{}
+		for k, v := range c.UnitZones {
+			unitZones[k] = v
+		}
+		unitZones[unitNumber] = zone
+		c.UnitZones = unitZones
+	}
+
+	return c
+
+}
+
+// Wait until the node with the given ip is no longer part of the cluster,
+// and the rebalance that removed it has finished.
+func (c CouchbaseFleet) waitUntilNodeRemoved(cb *CouchbaseCluster, nodeIp string) error {
+
+	maxAttempts := 500
+	sleepSeconds := 10
+
+	worker := func() (finished bool, err error) {
+
+		liveNodeIp, err := cb.FindLiveNode()
+		if err != nil || liveNodeIp == "" || liveNodeIp == nodeIp {
+			log.Printf("Could not find live node other than %v, will retry.  err: %v", nodeIp, err)
+			return false, nil
+		}
+
+		nodes, err := cb.GetClusterNodes(liveNodeIp)
+		if err != nil {
+			log.Printf("GetClusterNodes returned err: %v, will retry", err)
+			return false, nil
+		}
+
+		for _, node := range nodes {
+			nodeMap, ok := node.(map[string]interface{})
+			if !ok {
+				return false, fmt.Errorf("Node had unexpected data type")
+			}
+			hostname, _ := nodeMap["hostname"].(string)
+			if nodeHostnameIp(hostname) == nodeIp {
+				log.Printf("Node %v still in cluster, waiting for it to be removed", nodeIp)
+				return false, nil
+			}
+		}
+
+		isRebalancing, err := cb.IsRebalancing(liveNodeIp)
+		if err != nil {
+			return false, err
+		}
+		return !isRebalancing, nil
+
+	}
+
+	sleeper := func(numAttempts int) (bool, int) {
+		if numAttempts > maxAttempts {
+			return false, -1
+		}
+		return true, sleepSeconds
+	}
+
+	return RetryLoop(worker, sleeper)
+
+}
+
+// Strip the port from a hostname like 10.0.0.1:8091
+func nodeHostnameIp(hostname string) string {
+	if i := strings.LastIndex(hostname, ":"); i != -1 {
+		return hostname[:i]
+	}
+	return hostname
+}
+
+// Check that the node running the given unit reports the version
+// we upgraded to.
+func (c CouchbaseFleet) verifyNodeVersion(cb *CouchbaseCluster, nodeUnitName string) error {
+
+	nodeIp, err := findUnitMachineIp(nodeUnitName)
+	if err != nil {
+		return err
+	}
+
+	upgradedNode := *cb
+	upgradedNode.LocalCouchbaseIp = nodeIp
+	if err := upgradedNode.FetchClusterDetails(); err != nil {
+		return err
+	}
+
+	if !cbVersionMatches(c.CbVersion, upgradedNode.LocalCouchbaseVersion) {
+		return fmt.Errorf("Node %v reports version %v, expected %v",
+			nodeIp, upgradedNode.LocalCouchbaseVersion, c.CbVersion)
+	}
+
+	log.Printf("Node %v is running version %v", nodeIp, upgradedNode.LocalCouchbaseVersion)
+
+	return nil
+
+}
+
+// Does the version reported by the REST api (eg, "3.0.1-1444-rel-community")
+// match the version that was requested on the command line (eg, "community-3.0.1")?
+func cbVersionMatches(requestedVersion, actualVersion string) bool {
+
+	// there's no way to know which version "latest" corresponds to
+	if requestedVersion == "latest" {
+		return true
+	}
+
+	for _, edition := range []string{"community-", "enterprise-"} {
+		requestedVersion = strings.TrimPrefix(requestedVersion, edition)
+	}
+
+	if actualVersion == requestedVersion {
+		return true
+	}
+
+	return strings.HasPrefix(actualVersion, fmt.Sprintf("%v-", requestedVersion))
+
+}
+
+// Find the unit numbers of all the units with the given name, ie, [1, 2, 3]
+// for couchbase_node@1.service .. couchbase_node@3.service
+func findFleetUnitNumbers(unitName string) ([]int, error) {
+
+	allUnits, err := findAllFleetUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	unitNumbers := []int{}
+	for _, unit := range filterFleetUnits(allUnits, []string{fmt.Sprintf("%v@", unitName)}) {
+		unitNumber, err := fleetUnitNumber(unit.Name)
+		if err != nil {
+			log.Printf("Skipping unit %v: %v", unit.Name, err)
+			continue
+		}
+		unitNumbers = append(unitNumbers, unitNumber)
+	}
+	sort.Ints(unitNumbers)
+
+	return unitNumbers, nil
+
+}
+
+// Extract the unit number from a unit name, eg, couchbase_node@3.service -> 3
+func fleetUnitNumber(unitName string) (int, error) {
+
+	atIndex := strings.Index(unitName, "@")
+	if atIndex == -1 {
+		return -1, fmt.Errorf("No @ in unit name: %v", unitName)
+	}
+	unitNumberStr := strings.TrimSuffix(unitName[atIndex+1:], ".service")
+	return strconv.Atoi(unitNumberStr)
+
+}
+
+// Find the ip of the machine that fleet scheduled the given unit on.  Since
+// it can take a while for fleet to schedule a newly created unit, retry
+// until the unit has been assigned to a machine.
+func findUnitMachineIp(unitName string) (string, error) {
+
+	maxAttempts := 30
+	sleepSeconds := 10
+	machineIp := ""
+
+	worker := func() (finished bool, err error) {
+
+		allUnits, err := findAllFleetUnits()
+		if err != nil {
+			return false, err
+		}
+
+		var unit *schema.Unit
+		for _, candidate := range allUnits {
+			if candidate.Name == unitName {
+				unit = candidate
+			}
+		}
+		if unit == nil {
+			return false, fmt.Errorf("Unit %v not found", unitName)
+		}
+		if unit.MachineID == "" {
+			log.Printf("Unit %v not scheduled on a machine yet", unitName)
+			return false, nil
+		}
+
+		machines, err := findAllFleetMachines()
+		if err != nil {
+			return false, err
+		}
+		for _, machine := range machines {
+			if machine.Id == unit.MachineID {
+				machineIp = machine.PrimaryIP
+				return true, nil
+			}
+		}
+
+		return false, fmt.Errorf("Machine %v for unit %v not found", unit.MachineID, unitName)
+
+	}
+
+	sleeper := func(numAttempts int) (bool, int) {
+		if numAttempts > maxAttempts {
+			return false, -1
+		}
+		return true, sleepSeconds
+	}
+
+	if err := RetryLoop(worker, sleeper); err != nil {
+		return "", err
+	}
+
+	return machineIp, nil
+
+}
+
+func findAllFleetMachines() ([]*schema.Machine, error) {
+
+	endpointUrl := fmt.Sprintf("%v/machines", FLEET_API_ENDPOINT)
+
+	machinePage := schema.MachinePage{}
+	if err := getJsonData(endpointUrl, &machinePage); err != nil {
+		return nil, err
+	}
+
+	return machinePage.Machines, nil
+
+}
+
+// Block until the given unit no longer shows up in the fleet unit list
+func waitUntilUnitDestroyed(unitName string) error {
+
+	for i := 0; i < MAX_RETRIES_JOIN_CLUSTER; i++ {
+
+		allUnits, err := findAllFleetUnits()
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, unit := range allUnits {
+			if unit.Name == unitName {
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+
+		log.Printf("Unit %v still present, sleeping and will retry", unitName)
+		<-time.After(time.Second * 10)
+
+	}
+
+	return fmt.Errorf("Unit %v still present after several attempts", unitName)
+
+}
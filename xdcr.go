@@ -0,0 +1,349 @@
+package cbcluster
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// A cluster to replicate to, as registered under /pools/default/remoteClusters
+type XdcrRemote struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"` // ip:port of any node in the remote cluster
+	Uuid     string `json:"uuid"`
+	Username string `json:"username"`
+	Password string `json:"-"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// An xdcr replication, from the xdcr tasks in /pools/default/tasks
+type XdcrReplication struct {
+	Id             string `json:"id"` // <remote uuid>/<from bucket>/<to bucket>
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	Source         string `json:"source"`
+	PauseRequested bool   `json:"pauseRequested"`
+}
+
+func (r XdcrReplication) RemoteUuid() string {
+	return strings.SplitN(r.Id, "/", 3)[0]
+}
+
+func (r XdcrReplication) ToBucket() string {
+	components := strings.SplitN(r.Id, "/", 3)
+	if len(components) != 3 {
+		return ""
+	}
+	return components[2]
+}
+
+// Work out the address and credentials of a remote cluster.  Either the
+// address is given explicitly, along with its user:pass, or the remote
+// cluster was launched by couchbase-fleet against another etcd cluster,
+// in which case a live node and the credentials are found there.  An
+// explicit userPass overrides the one in the remote etcd.
+//
+// There's no resolving by etcd namespace: all the keys live under the
+// fixed /couchbase.com prefix, so clusters can't share an etcd and the
+// remote etcd servers are what identifies a remote cluster.
+func ResolveXdcrRemote(name, hostname string, remoteEtcdServers []string, userPass string) (XdcrRemote, error) {
+
+	remote := XdcrRemote{Name: name}
+
+	if name == "" {
+		return remote, fmt.Errorf("A name for the remote cluster is required")
+	}
+
+	switch {
+	case hostname != "":
+		if !strings.Contains(hostname, ":") {
+			hostname = fmt.Sprintf("%v:%v", hostname, DEFAULT_CB_PORT)
+		}
+		remote.Hostname = hostname
+		if userPass == "" {
+			return remote, fmt.Errorf("A user:pass for the remote cluster is required when giving its address")
+		}
+	case len(remoteEtcdServers) > 0:
+		remoteCluster := NewCouchbaseCluster(remoteEtcdServers)
+		liveNodeIp, err := remoteCluster.FindLiveNode()
+		if err != nil {
+			return remote, fmt.Errorf("Unable to find a live node of the remote cluster: %v", err)
+		}
+		remote.Hostname = fmt.Sprintf("%v:%v", liveNodeIp, DEFAULT_CB_PORT)
+		if userPass == "" {
+			if err := remoteCluster.LoadAdminCredsFromEtcd(); err != nil {
+				return remote, fmt.Errorf("Unable to get the credentials of the remote cluster: %v", err)
+			}
+			remote.Username = remoteCluster.AdminUsername
+			remote.Password = remoteCluster.AdminPassword
+		}
+	default:
+		return remote, fmt.Errorf("Either the address or the etcd servers of the remote cluster are required")
+	}
+
+	if userPass != "" {
+		components := strings.SplitN(userPass, ":", 2)
+		if len(components) != 2 {
+			return remote, fmt.Errorf("Invalid user/pass for the remote cluster.  Expected user:pass")
+		}
+		remote.Username = components[0]
+		remote.Password = components[1]
+	}
+
+	return remote, nil
+
+}
+
+func (c CouchbaseCluster) GetXdcrRemotes(liveNodeIp string) ([]XdcrRemote, error) {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/remoteClusters", liveNodeIp, c.LocalCouchbasePort)
+
+	remotes := []XdcrRemote{}
+	if err := c.getJsonData(endpointUrl, &remotes); err != nil {
+		return nil, err
+	}
+
+	live := []XdcrRemote{}
+	for _, remote := range remotes {
+		if !remote.Deleted {
+			live = append(live, remote)
+		}
+	}
+
+	return live, nil
+
+}
+
+func (c CouchbaseCluster) findXdcrRemote(liveNodeIp, name string) (XdcrRemote, bool, error) {
+
+	remotes, err := c.GetXdcrRemotes(liveNodeIp)
+	if err != nil {
+		return XdcrRemote{}, false, err
+	}
+
+	for _, remote := range remotes {
+		if remote.Name == name {
+			return remote, true, nil
+		}
+	}
+
+	return XdcrRemote{}, false, nil
+
+}
+
+// Register the remote cluster, or update its address and credentials if
+// one with the same name is registered already, eg after it was rebuilt.
+func (c CouchbaseCluster) AddXdcrRemote(remote XdcrRemote) error {
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+
+	_, exists, err := c.findXdcrRemote(liveNodeIp, remote.Name)
+	if err != nil {
+		return err
+	}
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/remoteClusters", liveNodeIp, c.LocalCouchbasePort)
+	if exists {
+		log.Printf("Remote cluster %v already exists, updating it", remote.Name)
+		endpointUrl = fmt.Sprintf("%v/%v", endpointUrl, url.QueryEscape(remote.Name))
+	}
+
+	data := url.Values{
+		"name":     {remote.Name},
+		"hostname": {remote.Hostname},
+		"username": {remote.Username},
+		"password": {remote.Password},
+	}
+
+	return c.POST(false, endpointUrl, data)
+
+}
+
+func (c CouchbaseCluster) GetXdcrReplications(liveNodeIp string) ([]XdcrReplication, error) {
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/tasks", liveNodeIp, c.LocalCouchbasePort)
+
+	tasks := []XdcrReplication{}
+	if err := c.getJsonData(endpointUrl, &tasks); err != nil {
+		return nil, err
+	}
+
+	replications := []XdcrReplication{}
+	for _, task := range tasks {
+		if task.Type == "xdcr" {
+			replications = append(replications, task)
+		}
+	}
+
+	return replications, nil
+
+}
+
+// The replications of the bucket to the remote cluster, or of all buckets
+// if bucket is empty
+func (c CouchbaseCluster) findXdcrReplications(liveNodeIp, remoteName, bucket string) ([]XdcrReplication, error) {
+
+	remote, exists, err := c.findXdcrRemote(liveNodeIp, remoteName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("No remote cluster named %v", remoteName)
+	}
+
+	replications, err := c.GetXdcrReplications(liveNodeIp)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []XdcrReplication{}
+	for _, replication := range replications {
+		if replication.RemoteUuid() != remote.Uuid {
+			continue
+		}
+		if bucket != "" && replication.Source != bucket {
+			continue
+		}
+		matching = append(matching, replication)
+	}
+
+	return matching, nil
+
+}
+
+// Start continuous replication of the bucket to the remote cluster, unless
+// it's already being replicated there
+func (c CouchbaseCluster) CreateXdcrReplication(remoteName, bucket, remoteBucket string) error {
+
+	if remoteBucket == "" {
+		remoteBucket = bucket
+	}
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findXdcrReplications(liveNodeIp, remoteName, bucket)
+	if err != nil {
+		return err
+	}
+	for _, replication := range existing {
+		if replication.ToBucket() == remoteBucket {
+			log.Printf("Bucket %v is already replicated to %v on %v", bucket, remoteBucket, remoteName)
+			return nil
+		}
+	}
+
+	endpointUrl := fmt.Sprintf("http://%v:%v/controller/createReplication", liveNodeIp, c.LocalCouchbasePort)
+
+	data := url.Values{
+		"fromBucket":      {bucket},
+		"toCluster":       {remoteName},
+		"toBucket":        {remoteBucket},
+		"replicationType": {"continuous"},
+	}
+
+	return c.POST(false, endpointUrl, data)
+
+}
+
+// Pause or resume the replications of the bucket (or all buckets, if empty)
+// to the remote cluster
+func (c CouchbaseCluster) PauseXdcrReplications(remoteName, bucket string, pause bool) error {
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+
+	replications, err := c.findXdcrReplications(liveNodeIp, remoteName, bucket)
+	if err != nil {
+		return err
+	}
+	if len(replications) == 0 {
+		return fmt.Errorf("No replications to %v found", remoteName)
+	}
+
+	for _, replication := range replications {
+		endpointUrl := fmt.Sprintf("http://%v:%v/settings/replications/%v", liveNodeIp, c.LocalCouchbasePort, url.QueryEscape(replication.Id))
+		data := url.Values{
+			"pauseRequested": {fmt.Sprintf("%v", pause)},
+		}
+		if err := c.POST(false, endpointUrl, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// Delete the replications of the bucket to the remote cluster.  If no
+// bucket is given, all replications to it are deleted, along with the
+// remote cluster itself.
+func (c CouchbaseCluster) DeleteXdcr(remoteName, bucket string) error {
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+
+	replications, err := c.findXdcrReplications(liveNodeIp, remoteName, bucket)
+	if err != nil {
+		return err
+	}
+
+	for _, replication := range replications {
+		log.Printf("Deleting replication %v", replication.Id)
+		endpointUrl := fmt.Sprintf("http://%v:%v/controller/cancelXDCR/%v", liveNodeIp, c.LocalCouchbasePort, url.QueryEscape(replication.Id))
+		if err := c.DELETE(endpointUrl); err != nil {
+			return err
+		}
+	}
+
+	if bucket != "" {
+		return nil
+	}
+
+	log.Printf("Deleting remote cluster %v", remoteName)
+	endpointUrl := fmt.Sprintf("http://%v:%v/pools/default/remoteClusters/%v", liveNodeIp, c.LocalCouchbasePort, url.QueryEscape(remoteName))
+	return c.DELETE(endpointUrl)
+
+}
+
+// Print the remote clusters and the replications to each of them
+func (c CouchbaseCluster) PrintXdcr(w io.Writer) error {
+
+	liveNodeIp, err := c.FindLiveNode()
+	if err != nil {
+		return err
+	}
+
+	remotes, err := c.GetXdcrRemotes(liveNodeIp)
+	if err != nil {
+		return err
+	}
+
+	replications, err := c.GetXdcrReplications(liveNodeIp)
+	if err != nil {
+		return err
+	}
+
+	for _, remote := range remotes {
+		fmt.Fprintf(w, "%v (%v)\n", remote.Name, remote.Hostname)
+		for _, replication := range replications {
+			if replication.RemoteUuid() == remote.Uuid {
+				fmt.Fprintf(w, "  %v -> %v %v\n", replication.Source, replication.ToBucket(), replication.Status)
+			}
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,40 @@
+package cbcluster
+
+import (
+	"testing"
+
+	"github.com/couchbaselabs/go.assert"
+)
+
+func TestResolveXdcrRemote(t *testing.T) {
+
+	remote, err := ResolveXdcrRemote("dr", "10.1.0.5", nil, "user:pass:word")
+	assert.True(t, err == nil)
+	assert.Equals(t, remote.Hostname, "10.1.0.5:8091")
+	assert.Equals(t, remote.Username, "user")
+	assert.Equals(t, remote.Password, "pass:word")
+
+	remote, err = ResolveXdcrRemote("dr", "10.1.0.5:9000", nil, "user:pass")
+	assert.True(t, err == nil)
+	assert.Equals(t, remote.Hostname, "10.1.0.5:9000")
+
+	// an explicit address needs credentials
+	_, err = ResolveXdcrRemote("dr", "10.1.0.5", nil, "")
+	assert.True(t, err != nil)
+
+	// as does the remote itself
+	_, err = ResolveXdcrRemote("dr", "", nil, "user:pass")
+	assert.True(t, err != nil)
+
+	_, err = ResolveXdcrRemote("", "10.1.0.5", nil, "user:pass")
+	assert.True(t, err != nil)
+
+}
+
+func TestXdcrReplicationId(t *testing.T) {
+
+	replication := XdcrReplication{Id: "9a1b2c/default/backup"}
+	assert.Equals(t, replication.RemoteUuid(), "9a1b2c")
+	assert.Equals(t, replication.ToBucket(), "backup")
+
+}